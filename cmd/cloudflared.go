@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"time"
+
+	"github.com/sudo-init-do/goshare/internal/server"
+)
+
+// quickTunnelURL matches the address cloudflared logs for a quick tunnel
+var quickTunnelURL = regexp.MustCompile(`https://[a-z0-9-]+\.trycloudflare\.com`)
+
+// startCloudflaredTunnel exposes the share through a Cloudflare quick
+// tunnel, which needs no account. cloudflared only reports the generated
+// URL in its log output, so that is scanned for it.
+func startCloudflaredTunnel(cfg server.Config) {
+	found := make(chan string, 1)
+	runTunnel(cfg, tunnel{
+		name:      "cloudflared",
+		label:     "🌍 Public URL",
+		launching: "☁️  Launching Cloudflare tunnel...",
+		noURL:     "Check the cloudflared output with `cloudflared tunnel --url` yourself",
+		command: func() *exec.Cmd {
+			upstream := fmt.Sprintf("http://127.0.0.1:%d", cfg.Port)
+			args := []string{"tunnel", "--url", upstream}
+			if cfg.UsesTLS() {
+				// Our certificate is likely self-signed, and the hop is local anyway
+				upstream = fmt.Sprintf("https://127.0.0.1:%d", cfg.Port)
+				args = []string{"tunnel", "--no-tls-verify", "--url", upstream}
+			}
+			cmd := exec.Command("cloudflared", args...)
+			stderr, err := cmd.StderrPipe()
+			if err == nil {
+				go scanQuickTunnelURL(bufio.NewScanner(stderr), found)
+			}
+			return cmd
+		},
+		publicURL: func(exited <-chan struct{}) string {
+			select {
+			case url := <-found:
+				return url
+			case <-exited:
+				return ""
+			case <-time.After(30 * time.Second):
+				return ""
+			}
+		},
+	})
+}
+
+// scanQuickTunnelURL reports the first quick tunnel URL in cloudflared's
+// log, then keeps reading so the process never blocks on a full pipe
+func scanQuickTunnelURL(scanner *bufio.Scanner, found chan<- string) {
+	reported := false
+	for scanner.Scan() {
+		if reported {
+			continue
+		}
+		if url := quickTunnelURL.FindString(scanner.Text()); url != "" {
+			found <- url
+			reported = true
+		}
+	}
+}
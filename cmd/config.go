@@ -0,0 +1,261 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/pflag"
+)
+
+// configNames are the files looked for in the working directory and then
+// $HOME when --config isn't given
+var configNames = []string{"goshare.yaml", "goshare.yml", "goshare.toml", ".goshare.yaml", ".goshare.yml", ".goshare.toml"}
+
+// envPrefix starts the environment variable for each flag, e.g.
+// GOSHARE_MAX_CONNECTIONS for --max-connections
+const envPrefix = "GOSHARE_"
+
+// configEntry is one setting from a config file: a single value, or a list
+// for repeatable flags like dir
+type configEntry struct {
+	values []string
+	list   bool
+	line   int
+}
+
+// applySettings fills in every flag not given on the command line from its
+// GOSHARE_* environment variable or, failing that, the config file, so
+// flags > env > config file > defaults
+func applySettings(flags *pflag.FlagSet) error {
+	path := configFile
+	if !flags.Changed("config") {
+		path = os.Getenv(envPrefix + "CONFIG")
+	}
+	if path == "" {
+		path = findConfigFile()
+	}
+
+	var entries map[string]configEntry
+	if path != "" {
+		var err error
+		if entries, err = parseConfigFile(path); err != nil {
+			return err
+		}
+		fmt.Printf("⚙️  Using config file %s\n", path)
+		configFile = path // so the server can keep it out of the share
+	}
+
+	for key, entry := range entries {
+		if key == "config" || key == "help" || flags.Lookup(key) == nil {
+			return fmt.Errorf("%s:%d: unknown setting %q", path, entry.line, key)
+		}
+	}
+
+	var err error
+	flags.VisitAll(func(f *pflag.Flag) {
+		if err != nil || f.Changed || f.Name == "config" || f.Name == "help" {
+			return
+		}
+		if v := os.Getenv(envName(f.Name)); v != "" {
+			if setErr := setFromEnv(f, v); setErr != nil {
+				err = fmt.Errorf("%s: %v", envName(f.Name), setErr)
+			}
+			return
+		}
+		if entry, ok := entries[f.Name]; ok {
+			if setErr := setFromConfig(f, entry); setErr != nil {
+				err = fmt.Errorf("%s:%d: %s: %v", path, entry.line, f.Name, setErr)
+			}
+		}
+	})
+	return err
+}
+
+func envName(flag string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(flag, "-", "_"))
+}
+
+// setFromEnv sets f like the command line would, except that a repeatable
+// flag takes a comma-separated list since a variable can't be repeated
+func setFromEnv(f *pflag.Flag, v string) error {
+	slice, ok := f.Value.(pflag.SliceValue)
+	if !ok {
+		return f.Value.Set(v)
+	}
+	values, err := csv.NewReader(strings.NewReader(v)).Read()
+	if err != nil {
+		return err
+	}
+	for i := range values {
+		values[i] = strings.TrimSpace(values[i])
+	}
+	return slice.Replace(values)
+}
+
+// bindEnvHelp names each flag's environment variable in --help
+func bindEnvHelp(flags *pflag.FlagSet) {
+	flags.VisitAll(func(f *pflag.Flag) {
+		if f.Name != "help" {
+			f.Usage += fmt.Sprintf(" [$%s]", envName(f.Name))
+		}
+	})
+}
+
+func setFromConfig(f *pflag.Flag, entry configEntry) error {
+	if slice, ok := f.Value.(pflag.SliceValue); ok && entry.list {
+		return slice.Replace(entry.values)
+	}
+	if entry.list {
+		return fmt.Errorf("takes a single value, not a list")
+	}
+	return f.Value.Set(entry.values[0])
+}
+
+// findConfigFile returns the first config file in the working directory or
+// $HOME, or "" when there is none
+func findConfigFile() string {
+	dirs := []string{"."}
+	if home, err := os.UserHomeDir(); err == nil {
+		dirs = append(dirs, home)
+	}
+	for _, dir := range dirs {
+		for _, name := range configNames {
+			path := filepath.Join(dir, name)
+			if info, err := os.Stat(path); err == nil && !info.IsDir() {
+				return path
+			}
+		}
+	}
+	return ""
+}
+
+// parseConfigFile reads a flat config file: "key: value" lines for YAML,
+// "key = value" for TOML. Keys are flag names (underscores work too), and
+// lists are written [a, b] or, in YAML, as "- item" lines under the key.
+func parseConfigFile(path string) (map[string]configEntry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	sep := ":"
+	if strings.EqualFold(filepath.Ext(path), ".toml") {
+		sep = "="
+	}
+	entries := make(map[string]configEntry)
+	pending := "" // YAML key whose list items follow
+	scanner := bufio.NewScanner(file)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(stripComment(scanner.Text()))
+		if line == "" || line == "---" {
+			continue
+		}
+		fail := func(format string, args ...interface{}) error {
+			return fmt.Errorf("%s:%d: %s", path, n, fmt.Sprintf(format, args...))
+		}
+
+		if sep == ":" && (line == "-" || strings.HasPrefix(line, "- ")) {
+			if pending == "" {
+				return nil, fail("list item without a key")
+			}
+			entry := entries[pending]
+			entry.values = append(entry.values, unquote(strings.TrimSpace(line[1:])))
+			entries[pending] = entry
+			continue
+		}
+		pending = ""
+		if strings.HasPrefix(line, "[") {
+			return nil, fail("sections are not supported; put every setting at the top level")
+		}
+
+		key, value, ok := strings.Cut(line, sep)
+		if !ok {
+			return nil, fail("expected key%svalue", sep)
+		}
+		key = strings.ToLower(strings.ReplaceAll(unquote(strings.TrimSpace(key)), "_", "-"))
+		value = strings.TrimSpace(value)
+		if _, dup := entries[key]; dup {
+			return nil, fail("%q is set twice", key)
+		}
+
+		switch {
+		case value == "" && sep == ":":
+			entries[key] = configEntry{list: true, line: n}
+			pending = key
+		case value == "":
+			return nil, fail("%q has no value", key)
+		case strings.HasPrefix(value, "["):
+			if !strings.HasSuffix(value, "]") {
+				return nil, fail("lists must be on one line")
+			}
+			var values []string
+			for _, item := range splitList(value[1 : len(value)-1]) {
+				values = append(values, unquote(item))
+			}
+			entries[key] = configEntry{values: values, list: true, line: n}
+		default:
+			entries[key] = configEntry{values: []string{unquote(value)}, line: n}
+		}
+	}
+	return entries, scanner.Err()
+}
+
+// stripComment cuts a # comment off line, leaving # inside quotes alone
+func stripComment(line string) string {
+	var quote rune
+	for i, c := range line {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// splitList splits the inside of [a, "b, c"] on commas outside quotes
+func splitList(s string) []string {
+	var items []string
+	var quote rune
+	start := 0
+	for i, c := range s {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == ',':
+			items = append(items, strings.TrimSpace(s[start:i]))
+			start = i + 1
+		}
+	}
+	if last := strings.TrimSpace(s[start:]); last != "" {
+		items = append(items, last)
+	}
+	return items
+}
+
+func unquote(s string) string {
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		if u, err := strconv.Unquote(s); err == nil {
+			return u
+		}
+	}
+	if len(s) >= 2 && s[0] == '\'' && s[len(s)-1] == '\'' {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
@@ -7,39 +7,215 @@ import (
 	"net/http"
 	"os"
 	"os/exec"
+	"os/signal"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/skip2/go-qrcode"
 	"github.com/spf13/cobra"
+	"github.com/sudo-init-do/goshare/frontend"
 	"github.com/sudo-init-do/goshare/internal/server"
 )
 
 var (
-	dir      string
-	port     int
-	password string
-	useNgrok bool
+	dirs         []string
+	port         int
+	password     string
+	accessToken  string
+	useNgrok     bool
+	useTailscale bool
+	useCFTunnel  bool
+	ngrokAPI     string
+	ngrokToken   string
+	ngrokRegion  string
+	listingCache int
+	collapseDirs bool
+	favicon      string
+	trustProxy   bool
+	uploadsTLS   bool
+	authHook     string
+	uploadDir    string
+	uploadPaths  []string
+	onlyExt      []string
+	allowedHosts []string
+	confirmSize  string
+	enablePProf  bool
+	smartArchive bool
+	statsFile    string
+	useTLS       bool
+	certFile     string
+	keyFile      string
+	maxUpload    string
+	readOnly     bool
+	showHidden   bool
+	followLinks  bool
+	zipLevel     string
+	maxConns     int
+	allowCIDRs   []string
+	denyCIDRs    []string
+	corsOrigins  []string
+	expireAfter  time.Duration
+	expireExit   bool
+	useMDNS      bool
+	mdnsName     string
+	bindAddr     string
+	netIface     string
+	pageTitle    string
+	brandName    string
+	logoURL      string
+	tmplFile     string
+	useMetrics   bool
+	useWebDAV    bool
+	auditFile    string
+	dirSizes     bool
+	scanCmd      string
+	maxStorage   string
+	ftpPort      int
+	configFile   string
 )
 
 var rootCmd = &cobra.Command{
 	Use:   "goshare",
 	Short: "Easily share local files over Wi‑Fi",
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true // a bad setting isn't a usage mistake
+		return applySettings(cmd.Flags())
+	},
 	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Printf("Starting goshare on port %d serving directory: %s\n", port, dir)
+		fmt.Printf("Starting goshare on port %d serving directory: %s\n", port, strings.Join(dirs, ", "))
 		if useNgrok {
-			startNgrokTunnel(dir, port, password)
+			startNgrokTunnel(serverConfig())
+			return
+		}
+		if useTailscale {
+			startTailscaleServe(serverConfig())
+			return
+		}
+		if useCFTunnel {
+			startCloudflaredTunnel(serverConfig())
 			return
 		}
-		server.StartServer(dir, port, password)
+		server.StartServer(serverConfig())
 	},
 }
 
+// serverConfig collects the parsed flags into a server.Config
+func serverConfig() server.Config {
+	return server.Config{
+		Dirs:              dirs,
+		Port:              port,
+		Password:          password,
+		AccessToken:       accessToken,
+		ListingCacheSize:  listingCache,
+		CollapseDirs:      collapseDirs,
+		Favicon:           favicon,
+		AuthHook:          authHook,
+		TrustProxy:        trustProxy,
+		UploadsRequireTLS: uploadsTLS,
+		UploadDir:         uploadDir,
+		UploadPaths:       uploadPaths,
+		OnlyExt:           onlyExt,
+		ConfigFile:        configFile,
+		AllowedHosts:      server.NewHostAllowlist(allowedHosts),
+		DownloadConfirm:   confirmSize,
+		PProf:             enablePProf,
+		SmartArchive:      smartArchive,
+		StatsFile:         statsFile,
+		TLS:               useTLS,
+		CertFile:          certFile,
+		KeyFile:           keyFile,
+		MaxUploadSize:     maxUpload,
+		ReadOnly:          readOnly,
+		ShowHidden:        showHidden,
+		FollowSymlinks:    followLinks,
+		AuditLog:          auditFile,
+		DirSizes:          dirSizes,
+		ScanCommand:       scanCmd,
+		MaxStorage:        maxStorage,
+		ZipCompression:    zipLevel,
+		MaxConnections:    maxConns,
+		AllowCIDRs:        allowCIDRs,
+		DenyCIDRs:         denyCIDRs,
+		CORSOrigins:       corsOrigins,
+		Expire:            expireAfter,
+		ExpireExit:        expireExit,
+		MDNS:              useMDNS,
+		MDNSName:          mdnsName,
+		Bind:              bindAddr,
+		Interface:         netIface,
+		Title:             pageTitle,
+		Brand:             brandName,
+		LogoURL:           logoURL,
+		Template:          tmplFile,
+		Metrics:           useMetrics,
+		WebDAV:            useWebDAV,
+		FTPPort:           ftpPort,
+		EmbeddedUI:        frontend.Build(),
+		Version:           buildVersion(),
+	}
+}
+
 func Execute() {
-	rootCmd.PersistentFlags().StringVarP(&dir, "dir", "d", ".", "Directory to share")
+	rootCmd.PersistentFlags().StringVar(&configFile, "config", "", "Config file to read settings from (default: goshare.yaml or .goshare.toml etc. in the working directory, then $HOME)")
+	rootCmd.PersistentFlags().StringArrayVarP(&dirs, "dir", "d", []string{"."}, "Directory to share; repeat as name:path to serve several under /name")
 	rootCmd.PersistentFlags().IntVarP(&port, "port", "p", 8080, "Port to run the server on")
 	rootCmd.PersistentFlags().StringVarP(&password, "password", "", "", "Optional password to protect access (Basic Auth)")
+	rootCmd.PersistentFlags().StringVar(&authHook, "auth-hook", "", "URL or command that validates credentials instead of --password (JSON credentials in, 2xx/exit 0 allows)")
+	rootCmd.PersistentFlags().StringVar(&accessToken, "access-token", "", "Token that logs clients in via ?access_token= (used in the QR code; requires --password)")
+	rootCmd.PersistentFlags().IntVar(&listingCache, "listing-cache", 0, "Cache up to N rendered directory pages (0 disables)")
+	rootCmd.PersistentFlags().BoolVar(&collapseDirs, "collapse-dirs", false, "Show single-child folder chains as one entry (e.g. a/b/c)")
+	rootCmd.PersistentFlags().StringVar(&favicon, "favicon", "", "Image file to use as the browser tab icon")
+	rootCmd.PersistentFlags().BoolVar(&trustProxy, "trust-proxy", false, "Trust X-Forwarded-* headers from a reverse proxy or tunnel")
+	rootCmd.PersistentFlags().BoolVar(&uploadsTLS, "uploads-require-tls", false, "Only accept uploads over HTTPS")
+	rootCmd.PersistentFlags().StringVar(&uploadDir, "upload-dir", "", "Force all uploads into this folder of the share (e.g. /incoming)")
+	rootCmd.PersistentFlags().StringSliceVar(&uploadPaths, "upload-path", nil, "Only accept uploads in these folders of the share (repeatable; .goshare-uploads marker files open more)")
+	rootCmd.PersistentFlags().StringSliceVar(&onlyExt, "only-ext", nil, "Only share files with these extensions, e.g. --only-ext jpg,png (repeatable)")
+	rootCmd.PersistentFlags().StringSliceVar(&allowedHosts, "allowed-hosts", nil, "Only answer requests for these Host names, e.g. files.example.com or *.ngrok-free.app (local IP, localhost and tunnel URLs are added automatically; recommended with tunnels)")
+	rootCmd.PersistentFlags().StringVar(&confirmSize, "download-confirm-threshold", "", "Ask browsers to confirm downloads larger than this size, e.g. 500MB")
+	rootCmd.PersistentFlags().BoolVar(&enablePProf, "pprof", false, "Serve Go profiling data under /debug/pprof/ (logged-in users, or this machine only without --password)")
+	rootCmd.PersistentFlags().BoolVar(&smartArchive, "smart-archive", false, "Folder downloads without ?download=zip|targz get tar.gz on Linux/BSD and zip on Windows, macOS and mobile")
+	rootCmd.PersistentFlags().StringVar(&statsFile, "stats-file", "", "Keep download statistics in this JSON file across restarts")
+	rootCmd.PersistentFlags().BoolVar(&useTLS, "tls", false, "Serve over HTTPS (self-signed certificate unless --cert/--key are given)")
+	rootCmd.PersistentFlags().StringVar(&certFile, "cert", "", "PEM certificate file for HTTPS")
+	rootCmd.PersistentFlags().StringVar(&keyFile, "key", "", "PEM private key file for HTTPS")
+	rootCmd.PersistentFlags().StringVar(&maxUpload, "max-upload-size", "10MB", "Largest file accepted per upload, e.g. 50MB or 1GB")
+	rootCmd.PersistentFlags().BoolVar(&readOnly, "read-only", false, "Refuse uploads and deletes")
+	rootCmd.PersistentFlags().StringVar(&zipLevel, "zip-compression", "", "Zip download compression: store, fast or best (photos, videos and archives are always stored)")
+	rootCmd.PersistentFlags().IntVar(&maxConns, "max-connections", 0, "Answer 503 beyond this many simultaneous archive downloads (and 4x as many other requests); 0 is unlimited")
+	rootCmd.PersistentFlags().StringSliceVar(&allowCIDRs, "allow-cidr", nil, "Only accept clients from these IP ranges, e.g. 192.168.1.0/24 or fd00::/8 (repeatable)")
+	rootCmd.PersistentFlags().StringSliceVar(&denyCIDRs, "deny-cidr", nil, "Refuse clients from these IP ranges, even allowed ones (repeatable)")
+	rootCmd.PersistentFlags().DurationVar(&expireAfter, "expire", 0, "Stop sharing this long after startup, e.g. 30m or 2h; requests then get 410 Gone")
+	rootCmd.PersistentFlags().BoolVar(&expireExit, "expire-exit", false, "Shut the server down when --expire runs out")
+	rootCmd.PersistentFlags().BoolVar(&useMDNS, "mdns", false, "Make the share reachable as <mdns-name>.local on the LAN via multicast DNS")
+	rootCmd.PersistentFlags().StringVar(&mdnsName, "mdns-name", "goshare", "Host name advertised with --mdns, without .local")
+	rootCmd.PersistentFlags().StringVar(&bindAddr, "bind", "", "Listen on and advertise this IP address only (127.0.0.1 is always added for tunnels)")
+	rootCmd.PersistentFlags().StringVar(&netIface, "interface", "", "Listen on and advertise the address of this network interface, e.g. eth0 or en0")
+	rootCmd.PersistentFlags().StringVar(&pageTitle, "title", "", "Heading and tab title of the listing page (default \"GoShare File Browser\")")
+	rootCmd.PersistentFlags().StringVar(&brandName, "brand", "", "Name shown in the page footer and on the login page (default GoShare)")
+	rootCmd.PersistentFlags().StringVar(&logoURL, "logo-url", "", "Image URL, or path on this server, shown in place of the share icon")
+	rootCmd.PersistentFlags().StringVar(&tmplFile, "template", "", "HTML template file to render directory listings with instead of the built-in page (see README for its fields)")
+	rootCmd.PersistentFlags().BoolVar(&useMetrics, "metrics", false, "Serve Prometheus metrics at /metrics (login required with --password)")
+	rootCmd.PersistentFlags().BoolVar(&useWebDAV, "webdav", false, "Also serve the share over WebDAV at /dav/, behind the same password")
+	rootCmd.PersistentFlags().BoolVar(&showHidden, "show-hidden", false, "Share dotfiles and dotfolders too; they are hidden everywhere by default")
+	rootCmd.PersistentFlags().BoolVar(&followLinks, "follow-symlinks", false, "Serve symlinks that point outside the shared folder (by default they are refused)")
+	rootCmd.PersistentFlags().StringVar(&auditFile, "audit-log", "", "Append a JSON line for every upload, delete, rename and new folder to this file")
+	rootCmd.PersistentFlags().BoolVar(&dirSizes, "dir-sizes", false, "Show the total size of each folder in listings (walks every subfolder; cached briefly)")
+	rootCmd.PersistentFlags().StringVar(&scanCmd, "scan-command", "", "Command run with each uploaded file's path before it is stored; a non-zero exit quarantines the file (e.g. \"clamscan --no-summary\")")
+	rootCmd.PersistentFlags().StringVar(&maxStorage, "max-storage", "", "Refuse uploads once the shared folder would hold more than this (e.g. 20GB)")
+	rootCmd.PersistentFlags().StringSliceVar(&corsOrigins, "cors-origin", nil, "Let pages from these origins call the server with credentials, e.g. https://app.example.com (repeatable; default same-origin only)")
+	rootCmd.PersistentFlags().IntVar(&ftpPort, "ftp-port", 0, "Also serve the share read-only over FTP on this port (0 disables)")
 	rootCmd.PersistentFlags().BoolVar(&useNgrok, "ngrok", false, "Expose server to the internet using ngrok")
+	rootCmd.PersistentFlags().StringVar(&ngrokAPI, "ngrok-api", "127.0.0.1:4040", "Address of ngrok's local inspection API, if its web_addr was changed")
+	rootCmd.PersistentFlags().StringVar(&ngrokToken, "ngrok-authtoken", "", "ngrok authtoken to use instead of the one in ngrok's config")
+	rootCmd.PersistentFlags().StringVar(&ngrokRegion, "ngrok-region", "", "ngrok region, e.g. eu or ap")
+	rootCmd.PersistentFlags().BoolVar(&useTailscale, "tailscale", false, "Share over your tailnet with HTTPS using tailscale serve")
+	rootCmd.PersistentFlags().BoolVar(&useCFTunnel, "cloudflared", false, "Expose server to the internet using a Cloudflare quick tunnel")
+	bindEnvHelp(rootCmd.PersistentFlags())
+	rootCmd.AddCommand(urlCmd, versionCmd)
+	rootCmd.Version = versionString()
+	rootCmd.SetVersionTemplate("{{.Version}}\n")
 
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Println(err)
@@ -47,41 +223,75 @@ func Execute() {
 	}
 }
 
-func startNgrokTunnel(dir string, port int, password string) {
-	// Start the local server concurrently (prints local IP + QR)
-	go server.StartServer(dir, port, password)
+func startNgrokTunnel(cfg server.Config) {
+	apiURL := ngrokAPIURL(ngrokAPI)
+	output := &outputTail{}
+	runTunnel(cfg, tunnel{
+		name:      "ngrok",
+		label:     "🌍 Public URL",
+		launching: "📡 Launching ngrok tunnel...",
+		noURL:     "Check " + strings.TrimSuffix(apiURL, "/api/tunnels"),
+		command: func() *exec.Cmd {
+			upstream := fmt.Sprintf("%d", cfg.Port)
+			if cfg.UsesTLS() {
+				upstream = fmt.Sprintf("https://localhost:%d", cfg.Port)
+			}
+			args := []string{"http", upstream}
+			if ngrokToken != "" {
+				args = append(args, "--authtoken", ngrokToken)
+			}
+			if ngrokRegion != "" {
+				args = append(args, "--region", ngrokRegion)
+			}
+			// Keep ngrok's output off the terminal, but at hand in case it
+			// fails to start
+			cmd := exec.Command("ngrok", args...)
+			cmd.Stdout, cmd.Stderr = output, output
+			return cmd
+		},
+		// Poll ngrok's local API for the public URL
+		publicURL: func(exited <-chan struct{}) string {
+			return waitForNgrokURL(apiURL, 30*time.Second, exited) // longer timeout for reliability
+		},
+		output: output.String,
+	})
+}
 
-	fmt.Println("📡 Launching ngrok tunnel...")
+// ngrokAPIURL turns --ngrok-api (host:port or a URL) into the tunnels
+// endpoint of ngrok's inspection API
+func ngrokAPIURL(addr string) string {
+	addr = strings.TrimSuffix(addr, "/")
+	if !strings.Contains(addr, "://") {
+		addr = "http://" + addr
+	}
+	return strings.TrimSuffix(addr, "/api/tunnels") + "/api/tunnels"
+}
 
-	// Run ngrok silently (no logs to stdout/stderr)
-	cmd := exec.Command("ngrok", "http", fmt.Sprintf("%d", port))
+// outputTail keeps the last few KB written to it
+type outputTail struct {
+	mu  sync.Mutex
+	buf []byte
+}
 
-	if err := cmd.Start(); err != nil {
-		fmt.Println("❌ Failed to start ngrok:", err)
-		os.Exit(1)
-	}
+const maxOutputTail = 4 << 10
 
-	// Poll ngrok's local API for the public URL
-	publicURL := waitForNgrokURL(30 * time.Second) // longer timeout for reliability
-	if publicURL == "" {
-		fmt.Println("⚠️  Could not detect ngrok public URL. Check http://127.0.0.1:4040")
-	} else {
-		fmt.Println("\n🌍 Public URL (ngrok):", publicURL)
-		if qr, err := qrcode.New(publicURL, qrcode.Medium); err == nil {
-			fmt.Println("\n📱 Scan this QR (ngrok):")
-			fmt.Println(qr.ToSmallString(false))
-		} else {
-			fmt.Println("⚠️  Could not generate QR for ngrok URL:", err)
-		}
+func (o *outputTail) Write(p []byte) (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.buf = append(o.buf, p...)
+	if len(o.buf) > maxOutputTail {
+		o.buf = o.buf[len(o.buf)-maxOutputTail:]
 	}
+	return len(p), nil
+}
 
-	// Keep ngrok process alive
-	if err := cmd.Wait(); err != nil {
-		fmt.Println("ngrok exited with error:", err)
-	}
+func (o *outputTail) String() string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return string(o.buf)
 }
 
-func waitForNgrokURL(timeout time.Duration) string {
+func waitForNgrokURL(apiURL string, timeout time.Duration, exited <-chan struct{}) string {
 	type tunnel struct {
 		PublicURL string `json:"public_url"`
 	}
@@ -90,8 +300,8 @@ func waitForNgrokURL(timeout time.Duration) string {
 	}
 
 	deadline := time.Now().Add(timeout)
-	for time.Now().Before(deadline) {
-		resp, err := http.Get("http://127.0.0.1:4040/api/tunnels")
+	for time.Now().Before(deadline) && !isClosed(exited) {
+		resp, err := http.Get(apiURL)
 		if err == nil && resp != nil && resp.Body != nil {
 			body, _ := io.ReadAll(resp.Body)
 			_ = resp.Body.Close()
@@ -116,3 +326,130 @@ func waitForNgrokURL(timeout time.Duration) string {
 	}
 	return ""
 }
+
+// runServer starts the server in the background for the tunnel modes and
+// returns a channel closed once it has shut down
+func runServer(cfg server.Config) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		server.StartServer(cfg)
+		close(done)
+	}()
+	return done
+}
+
+// tunnel describes a CLI that exposes the local server somewhere else
+type tunnel struct {
+	name      string // the CLI, for messages
+	label     string // printed before the public URL
+	launching string // printed while the CLI starts
+	noURL     string // hint printed when publicURL comes back empty
+
+	command func() *exec.Cmd // the not yet started CLI process
+	// publicURL waits for the tunnel's URL; "" if it never shows or the CLI
+	// exits first, which closes exited
+	publicURL func(exited <-chan struct{}) string
+	output    func() string // the CLI's last output, shown if it fails; may be nil
+}
+
+// runTunnel starts the local server in the background, launches the tunnel
+// CLI in front of it, prints the public URL once both are up and keeps
+// running until either side exits
+func runTunnel(cfg server.Config, t tunnel) {
+	// Start the local server concurrently (prints local IP + QR)
+	cfg.Ready = make(chan struct{})
+	done := runServer(cfg)
+
+	fmt.Println(t.launching)
+	cmd := t.command()
+	if err := cmd.Start(); err != nil {
+		fmt.Printf("❌ Failed to start %s: %v\n", t.name, err)
+		os.Exit(1)
+	}
+	exited := make(chan struct{})
+	var exitErr error
+	go func() {
+		exitErr = cmd.Wait()
+		close(exited)
+	}()
+
+	// Don't hand out a public URL until the local server is accepting
+	waitForServer(cfg.Ready)
+
+	if publicURL := t.publicURL(exited); publicURL != "" {
+		cfg.AllowedHosts.Add(publicURL)
+		printTunnelURL(t.name, t.label, publicURL)
+	} else if !isClosed(exited) {
+		fmt.Printf("⚠️  Could not detect the %s public URL. %s\n", t.name, t.noURL)
+	}
+
+	// Keep the tunnel process alive; a tunnel that dies on its own (bad
+	// credentials, say) takes the share down with it and says why
+	if waitForTunnel(cmd, exited, done) {
+		fmt.Printf("❌ %s exited: %v\n", t.name, exitErr)
+		if t.output != nil {
+			if out := strings.TrimSpace(t.output()); out != "" {
+				fmt.Println(out)
+			}
+		}
+	}
+}
+
+func isClosed(ch <-chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
+
+// waitForTunnel waits for the tunnel process to exit, reporting whether it
+// did so on its own. The server handles Ctrl+C and SIGTERM itself: once it
+// has shut down the tunnel is stopped too, and when the signal also reached
+// the tunnel we wait for the server's graceful shutdown instead of cutting
+// off transfers in progress.
+func waitForTunnel(cmd *exec.Cmd, exited, done <-chan struct{}) bool {
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(stop)
+	go func() {
+		<-done
+		if cmd.Process.Signal(os.Interrupt) != nil {
+			cmd.Process.Kill() // Windows can't deliver interrupts
+		}
+	}()
+
+	<-exited
+	select {
+	case <-stop:
+		<-done
+		return false
+	case <-done:
+		return false
+	default:
+		return true
+	}
+}
+
+// waitForServer blocks until StartServer closes ready, exiting if the
+// server never comes up
+func waitForServer(ready <-chan struct{}) {
+	select {
+	case <-ready:
+	case <-time.After(15 * time.Second):
+		fmt.Println("❌ Local server did not start in time")
+		os.Exit(1)
+	}
+}
+
+// printTunnelURL prints a tunnel's URL followed by a terminal QR code for it
+func printTunnelURL(name, label, url string) {
+	fmt.Printf("\n%s (%s): %s\n", label, name, url)
+	if qr, err := qrcode.New(url, qrcode.Medium); err == nil {
+		fmt.Printf("\n📱 Scan this QR (%s):\n", name)
+		fmt.Println(qr.ToSmallString(false))
+	} else {
+		fmt.Printf("⚠️  Could not generate QR for %s URL: %v\n", name, err)
+	}
+}
@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/sudo-init-do/goshare/internal/server"
+)
+
+// tailscaleStatus is the subset of `tailscale status --json` we care about
+type tailscaleStatus struct {
+	BackendState string `json:"BackendState"`
+	Self         struct {
+		DNSName string `json:"DNSName"`
+	} `json:"Self"`
+}
+
+// startTailscaleServe publishes the share on the tailnet through the
+// system's tailscaled: `tailscale serve` adds an HTTPS endpoint on this node
+// for as long as goshare runs. The server itself only listens on 127.0.0.1
+// so the tailnet-only share isn't reachable on the LAN as well.
+func startTailscaleServe(cfg server.Config) {
+	if cfg.Bind != "" || cfg.Interface != "" {
+		fmt.Println("❌ --tailscale listens on 127.0.0.1 only, so it can't be combined with --bind or --interface")
+		os.Exit(1)
+	}
+	cfg.Bind = "127.0.0.1"
+
+	// Make sure the node is logged in before exposing anything
+	hostname, err := tailnetHostname()
+	if err != nil {
+		fmt.Println("❌ Tailscale is not ready:", err)
+		fmt.Println("   Install Tailscale and run `tailscale up` to join your tailnet first.")
+		os.Exit(1)
+	}
+
+	cfg.AllowedHosts.Add(hostname)
+	runTunnel(cfg, tunnel{
+		name:      "tailscale",
+		label:     "🔐 Tailnet URL",
+		launching: "🔐 Publishing on your tailnet with tailscale serve...",
+		// tailscale serve terminates HTTPS with the node's Tailscale cert and
+		// proxies to the local server for as long as it runs in the foreground
+		command: func() *exec.Cmd {
+			upstream := fmt.Sprintf("http://127.0.0.1:%d", cfg.Port)
+			if cfg.UsesTLS() {
+				// Our certificate is likely self-signed, and the hop is local anyway
+				upstream = fmt.Sprintf("https+insecure://127.0.0.1:%d", cfg.Port)
+			}
+			cmd := exec.Command("tailscale", "serve", "--https=443", upstream)
+			cmd.Stderr = os.Stderr
+			return cmd
+		},
+		publicURL: func(<-chan struct{}) string { return "https://" + hostname },
+	})
+}
+
+// tailnetHostname returns this node's MagicDNS name, or an error if the
+// tailscale CLI is missing or the node isn't authenticated
+func tailnetHostname() (string, error) {
+	out, err := exec.Command("tailscale", "status", "--json").Output()
+	if err != nil {
+		return "", fmt.Errorf("could not query tailscale status: %w", err)
+	}
+
+	var st tailscaleStatus
+	if err := json.Unmarshal(out, &st); err != nil {
+		return "", fmt.Errorf("could not parse tailscale status: %w", err)
+	}
+	if st.BackendState != "Running" {
+		return "", fmt.Errorf("tailscale state is %q (not logged in?)", st.BackendState)
+	}
+
+	hostname := strings.TrimSuffix(st.Self.DNSName, ".")
+	if hostname == "" {
+		return "", fmt.Errorf("MagicDNS name not available; enable MagicDNS and HTTPS certificates in the admin console")
+	}
+	return hostname, nil
+}
@@ -0,0 +1,39 @@
+package cmd
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+
+	"github.com/skip2/go-qrcode"
+	"github.com/spf13/cobra"
+)
+
+// urlCmd prints the address goshare would be reachable at, so it can be
+// shown to someone before deciding to actually share anything
+var urlCmd = &cobra.Command{
+	Use:   "url",
+	Short: "Print the share URL and QR code without starting the server",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg := serverConfig()
+		address, err := cfg.URL()
+		if err != nil {
+			fmt.Printf("❌ %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("🌐 %s\n", address)
+
+		// Same QR as at startup, access token included
+		qrURL := address
+		if accessToken != "" && (password != "" || authHook != "") {
+			qrURL = address + "/?access_token=" + url.QueryEscape(accessToken)
+		}
+		qr, err := qrcode.New(qrURL, qrcode.Medium)
+		if err != nil {
+			fmt.Printf("⚠️  Could not generate QR: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(qr.ToSmallString(false))
+	},
+}
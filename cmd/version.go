@@ -0,0 +1,44 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/sudo-init-do/goshare/internal/server"
+)
+
+// Stamped by release builds, e.g.
+//
+//	go build -ldflags "-X github.com/sudo-init-do/goshare/cmd.version=v1.2.0 -X github.com/sudo-init-do/goshare/cmd.commit=$(git rev-parse HEAD) -X github.com/sudo-init-do/goshare/cmd.date=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+//
+// Left empty they are filled in from the VCS data go build records.
+var (
+	version string
+	commit  string
+	date    string
+)
+
+func buildVersion() server.VersionInfo {
+	return server.CompleteVersionInfo(server.VersionInfo{Version: version, Commit: commit, Date: date})
+}
+
+func versionString() string {
+	v := buildVersion()
+	return fmt.Sprintf("goshare %s (commit %s, built %s, %s)", v.Version, orUnknown(v.Commit), orUnknown(v.Date), v.GoVersion)
+}
+
+func orUnknown(s string) string {
+	if s == "" {
+		return "unknown"
+	}
+	return s
+}
+
+var versionCmd = &cobra.Command{
+	Use:   "version",
+	Short: "Print the goshare version, commit and build date",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		fmt.Println(versionString())
+	},
+}
@@ -0,0 +1,22 @@
+//go:build embedui
+
+// Package frontend exposes the React build compiled into the binary.
+// Run `npm run build` first, then build with `-tags embedui`.
+package frontend
+
+import (
+	"embed"
+	"io/fs"
+)
+
+//go:embed all:build
+var build embed.FS
+
+// Build returns the embedded React build rooted at its index.html
+func Build() fs.FS {
+	sub, err := fs.Sub(build, "build")
+	if err != nil {
+		return nil
+	}
+	return sub
+}
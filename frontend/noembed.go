@@ -0,0 +1,12 @@
+//go:build !embedui
+
+// Package frontend exposes the React build compiled into the binary.
+// Run `npm run build` first, then build with `-tags embedui`.
+package frontend
+
+import "io/fs"
+
+// Build returns nil because this binary was built without the embedui tag
+func Build() fs.FS {
+	return nil
+}
@@ -39,6 +39,30 @@ export const FileBrowser: React.FC<FileBrowserProps> = ({ onLogout }) => {
     localStorage.setItem('theme', darkMode ? 'dark' : 'light');
   }, [darkMode]);
 
+  // Re-fetch the folder when files in it change, from here or elsewhere
+  const currentPath = pageData?.currentPath;
+  useEffect(() => {
+    if (currentPath === undefined) return;
+    const ws = new WebSocket(fileService.getLiveUpdatesUrl(currentPath));
+    let timer: ReturnType<typeof setTimeout> | undefined;
+    ws.onmessage = (event) => {
+      const { type } = JSON.parse(event.data);
+      if (type !== 'create' && type !== 'delete' && type !== 'modify') return;
+      clearTimeout(timer);
+      timer = setTimeout(async () => {
+        try {
+          setPageData(await fileService.getFiles(currentPath));
+        } catch {
+          // keep showing the last listing
+        }
+      }, 300);
+    };
+    return () => {
+      clearTimeout(timer);
+      ws.close();
+    };
+  }, [currentPath]);
+
   const loadFiles = async (path: string = '/') => {
     try {
       setLoading(true);
@@ -62,7 +86,9 @@ export const FileBrowser: React.FC<FileBrowserProps> = ({ onLogout }) => {
           fileService.uploadFiles(fileList, pageData.currentPath),
           {
             loading: 'Uploading files...',
-            success: 'Files uploaded successfully!',
+            success: (result) => result.failed.length
+              ? `Uploaded ${result.uploaded}, failed: ${result.failed.map(f => `${f.name} (${f.error})`).join(', ')}`
+              : 'Files uploaded successfully!',
             error: 'Upload failed'
           }
         );
@@ -94,6 +120,14 @@ export const FileBrowser: React.FC<FileBrowserProps> = ({ onLogout }) => {
       case 'jpeg':
       case 'png':
       case 'gif':
+        return (
+          <img
+            src={fileService.getThumbnailUrl(file.path, 48)}
+            alt=""
+            loading="lazy"
+            className="h-6 w-6 rounded object-cover"
+          />
+        );
       case 'webp':
         return <DocumentIcon className={`${iconClass} text-green-500`} />;
       case 'pdf':
@@ -162,7 +196,10 @@ export const FileBrowser: React.FC<FileBrowserProps> = ({ onLogout }) => {
                 animate={{ opacity: 1, x: 0 }}
                 className="text-3xl font-bold text-gray-900 dark:text-white"
               >
-                🗂️ GoShare File Browser
+                {pageData?.logoURL ? (
+                  <img src={pageData.logoURL} alt="" className="inline h-9 mr-3 align-middle" />
+                ) : '🗂️ '}
+                {pageData?.heading || 'GoShare File Browser'}
               </motion.h1>
               
               <div className="flex items-center space-x-3">
@@ -302,7 +339,7 @@ export const FileBrowser: React.FC<FileBrowserProps> = ({ onLogout }) => {
                         </div>
                       </td>
                       <td className="px-6 py-4 text-sm text-gray-500 dark:text-gray-400">
-                        {file.isDir ? '-' : formatFileSize(file.size)}
+                        {file.isDir ? (file.dirSize !== undefined ? formatFileSize(file.dirSize) : '-') : formatFileSize(file.size)}
                       </td>
                       <td className="px-6 py-4 text-sm text-gray-500 dark:text-gray-400">
                         {formatDate(file.modTime)}
@@ -344,7 +381,7 @@ export const FileBrowser: React.FC<FileBrowserProps> = ({ onLogout }) => {
 
           {/* Footer */}
           <footer className="mt-8 text-center text-gray-500 dark:text-gray-400 text-sm">
-            <p>Powered by <strong>GoShare</strong> - Modern file sharing</p>
+            <p>Powered by <strong>{pageData?.brand || 'GoShare'}</strong> - Modern file sharing</p>
           </footer>
         </div>
       </div>
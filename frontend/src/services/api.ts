@@ -1,5 +1,5 @@
 import axios from 'axios';
-import { PageData } from '../types';
+import { APIError, FileStat, PageData, UploadResult } from '../types';
 
 // Use relative URLs when running in development (proxy will handle routing)
 // Use full URL in production
@@ -10,6 +10,18 @@ const api = axios.create({
   withCredentials: true,
 });
 
+// Every API error comes as {"error": {"code", "message"}}; surface the
+// server's message and keep the whole error for callers that branch on
+// its code
+api.interceptors.response.use(undefined, error => {
+  const apiError: APIError | undefined = error.response?.data?.error;
+  if (apiError && typeof apiError.message === 'string') {
+    error.message = apiError.message;
+    error.apiError = apiError;
+  }
+  return Promise.reject(error);
+});
+
 export const authService = {
   async login(password: string): Promise<boolean> {
     try {
@@ -34,8 +46,8 @@ export const authService = {
 
   async checkAuth(): Promise<boolean> {
     try {
-      const response = await api.get('/api/auth/check');
-      return response.status === 200;
+      const response = await api.get<{ authenticated: boolean }>('/api/auth/check');
+      return response.data.authenticated === true;
     } catch (error) {
       return false;
     }
@@ -43,7 +55,7 @@ export const authService = {
 
   async logout(): Promise<void> {
     try {
-      await api.post('/logout');
+      await api.post('/api/auth/logout');
     } catch (error) {
       console.error('Logout error:', error);
     }
@@ -58,11 +70,18 @@ export const fileService = {
       });
       return response.data;
     } catch (error) {
-      throw new Error('Failed to fetch files');
+      throw new Error(error instanceof Error ? error.message : 'Failed to fetch files');
     }
   },
 
-  async uploadFiles(files: FileList, directory: string = '/'): Promise<void> {
+  async statFile(path: string): Promise<FileStat> {
+    const response = await api.get('/api/stat', {
+      params: { path }
+    });
+    return response.data;
+  },
+
+  async uploadFiles(files: FileList, directory: string = '/'): Promise<UploadResult> {
     const formData = new FormData();
     formData.append('directory', directory);
     
@@ -70,11 +89,12 @@ export const fileService = {
       formData.append('files', files[i]);
     }
 
-    await api.post('/upload', formData, {
+    const response = await api.post('/api/upload', formData, {
       headers: {
         'Content-Type': 'multipart/form-data',
       },
     });
+    return response.data;
   },
 
   getDownloadUrl(path: string): string {
@@ -83,6 +103,19 @@ export const fileService = {
 
   getPreviewUrl(path: string): string {
     return `${API_BASE}${path}`;
+  },
+
+  getThumbnailUrl(path: string, size = 200): string {
+    return `${API_BASE}/api/thumbnail?${new URLSearchParams({ path, size: String(size) })}`;
+  },
+
+  getQRCodeUrl(size = 256, format: 'png' | 'svg' = 'png'): string {
+    return `${API_BASE}/api/qr?${new URLSearchParams({ size: String(size), format })}`;
+  },
+
+  getLiveUpdatesUrl(path: string): string {
+    const base = API_BASE || window.location.origin;
+    return `${base.replace(/^http/, 'ws')}/api/ws?${new URLSearchParams({ path })}`;
   }
 };
 
@@ -5,6 +5,13 @@ export interface FileItem {
   isDir: boolean;
   modTime: string;
   downloadCount: number;
+  dirSize?: number;
+}
+
+export interface FileStat extends FileItem {
+  contentType?: string;
+  entries?: number;
+  checksums?: Record<string, string>;
 }
 
 export interface PageData {
@@ -14,6 +21,22 @@ export interface PageData {
   hasParent: boolean;
   files: FileItem[];
   serverURL: string;
+  heading: string;
+  brand: string;
+  logoURL?: string;
+}
+
+export interface APIError {
+  code: string;
+  message: string;
+}
+
+export interface UploadResult {
+  uploaded: number;
+  files: { name: string; storedAs: string }[];
+  failed: { name: string; error: string }[];
+  skipped: number;
+  error?: APIError;
 }
 
 export interface AuthState {
@@ -3,11 +3,18 @@ module github.com/sudo-init-do/goshare
 go 1.20
 
 require (
+	github.com/alecthomas/chroma/v2 v2.14.0
+	github.com/fsnotify/fsnotify v1.7.0
 	github.com/skip2/go-qrcode v0.0.0-20200617195104-da1b6568686e
 	github.com/spf13/cobra v1.9.1
+	github.com/spf13/pflag v1.0.7
+	golang.org/x/crypto v0.31.0
+	golang.org/x/image v0.20.0
+	golang.org/x/net v0.21.0
 )
 
 require (
+	github.com/dlclark/regexp2 v1.11.0 // indirect
 	github.com/inconshreveable/mousetrap v1.1.0 // indirect
-	github.com/spf13/pflag v1.0.7 // indirect
+	golang.org/x/sys v0.28.0 // indirect
 )
@@ -0,0 +1,222 @@
+package server
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/flate"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// pickArchiveFormat chooses between "zip" and "targz" for a directory
+// download that didn't name a format. Without --smart-archive it is always
+// zip; with it, Linux/BSD browsers and command-line tools get tar.gz while
+// Windows, macOS and mobile keep zip, which they open natively.
+func (fh *FileHandler) pickArchiveFormat(r *http.Request) string {
+	if !fh.smartArchive {
+		return "zip"
+	}
+	// Client hints are more reliable than the User-Agent when present
+	if platform := strings.Trim(r.Header.Get("Sec-CH-UA-Platform"), `"`); platform != "" {
+		switch strings.ToLower(platform) {
+		case "linux", "chrome os", "chromium os":
+			return "targz"
+		}
+		return "zip"
+	}
+
+	ua := strings.ToLower(r.UserAgent())
+	switch {
+	case strings.Contains(ua, "android"), strings.Contains(ua, "windows"),
+		strings.Contains(ua, "mac os"), strings.Contains(ua, "iphone"), strings.Contains(ua, "ipad"):
+		return "zip"
+	case strings.Contains(ua, "linux"), strings.Contains(ua, "bsd"), strings.Contains(ua, "x11"),
+		strings.HasPrefix(ua, "curl/"), strings.HasPrefix(ua, "wget/"):
+		return "targz"
+	}
+	return "zip"
+}
+
+// serveDirectoryAsTarGz streams a directory as a gzip-compressed tarball.
+// Like the zip download, files that can't be read are skipped and listed in
+// an errors manifest at the end.
+func (fh *FileHandler) serveDirectoryAsTarGz(w http.ResponseWriter, r *http.Request, fsPath, dirName string) {
+	glob, ok := archiveGlob(w, r)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", dirName+".tar.gz"))
+	w.Header().Set("Accept-Ranges", "none") // generated on the fly, always sent whole
+	rec := &statusRecorder{ResponseWriter: w}
+	defer fh.metrics.archiveServed(rec)
+
+	gz := gzip.NewWriter(rec)
+	defer gz.Close()
+	tw := tar.NewWriter(gz)
+	defer tw.Close()
+
+	var failures []string
+	err := fh.walkArchive(r, fsPath, "", glob, &failures, func(path, name string, info os.FileInfo) error {
+		if info.IsDir() {
+			hdr, err := tar.FileInfoHeader(info, "")
+			if err != nil {
+				return err
+			}
+			hdr.Name = name + "/"
+			return tw.WriteHeader(hdr)
+		}
+
+		// Open first so unreadable files don't leave a header behind, and
+		// follow symlinks to regular files like the zip download does
+		file, err := os.Open(path)
+		if err != nil {
+			failures = append(failures, zipFailure(name, err))
+			return nil
+		}
+		defer file.Close()
+		target, err := file.Stat()
+		if err != nil {
+			failures = append(failures, zipFailure(name, err))
+			return nil
+		}
+		if !target.Mode().IsRegular() {
+			return nil
+		}
+
+		hdr, err := tar.FileInfoHeader(target, "")
+		if err != nil {
+			return err
+		}
+		hdr.Name = name
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		// The header promised Size bytes, so a short copy corrupts the
+		// rest of the stream; give up rather than carry on
+		_, err = io.CopyN(tw, file, hdr.Size)
+		return err
+	})
+	if err != nil {
+		log.Printf("Error creating tar.gz: %v", err)
+		return
+	}
+
+	if len(failures) > 0 {
+		log.Printf("Tarball of %s is missing %d file(s)", fsPath, len(failures))
+		var manifest strings.Builder
+		fmt.Fprintf(&manifest, "This archive is incomplete. The following %d item(s) could not be added:\n\n", len(failures))
+		for _, failure := range failures {
+			fmt.Fprintf(&manifest, "%s\n", failure)
+		}
+		hdr := &tar.Header{Name: zipErrorsFile, Mode: 0644, Size: int64(manifest.Len()), Typeflag: tar.TypeReg}
+		if err := tw.WriteHeader(hdr); err == nil {
+			io.WriteString(tw, manifest.String())
+		}
+	}
+}
+
+// zipLevels maps --zip-compression to a deflate level. Store mode doesn't
+// deflate at all.
+var zipLevels = map[string]int{
+	"":      flate.DefaultCompression,
+	"store": flate.NoCompression,
+	"fast":  flate.BestSpeed,
+	"best":  flate.BestCompression,
+}
+
+// zipStoredExts are formats that are compressed already; deflating them
+// again costs CPU for next to no gain, so they are always stored
+var zipStoredExts = map[string]bool{
+	".jpg": true, ".jpeg": true, ".png": true, ".gif": true, ".webp": true, ".heic": true, ".avif": true,
+	".mp4": true, ".mov": true, ".mkv": true, ".webm": true, ".avi": true, ".m4v": true,
+	".mp3": true, ".aac": true, ".m4a": true, ".ogg": true, ".opus": true, ".flac": true,
+	".zip": true, ".gz": true, ".tgz": true, ".bz2": true, ".xz": true, ".zst": true, ".7z": true, ".rar": true,
+	".docx": true, ".xlsx": true, ".pptx": true, ".odt": true, ".epub": true, ".jar": true, ".apk": true,
+}
+
+// newZipWriter returns a zip writer deflating at the --zip-compression level
+func (fh *FileHandler) newZipWriter(w io.Writer) *zip.Writer {
+	zipWriter := zip.NewWriter(w)
+	if fh.zipMode == "fast" || fh.zipMode == "best" {
+		level := zipLevels[fh.zipMode]
+		zipWriter.RegisterCompressor(zip.Deflate, func(out io.Writer) (io.WriteCloser, error) {
+			return flate.NewWriter(out, level)
+		})
+	}
+	return zipWriter
+}
+
+// zipMethod picks how a file is put into a zip
+func (fh *FileHandler) zipMethod(name string) uint16 {
+	if fh.zipMode == "store" || zipStoredExts[strings.ToLower(filepath.Ext(name))] {
+		return zip.Store
+	}
+	return zip.Deflate
+}
+
+// archiveGlob returns the ?glob= pattern limiting a folder download, or
+// answers 400 and returns false when it is malformed
+func archiveGlob(w http.ResponseWriter, r *http.Request) (string, bool) {
+	glob := r.URL.Query().Get("glob")
+	if _, err := filepath.Match(glob, ""); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid glob pattern %q", glob), http.StatusBadRequest)
+		return "", false
+	}
+	return glob, true
+}
+
+// walkArchive walks fsPath for the archive writers, calling add with each
+// directory and shown file and its slash-separated name in the archive
+// (below prefix when it isn't empty). A non-empty glob keeps only the files
+// whose base name matches it, in any subfolder, and leaves out the folder
+// entries. Unreadable entries are recorded in failures and skipped; an
+// error from add or a departed client stops the walk.
+func (fh *FileHandler) walkArchive(r *http.Request, fsPath, prefix, glob string, failures *[]string, add func(path, name string, info os.FileInfo) error) error {
+	return filepath.Walk(fsPath, func(path string, info os.FileInfo, err error) error {
+		// Stop if the client went away; nothing more can be delivered
+		if ctxErr := r.Context().Err(); ctxErr != nil {
+			return ctxErr
+		}
+		relPath, relErr := filepath.Rel(fsPath, path)
+		if relErr != nil {
+			return relErr
+		}
+		name := filepath.ToSlash(filepath.Join(prefix, relPath))
+
+		if err != nil {
+			*failures = append(*failures, zipFailure(name, err))
+			if info != nil && info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		// The directory being archived only gets an entry of its own when
+		// it is a named folder within the archive
+		if path == fsPath && info.IsDir() && prefix == "" {
+			return nil
+		}
+		if path != fsPath && (fh.hidden(info.Name()) || !fh.allowsLink(path, info.Mode())) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.IsDir() && !fh.showsFile(info.Name()) {
+			return nil
+		}
+		if glob != "" {
+			if matched, _ := filepath.Match(glob, info.Name()); info.IsDir() || !matched {
+				return nil
+			}
+		}
+		return add(path, name, info)
+	})
+}
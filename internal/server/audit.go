@@ -0,0 +1,96 @@
+package server
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// auditLog appends one JSON line per change to the share (uploads, deletes,
+// renames, new folders) to the --audit-log file. Unlike the request log it
+// only holds what changed and who changed it, and it survives a restart.
+type auditLog struct {
+	mu sync.Mutex
+	f  *os.File
+}
+
+// auditEntry is one line of the audit log
+type auditEntry struct {
+	Time   time.Time `json:"time"`
+	IP     string    `json:"ip"`
+	User   string    `json:"user,omitempty"` // the basic auth user name, when one was sent
+	Via    string    `json:"via"`            // "http" or "webdav"
+	Action string    `json:"action"`         // upload, delete, rename, copy or mkdir
+	Path   string    `json:"path"`
+	To     string    `json:"to,omitempty"` // the new path of a rename or copy
+	Size   int64     `json:"size,omitempty"`
+}
+
+// openAuditLog opens the audit file for appending; an empty path disables
+// the audit log
+func openAuditLog(path string) (*auditLog, error) {
+	if path == "" {
+		return nil, nil
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &auditLog{f: f}, nil
+}
+
+// add writes entry as one line. Lines are written whole under the lock, so
+// concurrent requests never interleave.
+func (a *auditLog) add(entry auditEntry) {
+	if a == nil {
+		return
+	}
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.f == nil {
+		return
+	}
+	if _, err := a.f.Write(append(line, '\n')); err != nil {
+		log.Printf("Could not write to the audit log: %v", err)
+	}
+}
+
+// close flushes the file to disk; later entries are dropped
+func (a *auditLog) close() {
+	if a == nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.f != nil {
+		a.f.Sync()
+		a.f.Close()
+		a.f = nil
+	}
+}
+
+// audit records a successful change made by r. to is the destination of a
+// rename or copy and size the bytes an upload stored; both may be zero.
+func (fh *FileHandler) audit(r *http.Request, via, action, path, to string, size int64) {
+	if fh.auditLog == nil {
+		return
+	}
+	user, _, _ := r.BasicAuth()
+	fh.auditLog.add(auditEntry{
+		Time:   time.Now().UTC(),
+		IP:     fh.clientIP(r),
+		User:   user,
+		Via:    via,
+		Action: action,
+		Path:   path,
+		To:     to,
+		Size:   size,
+	})
+}
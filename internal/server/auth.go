@@ -0,0 +1,248 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// sessionTTL is how long a login (cookie or cached hook approval) lasts
+const sessionTTL = 24 * time.Hour
+
+// authHookTimeout bounds how long we wait on an external auth hook
+const authHookTimeout = 5 * time.Second
+
+// passwordChecker decides whether submitted credentials grant access
+type passwordChecker interface {
+	Check(username, password string) bool
+}
+
+// staticPassword accepts the single password given with --password
+type staticPassword string
+
+func (p staticPassword) Check(_, password string) bool {
+	return subtle.ConstantTimeCompare([]byte(password), []byte(p)) == 1
+}
+
+// authHook delegates the decision to an external URL or command. The
+// credentials are sent as JSON ({"username":..,"password":..}) in the POST
+// body or on the command's stdin; a 2xx response or exit status 0 allows
+// access. Any error denies it.
+type authHook struct {
+	target string
+	client *http.Client
+
+	mu       sync.Mutex
+	approved map[[sha256.Size]byte]time.Time // credential hash -> expiry
+}
+
+func newAuthHook(target string) *authHook {
+	return &authHook{
+		target:   target,
+		client:   &http.Client{Timeout: authHookTimeout},
+		approved: make(map[[sha256.Size]byte]time.Time),
+	}
+}
+
+func (h *authHook) Check(username, password string) bool {
+	key := sha256.Sum256([]byte(username + "\x00" + password))
+
+	h.mu.Lock()
+	expiry, ok := h.approved[key]
+	h.mu.Unlock()
+	if ok && time.Now().Before(expiry) {
+		return true
+	}
+
+	body, _ := json.Marshal(map[string]string{"username": username, "password": password})
+	allowed, err := h.ask(body)
+	if err != nil {
+		// Never log the credentials themselves
+		log.Printf("Auth hook failed, denying access: %v", err)
+		return false
+	}
+
+	h.mu.Lock()
+	if allowed {
+		h.approved[key] = time.Now().Add(sessionTTL)
+	} else {
+		delete(h.approved, key)
+	}
+	h.mu.Unlock()
+	return allowed
+}
+
+func (h *authHook) ask(body []byte) (bool, error) {
+	if strings.HasPrefix(h.target, "http://") || strings.HasPrefix(h.target, "https://") {
+		resp, err := h.client.Post(h.target, "application/json", bytes.NewReader(body))
+		if err != nil {
+			return false, err
+		}
+		resp.Body.Close()
+		return resp.StatusCode >= 200 && resp.StatusCode < 300, nil
+	}
+
+	args := strings.Fields(h.target)
+	if len(args) == 0 {
+		return false, fmt.Errorf("empty auth hook command")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), authHookTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stdin = bytes.NewReader(body)
+	err := cmd.Run()
+	if err == nil {
+		return true, nil
+	}
+	if _, ok := err.(*exec.ExitError); ok && ctx.Err() == nil {
+		return false, nil // ran fine and said no
+	}
+	return false, err
+}
+
+// Failed logins from one client are limited so a password can't be brute
+// forced through a public tunnel
+const (
+	maxLoginFailures   = 5
+	loginFailureWindow = time.Minute
+	loginLockout       = 5 * time.Minute
+)
+
+// loginLimiter tracks recent failed logins per client IP and locks a client
+// out once it has too many
+type loginLimiter struct {
+	clientIP func(*http.Request) string
+
+	mu      sync.Mutex
+	clients map[string]*loginFailures
+}
+
+type loginFailures struct {
+	times       []time.Time // failures within loginFailureWindow
+	lockedUntil time.Time
+}
+
+func newLoginLimiter(clientIP func(*http.Request) string) *loginLimiter {
+	return &loginLimiter{clientIP: clientIP, clients: make(map[string]*loginFailures)}
+}
+
+// lockedOut returns how long r's client must still wait before its next
+// login is checked, or 0
+func (l *loginLimiter) lockedOut(r *http.Request) time.Duration {
+	return l.lockedOutIP(l.clientIP(r))
+}
+
+// lockedOutIP is lockedOut for a client known by its IP, such as an FTP
+// control connection
+func (l *loginLimiter) lockedOutIP(ip string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if c, ok := l.clients[ip]; ok {
+		if wait := time.Until(c.lockedUntil); wait > 0 {
+			return wait
+		}
+	}
+	return 0
+}
+
+// allow answers 429 and returns false while r's client is locked out
+func (l *loginLimiter) allow(w http.ResponseWriter, r *http.Request) bool {
+	wait := l.lockedOut(r)
+	if wait == 0 {
+		return true
+	}
+	seconds := int(wait.Round(time.Second) / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set("Retry-After", fmt.Sprint(seconds))
+	requestError(w, r, fmt.Sprintf("Too many failed logins, try again in %d seconds", seconds), http.StatusTooManyRequests)
+	return false
+}
+
+// record counts the outcome of a credential check from r's client. A
+// success forgets earlier failures.
+func (l *loginLimiter) record(r *http.Request, ok bool) {
+	l.recordIP(l.clientIP(r), ok)
+}
+
+// recordIP is record for a client known by its IP
+func (l *loginLimiter) recordIP(ip string, ok bool) {
+	now := time.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if ok {
+		delete(l.clients, ip)
+		return
+	}
+
+	// Drop clients that have gone quiet so the map can't grow forever
+	for other, c := range l.clients {
+		if now.After(c.lockedUntil) && (len(c.times) == 0 || now.Sub(c.times[len(c.times)-1]) > loginFailureWindow) {
+			delete(l.clients, other)
+		}
+	}
+
+	c, exists := l.clients[ip]
+	if !exists {
+		c = &loginFailures{}
+		l.clients[ip] = c
+	}
+	recent := c.times[:0]
+	for _, t := range c.times {
+		if now.Sub(t) <= loginFailureWindow {
+			recent = append(recent, t)
+		}
+	}
+	c.times = append(recent, now)
+	if len(c.times) >= maxLoginFailures {
+		c.lockedUntil = now.Add(loginLockout)
+		c.times = nil
+		log.Printf("Locked out %s for %s after %d failed logins", ip, loginLockout, maxLoginFailures)
+	}
+}
+
+// isAdminRequest gates the operator endpoints (logs, profiling). There are
+// no roles yet, so it allows any logged-in user on a protected share and
+// only this machine on an open one.
+func (fh *FileHandler) isAdminRequest(r *http.Request) bool {
+	if fh.auth == nil {
+		return isLoopbackRequest(r)
+	}
+	return fh.isAuthenticated(r)
+}
+
+// adminOnly wraps next so only admin requests reach it
+func (fh *FileHandler) adminOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !fh.isAdminRequest(r) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// newPasswordChecker picks the auth backend for the given flags; nil means
+// the share is open to everyone
+func newPasswordChecker(password, hook string) passwordChecker {
+	switch {
+	case hook != "":
+		return newAuthHook(hook)
+	case password != "":
+		return staticPassword(password)
+	default:
+		return nil
+	}
+}
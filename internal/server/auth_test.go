@@ -0,0 +1,65 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// loginAttempt posts password to /login from the client at ip
+func loginAttempt(h http.Handler, ip, password string) *httptest.ResponseRecorder {
+	form := url.Values{"password": {password}}
+	req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.RemoteAddr = ip + ":40000"
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestLoginLockout(t *testing.T) {
+	fh := newTestHandler(t, "hunter2")
+	h := protectedHandler(fh)
+
+	for i := 0; i < maxLoginFailures; i++ {
+		if rec := loginAttempt(h, "203.0.113.5", "guess"); rec.Code == http.StatusTooManyRequests {
+			t.Fatalf("attempt %d was already refused", i+1)
+		}
+	}
+
+	// Locked out now, even with the right password
+	rec := loginAttempt(h, "203.0.113.5", "hunter2")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("login after %d failures = %d, want 429", maxLoginFailures, rec.Code)
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Error("429 without Retry-After")
+	}
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "203.0.113.5:40000"
+	req.SetBasicAuth("", "hunter2")
+	if fh.isAuthenticated(req) {
+		t.Error("basic auth was checked during the lockout")
+	}
+
+	// Other clients are unaffected
+	if rec := loginAttempt(h, "203.0.113.6", "hunter2"); rec.Code != http.StatusSeeOther {
+		t.Errorf("login from another client = %d, want 303", rec.Code)
+	}
+}
+
+func TestLoginSuccessClearsFailures(t *testing.T) {
+	fh := newTestHandler(t, "hunter2")
+	h := protectedHandler(fh)
+
+	for round := 0; round < 3; round++ {
+		for i := 0; i < maxLoginFailures-1; i++ {
+			loginAttempt(h, "203.0.113.5", "guess")
+		}
+		if rec := loginAttempt(h, "203.0.113.5", "hunter2"); rec.Code != http.StatusSeeOther {
+			t.Fatalf("round %d: good login = %d, want 303", round, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package server
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// branding is what --title, --brand and --logo-url change on the listing
+// and login pages
+type branding struct {
+	title   string // listing heading and tab title
+	brand   string // name in the footers and on the login page
+	logoURL string // image shown instead of the share icon; "" keeps the icon
+}
+
+// newBranding fills in GoShare's own names for anything not given. The
+// logo has to be an http(s) URL or a path on this server.
+func newBranding(title, brand, logoURL string) (branding, error) {
+	b := branding{
+		title:   strings.TrimSpace(title),
+		brand:   strings.TrimSpace(brand),
+		logoURL: strings.TrimSpace(logoURL),
+	}
+	if b.brand == "" {
+		b.brand = "GoShare"
+	}
+	if b.logoURL != "" {
+		u, err := url.Parse(b.logoURL)
+		if err != nil || !(u.Scheme == "http" || u.Scheme == "https" || u.Scheme == "" && strings.HasPrefix(u.Path, "/")) {
+			return branding{}, fmt.Errorf("--logo-url %q must be an http(s) URL or a path starting with /", logoURL)
+		}
+	}
+	return b, nil
+}
+
+// heading is the listing page's <h1>
+func (b branding) heading() string {
+	if b.title != "" {
+		return b.title
+	}
+	return b.brand + " File Browser"
+}
+
+// pageTitle is the listing page's browser tab title
+func (b branding) pageTitle() string {
+	if b.title != "" {
+		return b.title
+	}
+	return b.brand + " - File Browser"
+}
@@ -0,0 +1,113 @@
+package server
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"hash"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// maxCachedChecksums bounds the checksum cache; entries are a few dozen bytes
+const maxCachedChecksums = 1024
+
+// checksumAlgos are the hashes /api/checksum offers
+var checksumAlgos = map[string]func() hash.Hash{
+	"sha256": sha256.New,
+	"sha1":   sha1.New,
+	"md5":    md5.New,
+}
+
+// Hashing reads the whole file, so only a couple run at once and results
+// are kept keyed by path and algorithm, checked against size and mtime
+var (
+	checksumSlots = make(chan struct{}, 2)
+	checksumCache = newListingCache(maxCachedChecksums)
+)
+
+// APIChecksum is the response for /api/checksum
+type APIChecksum struct {
+	Path string `json:"path"`
+	Algo string `json:"algo"`
+	Hex  string `json:"hex"`
+}
+
+// handleAPIChecksum hashes the file at ?path= with ?algo= (sha256 by
+// default, or sha1 or md5) so recipients can verify their download
+func (fh *FileHandler) handleAPIChecksum(w http.ResponseWriter, r *http.Request) {
+	algo := strings.ToLower(r.URL.Query().Get("algo"))
+	if algo == "" {
+		algo = "sha256"
+	}
+	newHash, ok := checksumAlgos[algo]
+	if !ok {
+		writeAPIError(w, http.StatusBadRequest, "unknown algo, use sha256, sha1 or md5")
+		return
+	}
+
+	cleanPath, fsPath, ok := fh.resolvePath(r.URL.Query().Get("path"))
+	if !ok {
+		writeAPIError(w, http.StatusForbidden, "path is outside the share")
+		return
+	}
+	info, err := os.Stat(fsPath)
+	if err != nil || info.IsDir() || fh.hiddenPath(cleanPath) || !fh.showsFile(info.Name()) {
+		writeAPIError(w, http.StatusNotFound, "no such file")
+		return
+	}
+
+	key := cleanPath + "?algo=" + algo
+	stamp := hashListing([]FileInfo{{Name: info.Name(), Size: info.Size(), ModTime: info.ModTime()}})
+	sum, ok := checksumCache.get(key, stamp)
+	if !ok {
+		select {
+		case checksumSlots <- struct{}{}:
+		case <-r.Context().Done():
+			return
+		}
+		sum, err = hashFile(r, fsPath, newHash())
+		<-checksumSlots
+		if err != nil {
+			if r.Context().Err() == nil {
+				log.Printf("Checksum of %s failed: %v", fsPath, err)
+				writeAPIError(w, http.StatusInternalServerError, "could not read the file")
+			}
+			return
+		}
+		checksumCache.put(key, stamp, sum)
+	}
+
+	json.NewEncoder(w).Encode(APIChecksum{Path: cleanPath, Algo: algo, Hex: string(sum)})
+}
+
+// hashFile returns the hex digest of the file at path, giving up when the
+// client goes away
+func hashFile(r *http.Request, path string, h hash.Hash) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	buf := make([]byte, 256<<10)
+	for {
+		if err := r.Context().Err(); err != nil {
+			return nil, err
+		}
+		n, err := f.Read(buf)
+		h.Write(buf[:n])
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return []byte(hex.EncodeToString(h.Sum(nil))), nil
+}
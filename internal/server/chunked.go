@@ -0,0 +1,429 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	maxPendingUploads = 64             // chunked uploads started but not committed
+	uploadIdleTimeout = 24 * time.Hour // an upload untouched this long is dropped
+	partFilePrefix    = ".goshare-part-"
+)
+
+// chunkedUpload is one file arriving through /api/upload/<id>. The bytes
+// received so far live in a hidden part file next to where the file will
+// end up, so its size is the offset to resume from and the commit is a
+// rename on the same filesystem.
+type chunkedUpload struct {
+	mu        sync.Mutex // held while a chunk is written or the file committed
+	cleanDir  string
+	fsDir     string
+	name      string // file name as sent, already reduced to its base name
+	size      int64
+	overwrite bool
+	partPath  string
+	touched   time.Time // guarded by chunkedUploads.mu
+}
+
+// chunkedUploads holds the uploads in progress. They are kept in memory
+// only; a restart drops them along with their part files.
+type chunkedUploads struct {
+	mu      sync.Mutex
+	uploads map[string]*chunkedUpload
+	quota   *storageQuota // each upload holds a reservation of its size until it goes
+}
+
+func newChunkedUploads() *chunkedUploads {
+	return &chunkedUploads{uploads: make(map[string]*chunkedUpload)}
+}
+
+// add stores u under a new random ID, first dropping idle uploads
+func (c *chunkedUploads) add(u *chunkedUpload) (string, error) {
+	raw := make([]byte, 16)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	id := hex.EncodeToString(raw)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	for old, pending := range c.uploads {
+		if now.Sub(pending.touched) > uploadIdleTimeout {
+			delete(c.uploads, old)
+			os.Remove(pending.partPath)
+			c.quota.release(pending.size, 0)
+		}
+	}
+	if len(c.uploads) >= maxPendingUploads {
+		return "", errTooManyUploads
+	}
+	u.partPath = filepath.Join(u.fsDir, partFilePrefix+id)
+	u.touched = now
+	c.uploads[id] = u
+	return id, nil
+}
+
+var errTooManyUploads = errors.New("too many uploads in progress")
+
+// newPartPath names a hidden part file in fsDir for an upload that isn't
+// tracked by ID
+func newPartPath(fsDir string) string {
+	raw := make([]byte, 16)
+	rand.Read(raw)
+	return filepath.Join(fsDir, partFilePrefix+hex.EncodeToString(raw))
+}
+
+func (c *chunkedUploads) get(id string) (*chunkedUpload, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	u, ok := c.uploads[id]
+	if ok {
+		u.touched = time.Now()
+	}
+	return u, ok
+}
+
+// remove forgets id and deletes whatever part file is left. stored is
+// how many of its bytes ended up in the share.
+func (c *chunkedUploads) remove(id string, stored int64) {
+	c.mu.Lock()
+	u, ok := c.uploads[id]
+	delete(c.uploads, id)
+	c.mu.Unlock()
+	if ok {
+		os.Remove(u.partPath)
+		c.quota.release(u.size, stored)
+	}
+}
+
+// discardAll deletes every part file; the server calls it once it has
+// stopped, when nothing can resume them any more
+func (c *chunkedUploads) discardAll() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for id, u := range c.uploads {
+		os.Remove(u.partPath)
+		delete(c.uploads, id)
+		c.quota.release(u.size, 0)
+	}
+}
+
+// offset is how many bytes have been received
+func (u *chunkedUpload) offset() int64 {
+	info, err := os.Stat(u.partPath)
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
+
+// APIChunkedUpload describes an upload in progress
+type APIChunkedUpload struct {
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	Offset int64  `json:"offset"`
+}
+
+// handleAPIChunkedUpload routes the resumable upload protocol:
+//
+//	POST   /api/upload/init   {"name", "size", "directory", "overwrite", "uploadPassword"}
+//	GET    /api/upload/<id>   how far the upload got, to resume after a drop
+//	PATCH  /api/upload/<id>   append the body at the Upload-Offset header
+//	POST   /api/upload/<id>   commit: move the complete file into place
+//	DELETE /api/upload/<id>   give up and delete the partial file
+//
+// and, for clients that send a file in one request, PUT /api/upload/<name>
+// and GET /api/upload/status/<id> (see handleStreamedUpload).
+func (fh *FileHandler) handleAPIChunkedUpload(w http.ResponseWriter, r *http.Request) {
+	if fh.uploadsTLS && !fh.isSecureRequest(r) {
+		writeAPIError(w, http.StatusForbidden, "uploads require HTTPS")
+		return
+	}
+	if fh.readOnly {
+		writeAPIError(w, http.StatusForbidden, "this share is read-only")
+		return
+	}
+
+	id := strings.TrimPrefix(r.URL.Path, "/api/upload/")
+	if progressID, ok := strings.CutPrefix(id, "status/"); ok {
+		fh.handleUploadStatus(w, r, progressID)
+		return
+	}
+	if r.Method == http.MethodPut {
+		fh.handleStreamedUpload(w, r, id)
+		return
+	}
+	if id == "init" {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeAPIError(w, http.StatusMethodNotAllowed, "use POST")
+			return
+		}
+		fh.startChunkedUpload(w, r)
+		return
+	}
+
+	u, ok := fh.uploads.get(id)
+	if !ok {
+		writeAPIError(w, http.StatusNotFound, "no such upload; it may have expired")
+		return
+	}
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		u.mu.Lock()
+		offset := u.offset()
+		u.mu.Unlock()
+		w.Header().Set("Upload-Offset", strconv.FormatInt(offset, 10))
+		w.Header().Set("Cache-Control", "no-store")
+		json.NewEncoder(w).Encode(APIChunkedUpload{ID: id, Name: u.name, Size: u.size, Offset: offset})
+	case http.MethodPatch:
+		fh.appendChunk(w, r, id, u)
+	case http.MethodPost:
+		fh.commitChunkedUpload(w, r, id, u)
+	case http.MethodDelete:
+		fh.uploads.remove(id, 0)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Allow", "GET, HEAD, PATCH, POST, DELETE")
+		writeAPIError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// startChunkedUpload checks a new upload against the same rules as
+// handleUpload and creates its empty part file
+func (fh *FileHandler) startChunkedUpload(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name           string `json:"name"`
+		Size           int64  `json:"size"`
+		Directory      string `json:"directory"`
+		Overwrite      bool   `json:"overwrite"`
+		UploadPassword string `json:"uploadPassword"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<16)).Decode(&req); err != nil {
+		writeAPIError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+
+	name, ok := fh.uploadFileName(req.Name)
+	if !ok {
+		writeAPIError(w, http.StatusBadRequest, "invalid file name")
+		return
+	}
+	if strings.EqualFold(name, uploadMarker) {
+		writeAPIError(w, http.StatusBadRequest, "this file name is reserved")
+		return
+	}
+	if req.Size < 0 {
+		writeAPIError(w, http.StatusBadRequest, "size must not be negative")
+		return
+	}
+	if req.Size > fh.maxUpload {
+		writeAPIError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("files larger than %s are not accepted", formatFileSize(fh.maxUpload, false)))
+		return
+	}
+
+	cleanDir, fsDir, ok := fh.uploadTarget(w, req.Directory, req.UploadPassword)
+	if !ok {
+		return
+	}
+
+	if !fh.quota.reserve(req.Size) {
+		fh.quotaFull(w)
+		return
+	}
+	u := &chunkedUpload{cleanDir: cleanDir, fsDir: fsDir, name: name, size: req.Size, overwrite: req.Overwrite}
+	id, err := fh.uploads.add(u)
+	if err != nil {
+		fh.quota.release(req.Size, 0)
+		if err == errTooManyUploads {
+			writeAPIError(w, http.StatusServiceUnavailable, err.Error())
+		} else {
+			writeAPIError(w, http.StatusInternalServerError, "could not start the upload")
+		}
+		return
+	}
+	part, err := os.OpenFile(u.partPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666)
+	if err == nil {
+		err = part.Close()
+	}
+	if err != nil {
+		log.Printf("Could not start an upload in %s: %v", fsDir, err)
+		fh.uploads.remove(id, 0)
+		writeAPIError(w, http.StatusInternalServerError, "could not start the upload")
+		return
+	}
+
+	w.Header().Set("Location", "/api/upload/"+id)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(APIChunkedUpload{ID: id, Name: name, Size: req.Size})
+}
+
+// uploadTarget checks that an API upload may go to dir (or --upload-dir)
+// and creates the folder. On failure it has answered the request.
+func (fh *FileHandler) uploadTarget(w http.ResponseWriter, dir, password string) (cleanDir, fsDir string, ok bool) {
+	if fh.uploadDir != "" {
+		dir = fh.uploadDir
+	}
+	cleanDir, fsDir, ok = fh.resolvePath(dir)
+	if !ok || fh.hiddenPath(cleanDir) {
+		writeAPIError(w, http.StatusForbidden, "access denied")
+		return "", "", false
+	}
+	rule := fh.uploadRuleFor(cleanDir)
+	if !fh.uploadAllowed(cleanDir, rule) {
+		writeAPIError(w, http.StatusForbidden, "uploads are not allowed in this folder")
+		return "", "", false
+	}
+	if !rule.checkUploadPassword(password) {
+		writeAPIError(w, http.StatusForbidden, "wrong upload password for this folder")
+		return "", "", false
+	}
+	if err := os.MkdirAll(fsDir, 0755); err != nil {
+		writeAPIError(w, http.StatusInternalServerError, "unable to create directory")
+		return "", "", false
+	}
+	return cleanDir, fsDir, true
+}
+
+// appendChunk writes the request body at the offset the client names,
+// which has to be where the part file ends. Whatever arrives before a
+// dropped connection is kept, so the client asks for the offset and
+// carries on from there.
+func (fh *FileHandler) appendChunk(w http.ResponseWriter, r *http.Request, id string, u *chunkedUpload) {
+	start, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || start < 0 {
+		writeAPIError(w, http.StatusBadRequest, "the Upload-Offset header must give the byte offset of the chunk")
+		return
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	offset := u.offset()
+	w.Header().Set("Upload-Offset", strconv.FormatInt(offset, 10))
+	if start != offset {
+		writeAPIError(w, http.StatusConflict, fmt.Sprintf("the upload is at offset %d", offset))
+		return
+	}
+
+	part, err := os.OpenFile(u.partPath, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		writeAPIError(w, http.StatusNotFound, "no such upload; it may have expired")
+		return
+	}
+	// One byte past the remaining size tells a too-long body from an exact one
+	written, err := io.Copy(part, io.LimitReader(r.Body, u.size-offset+1))
+	if closeErr := part.Close(); err == nil {
+		err = closeErr
+	}
+	offset += written
+	if offset > u.size {
+		os.Truncate(u.partPath, u.size)
+		w.Header().Set("Upload-Offset", strconv.FormatInt(u.size, 10))
+		writeAPIError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("the file was announced as %d bytes", u.size))
+		return
+	}
+	w.Header().Set("Upload-Offset", strconv.FormatInt(offset, 10))
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "the chunk was cut short; resume from Upload-Offset")
+		return
+	}
+	json.NewEncoder(w).Encode(APIChunkedUpload{ID: id, Name: u.name, Size: u.size, Offset: offset})
+}
+
+// placePartFile moves a complete part file to name in fsDir, or to
+// "name (1).ext" and so on unless overwrite is set, and returns the name it
+// got. On failure it has answered the request.
+func placePartFile(w http.ResponseWriter, partPath, fsDir, name string, overwrite bool) (string, bool) {
+	for attempt := 0; attempt < 3; attempt++ {
+		stored := uniqueName(name, func(candidate string) bool {
+			if overwrite {
+				return false
+			}
+			_, err := os.Lstat(filepath.Join(fsDir, candidate))
+			return err == nil
+		})
+		destPath := filepath.Join(fsDir, stored)
+		err := movePartFile(partPath, destPath, overwrite)
+		switch {
+		case err == nil:
+			return stored, true
+		case !os.IsExist(err):
+			log.Printf("Could not store upload %s as %s: %v", partPath, destPath, err)
+			writeAPIError(w, http.StatusInternalServerError, "could not store the file")
+			return "", false
+		}
+	}
+	writeAPIError(w, http.StatusConflict, "a file with this name was just created, please try again")
+	return "", false
+}
+
+// movePartFile gives a part file its final name. Unless overwrite is set
+// it fails with an os.IsExist error rather than replace a file that
+// appeared at destPath meanwhile.
+func movePartFile(partPath, destPath string, overwrite bool) error {
+	if overwrite {
+		return os.Rename(partPath, destPath)
+	}
+	err := os.Link(partPath, destPath)
+	if err == nil {
+		os.Remove(partPath)
+		return nil
+	}
+	if _, statErr := os.Lstat(destPath); !os.IsExist(err) && os.IsNotExist(statErr) {
+		// Filesystems like FAT have no hard links
+		return os.Rename(partPath, destPath)
+	}
+	return err
+}
+
+// commitChunkedUpload moves a complete part file to its name in the target
+// folder, picking "name (1).ext" and so on like handleUpload unless the
+// upload asked to overwrite
+func (fh *FileHandler) commitChunkedUpload(w http.ResponseWriter, r *http.Request, id string, u *chunkedUpload) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if offset := u.offset(); offset != u.size {
+		w.Header().Set("Upload-Offset", strconv.FormatInt(offset, 10))
+		writeAPIError(w, http.StatusConflict, fmt.Sprintf("only %d of %d bytes have arrived", offset, u.size))
+		return
+	}
+
+	if reason := fh.scanUpload(r, u.cleanDir, u.partPath, u.name); reason != "" {
+		fh.uploads.remove(id, 0)
+		writeAPIError(w, http.StatusUnprocessableEntity, u.name+" was "+reason)
+		return
+	}
+	stored, ok := placePartFile(w, u.partPath, u.fsDir, u.name, u.overwrite)
+	if !ok {
+		return
+	}
+
+	fh.uploads.remove(id, u.size)
+	if u.overwrite {
+		fh.quota.changed()
+	}
+	fh.metrics.uploaded(u.size)
+	recordUpload(filepath.Join(u.fsDir, stored), u.size)
+	fh.audit(r, "http", "upload", filepath.ToSlash(filepath.Join(u.cleanDir, stored)), "", u.size)
+	fh.live.changed(u.cleanDir)
+	json.NewEncoder(w).Encode(uploadResult{
+		Uploaded: 1,
+		Files:    []uploadedFile{{Name: u.name, StoredAs: stored}},
+		Failed:   []uploadFailure{},
+	})
+}
@@ -0,0 +1,119 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	maxClipSize = 64 << 10           // bytes of text one clip may hold
+	maxClipTTL  = 7 * 24 * time.Hour // longest a clip may be asked to live
+)
+
+// clipboard holds the one text snippet shared through /api/clip. A new
+// clip replaces the old one; like share links it lives in memory only.
+type clipboard struct {
+	mu   sync.Mutex
+	clip *APIClip
+}
+
+// APIClip is the shared snippet. URL is the short link a phone can open
+// to grab it.
+type APIClip struct {
+	Text      string     `json:"text"`
+	CreatedAt time.Time  `json:"createdAt"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+	URL       string     `json:"url"`
+}
+
+// latest returns the current clip, or nil when there is none or it expired
+func (c *clipboard) latest() *APIClip {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.clip != nil && c.clip.ExpiresAt != nil && time.Now().After(*c.clip.ExpiresAt) {
+		c.clip = nil
+	}
+	return c.clip
+}
+
+func (c *clipboard) set(clip *APIClip) {
+	c.mu.Lock()
+	c.clip = clip
+	c.mu.Unlock()
+}
+
+// handleAPIClip shares a text snippet between devices: POST
+// {"text": "...", "ttl": "10m"} stores it (ttl is optional), GET returns it
+// and DELETE clears it
+func (fh *FileHandler) handleAPIClip(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	switch r.Method {
+	case http.MethodGet:
+		clip := fh.clipboard.latest()
+		if clip == nil {
+			writeAPIError(w, http.StatusNotFound, "nothing has been shared")
+			return
+		}
+		json.NewEncoder(w).Encode(clip)
+	case http.MethodPost:
+		var req struct {
+			Text string `json:"text"`
+			TTL  string `json:"ttl"`
+		}
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 2*maxClipSize)).Decode(&req); err != nil {
+			writeAPIError(w, http.StatusBadRequest, "invalid JSON body")
+			return
+		}
+		if strings.TrimSpace(req.Text) == "" {
+			writeAPIError(w, http.StatusBadRequest, "text is empty")
+			return
+		}
+		if len(req.Text) > maxClipSize {
+			writeAPIError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("text is limited to %s", formatFileSize(maxClipSize, false)))
+			return
+		}
+		clip := &APIClip{Text: req.Text, CreatedAt: time.Now(), URL: fh.baseURL(r) + "/clip"}
+		if req.TTL != "" {
+			d, err := time.ParseDuration(req.TTL)
+			if err != nil || d <= 0 || d > maxClipTTL {
+				writeAPIError(w, http.StatusBadRequest, "ttl must be a duration like 10m or 24h, at most 168h")
+				return
+			}
+			expiresAt := clip.CreatedAt.Add(d)
+			clip.ExpiresAt = &expiresAt
+		}
+		fh.clipboard.set(clip)
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(clip)
+	case http.MethodDelete:
+		fh.clipboard.set(nil)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Allow", "GET, POST, DELETE")
+		writeAPIError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// serveClip is the short link behind a clip's QR code. A clip that is a
+// web address opens it; anything else is shown as plain text.
+func (fh *FileHandler) serveClip(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	clip := fh.clipboard.latest()
+	if clip == nil {
+		http.Error(w, "Nothing has been shared", http.StatusNotFound)
+		return
+	}
+	text := strings.TrimSpace(clip.Text)
+	if u, err := url.Parse(text); err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "" && !strings.ContainsAny(text, " \n") {
+		http.Redirect(w, r, text, http.StatusSeeOther)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	fmt.Fprint(w, clip.Text)
+}
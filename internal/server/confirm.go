@@ -0,0 +1,62 @@
+package server
+
+import (
+	"html/template"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// needsDownloadConfirm reports whether a browser should see the "this file
+// is large" page before the download starts. Media elements (which send
+// Range), command-line tools and already-confirmed links go straight through.
+func (fh *FileHandler) needsDownloadConfirm(r *http.Request, stat os.FileInfo) bool {
+	if fh.confirmAbove <= 0 || stat.Size() <= fh.confirmAbove {
+		return false
+	}
+	if r.URL.Query().Get("confirm") == "1" || r.Header.Get("Range") != "" {
+		return false
+	}
+	return strings.Contains(r.Header.Get("Accept"), "text/html")
+}
+
+// serveDownloadConfirm shows the file's size with a button to go ahead
+func serveDownloadConfirm(w http.ResponseWriter, r *http.Request, stat os.FileInfo) {
+	query := r.URL.Query()
+	query.Set("confirm", "1")
+	confirmURL := *r.URL
+	confirmURL.RawQuery = query.Encode()
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	downloadConfirmPage.Execute(w, map[string]string{
+		"Name":       stat.Name(),
+		"Size":       formatFileSize(stat.Size(), false),
+		"ConfirmURL": confirmURL.RequestURI(),
+	})
+}
+
+var downloadConfirmPage = template.Must(template.New("confirm").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>GoShare - Large Download</title>
+    <link rel="icon" href="/favicon.ico">
+    <script src="https://cdn.tailwindcss.com"></script>
+    <link rel="stylesheet" href="https://cdnjs.cloudflare.com/ajax/libs/font-awesome/6.0.0/css/all.min.css">
+</head>
+<body class="bg-gray-50 min-h-screen flex items-center justify-center">
+    <div class="max-w-md w-full p-8 text-center">
+        <i class="fas fa-exclamation-triangle text-4xl text-yellow-500 mb-4"></i>
+        <h2 class="text-2xl font-bold text-gray-900 break-all">{{.Name}}</h2>
+        <p class="mt-4 text-gray-600">This file is <strong>{{.Size}}</strong>. Downloading it on mobile data may be expensive.</p>
+        <div class="mt-6 flex justify-center space-x-3">
+            <a href="{{.ConfirmURL}}" class="inline-flex items-center px-4 py-2 rounded-lg text-white bg-blue-600 hover:bg-blue-700">
+                <i class="fas fa-download mr-2"></i>Download anyway
+            </a>
+            <button onclick="history.back()" class="px-4 py-2 rounded-lg border border-gray-300 text-gray-700 bg-white hover:bg-gray-50">Go back</button>
+        </div>
+    </div>
+</body>
+</html>`))
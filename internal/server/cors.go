@@ -0,0 +1,95 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	neturl "net/url"
+	"strings"
+)
+
+const (
+	corsMethods = "GET, HEAD, POST, PUT, PATCH, DELETE, OPTIONS"
+	corsHeaders = "Content-Type, Authorization, Range, Upload-Offset, Last-Event-ID"
+	corsExposed = "Content-Disposition, ETag, Upload-Offset"
+)
+
+// corsPolicy holds the --cors-origin allowlist. Only those origins get
+// Access-Control headers, with their own Origin echoed back so credentialed
+// requests work; every other site is left to the browser's same-origin
+// rule. A nil policy allows no cross-origin requests.
+type corsPolicy struct {
+	origins map[string]bool
+}
+
+// newCORSPolicy parses origins such as https://app.example.com or
+// http://localhost:3000
+func newCORSPolicy(origins []string) (*corsPolicy, error) {
+	if len(origins) == 0 {
+		return nil, nil
+	}
+	p := &corsPolicy{origins: make(map[string]bool)}
+	for _, origin := range origins {
+		normalized, ok := normalizeOrigin(origin)
+		if !ok {
+			return nil, fmt.Errorf("%q is not an origin like https://example.com", origin)
+		}
+		p.origins[normalized] = true
+	}
+	return p, nil
+}
+
+// normalizeOrigin reduces an origin to lowercase scheme://host[:port], the
+// form browsers send it in
+func normalizeOrigin(origin string) (string, bool) {
+	u, err := neturl.Parse(strings.TrimSpace(origin))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" ||
+		(u.Path != "" && u.Path != "/") || u.RawQuery != "" || u.User != nil {
+		return "", false
+	}
+	return strings.ToLower(u.Scheme + "://" + u.Host), true
+}
+
+func (p *corsPolicy) allows(origin string) bool {
+	if p == nil || origin == "" {
+		return false
+	}
+	normalized, ok := normalizeOrigin(origin)
+	return ok && p.origins[normalized]
+}
+
+// corsMiddleware sets the CORS headers for allowlisted origins and answers
+// their preflights itself, ahead of the login check, since browsers send
+// preflights without credentials. Preflights from other origins are
+// refused; WebDAV's own OPTIONS requests carry no
+// Access-Control-Request-Method and pass through.
+func (p *corsPolicy) corsMiddleware(next http.Handler) http.Handler {
+	if p == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Add("Vary", "Origin")
+		allowed := p.allows(origin)
+		if allowed {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Set("Access-Control-Allow-Credentials", "true")
+			w.Header().Set("Access-Control-Expose-Headers", corsExposed)
+		}
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			if !allowed {
+				http.Error(w, "Origin not allowed", http.StatusForbidden)
+				return
+			}
+			w.Header().Set("Access-Control-Allow-Methods", corsMethods)
+			w.Header().Set("Access-Control-Allow-Headers", corsHeaders)
+			w.Header().Set("Access-Control-Max-Age", "600")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
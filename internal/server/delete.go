@@ -0,0 +1,110 @@
+package server
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// APIError is what every /api endpoint answers an error with, as
+// {"error": {"code": "not_found", "message": "no such file"}}. The code is
+// derived from the status, so clients can branch on it without parsing
+// the message.
+type APIError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func newAPIError(status int, message string) APIError {
+	code := strings.ToLower(http.StatusText(status))
+	code = strings.NewReplacer(" ", "_", "-", "_", "'", "").Replace(code)
+	if code == "" {
+		code = "error"
+	}
+	return APIError{Code: code, Message: message}
+}
+
+// writeAPIError answers an API request with a JSON error
+func writeAPIError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Del("Content-Length")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]APIError{"error": newAPIError(status, message)})
+}
+
+// requestError answers r with an error in the format its caller reads: the
+// JSON envelope under /api/ and plain text everywhere else
+func requestError(w http.ResponseWriter, r *http.Request, message string, status int) {
+	if strings.HasPrefix(r.URL.Path, "/api/") {
+		writeAPIError(w, status, message)
+		return
+	}
+	http.Error(w, message, status)
+}
+
+// handleAPIDelete removes a file, or a folder with ?recursive=1, for
+// DELETE /api/files?path=. Deletes follow the upload rules: only folders
+// that accept uploads, with the folder's upload password when it has one,
+// and nothing at all with --read-only.
+func (fh *FileHandler) handleAPIDelete(w http.ResponseWriter, r *http.Request) {
+	if fh.readOnly {
+		writeAPIError(w, http.StatusForbidden, "this share is read-only")
+		return
+	}
+
+	cleanPath, fsPath, ok := fh.resolvePath(r.URL.Query().Get("path"))
+	if !ok {
+		writeAPIError(w, http.StatusForbidden, "path is outside the share")
+		return
+	}
+	// What the listings hide can't be deleted either
+	if fh.hiddenPath(cleanPath) {
+		writeAPIError(w, http.StatusNotFound, "no such file or folder")
+		return
+	}
+	if _, rest, _ := fh.rootFor(cleanPath); rest == "" {
+		writeAPIError(w, http.StatusForbidden, "the shared folder itself can't be deleted")
+		return
+	}
+
+	info, err := os.Lstat(fsPath)
+	if err != nil || (!info.IsDir() && !fh.showsFile(info.Name())) {
+		writeAPIError(w, http.StatusNotFound, "no such file or folder")
+		return
+	}
+
+	parent := filepath.Dir(cleanPath)
+	rule := fh.uploadRuleFor(parent)
+	if !fh.uploadAllowed(parent, rule) {
+		writeAPIError(w, http.StatusForbidden, "deleting is not allowed in this folder")
+		return
+	}
+	if !rule.checkUploadPassword(r.FormValue("upload_password")) {
+		writeAPIError(w, http.StatusForbidden, "wrong upload password for this folder")
+		return
+	}
+
+	if info.IsDir() {
+		if r.URL.Query().Get("recursive") != "1" {
+			writeAPIError(w, http.StatusBadRequest, "folders are only deleted with ?recursive=1")
+			return
+		}
+		err = os.RemoveAll(fsPath)
+	} else {
+		err = os.Remove(fsPath)
+	}
+	if err != nil {
+		log.Printf("Could not delete %s: %v", fsPath, err)
+		writeAPIError(w, http.StatusInternalServerError, "could not delete "+cleanPath)
+		return
+	}
+
+	log.Printf("Deleted %s", fsPath)
+	fh.quota.changed()
+	fh.audit(r, "http", "delete", filepath.ToSlash(cleanPath), "", 0)
+	fh.live.changed(parent)
+	json.NewEncoder(w).Encode(map[string]string{"deleted": cleanPath})
+}
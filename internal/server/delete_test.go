@@ -0,0 +1,36 @@
+package server
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDeleteHidden(t *testing.T) {
+	fh := newTestHandler(t, "")
+	writeFile(t, fh, ".env", "SECRET=1")
+	writeFile(t, fh, ".git/config", "[core]")
+	writeMarker(t, fh, "incoming", "")
+	writeFile(t, fh, "visible.txt", "bye")
+
+	for _, target := range []string{
+		"/api/files?path=/.env",
+		"/api/files?path=/.git&recursive=1",
+		"/api/files?path=/.git/config",
+		"/api/files?path=/incoming/" + uploadMarker,
+	} {
+		if rec := do(fh, http.MethodDelete, target); rec.Code != http.StatusNotFound {
+			t.Errorf("DELETE %s = %d, want 404", target, rec.Code)
+		}
+	}
+	for _, rel := range []string{".env", ".git/config", "incoming/" + uploadMarker} {
+		if _, err := os.Stat(filepath.Join(fh.rootDir, rel)); err != nil {
+			t.Errorf("%s was deleted", rel)
+		}
+	}
+
+	if rec := do(fh, http.MethodDelete, "/api/files?path=/visible.txt"); rec.Code != http.StatusOK {
+		t.Errorf("DELETE /visible.txt = %d, want 200", rec.Code)
+	}
+}
@@ -0,0 +1,156 @@
+package server
+
+import (
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	dirSizeWorkers = 4                // folders walked at once for one listing
+	dirSizeMaxAge  = 30 * time.Second // a folder's mtime misses changes deeper down, so totals expire too
+)
+
+// dirSizeCache remembers folder totals by path. An entry is reused while
+// the folder's mtime is unchanged and it is younger than dirSizeMaxAge.
+type dirSizeCache struct {
+	mu      sync.Mutex
+	entries map[string]dirSizeEntry
+}
+
+type dirSizeEntry struct {
+	modTime  time.Time
+	size     int64
+	computed time.Time
+}
+
+func newDirSizeCache() *dirSizeCache {
+	return &dirSizeCache{entries: make(map[string]dirSizeEntry)}
+}
+
+func (c *dirSizeCache) get(fsPath string, modTime time.Time) (int64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[fsPath]
+	if !ok || !entry.modTime.Equal(modTime) || time.Since(entry.computed) > dirSizeMaxAge {
+		return 0, false
+	}
+	return entry.size, true
+}
+
+func (c *dirSizeCache) put(fsPath string, modTime time.Time, size int64) {
+	c.mu.Lock()
+	c.entries[fsPath] = dirSizeEntry{modTime: modTime, size: size, computed: time.Now()}
+	c.mu.Unlock()
+}
+
+// wantsDirSizes reports whether a listing should show folder totals: always
+// with --dir-sizes, otherwise when the request asks with ?computeDirSize=1
+func (fh *FileHandler) wantsDirSizes(r *http.Request) bool {
+	return fh.dirSizes || r.URL.Query().Get("computeDirSize") == "1"
+}
+
+// dirSizesOf totals the folders at fsPaths, which were last modified at
+// modTimes, on a small pool of workers. A folder that can't be walked
+// counts what could be read.
+func (fh *FileHandler) dirSizesOf(fsPaths []string, modTimes []time.Time) []int64 {
+	sizes := make([]int64, len(fsPaths))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < dirSizeWorkers && w < len(fsPaths); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				if size, ok := fh.dirSizeCache.get(fsPaths[i], modTimes[i]); ok {
+					sizes[i] = size
+					continue
+				}
+				sizes[i] = fh.dirSize(fsPaths[i])
+				fh.dirSizeCache.put(fsPaths[i], modTimes[i], sizes[i])
+			}
+		}()
+	}
+	for i := range fsPaths {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	return sizes
+}
+
+// dirSize adds up the files under fsPath that a listing would show. Like
+// archives it doesn't descend into symlinked folders.
+func (fh *FileHandler) dirSize(fsPath string) int64 {
+	var total int64
+	filepath.WalkDir(fsPath, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || p == fsPath {
+			return nil
+		}
+		if fh.hidden(d.Name()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() || !fh.showsFile(d.Name()) || !fh.allowsLink(p, d.Type()) {
+			return nil
+		}
+		info, err := os.Stat(p)
+		if err == nil && info.Mode().IsRegular() {
+			total += info.Size()
+		}
+		return nil
+	})
+	return total
+}
+
+// fillAPIDirSizes sets DirSize of the folders among files, which live in
+// the folder at fsPath
+func (fh *FileHandler) fillAPIDirSizes(files []APIFileItem, fsPath string) {
+	var index []int
+	var paths []string
+	var modTimes []time.Time
+	for i, f := range files {
+		if f.IsDir {
+			index = append(index, i)
+			paths = append(paths, filepath.Join(fsPath, f.Name))
+			modTimes = append(modTimes, f.ModTime)
+		}
+	}
+	for k, size := range fh.dirSizesOf(paths, modTimes) {
+		size := size
+		files[index[k]].DirSize = &size
+	}
+}
+
+// fillDirSizes sets Size and SizeStr of the folders among files. A
+// collapsed chain like "a/b/c" is totalled from its deepest folder.
+func (fh *FileHandler) fillDirSizes(files []FileInfo) {
+	var index []int
+	var paths []string
+	var modTimes []time.Time
+	for i, f := range files {
+		if !f.IsDir {
+			continue
+		}
+		_, fsPath, ok := fh.resolvePath(f.Path)
+		if !ok {
+			continue
+		}
+		info, err := os.Stat(fsPath)
+		if err != nil {
+			continue
+		}
+		index = append(index, i)
+		paths = append(paths, fsPath)
+		modTimes = append(modTimes, info.ModTime())
+	}
+	for k, size := range fh.dirSizesOf(paths, modTimes) {
+		files[index[k]].Size = size
+		files[index[k]].SizeStr = formatFileSize(size, false)
+	}
+}
@@ -0,0 +1,62 @@
+package server
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var expiredPage = template.Must(template.New("expired").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>GoShare - Link Expired</title>
+    <link rel="icon" href="/favicon.ico">
+    <script src="https://cdn.tailwindcss.com"></script>
+    <link rel="stylesheet" href="https://cdnjs.cloudflare.com/ajax/libs/font-awesome/6.0.0/css/all.min.css">
+</head>
+<body class="bg-gray-50 min-h-screen flex items-center justify-center">
+    <div class="max-w-md w-full p-8 text-center">
+        <i class="fas fa-hourglass-end text-4xl text-blue-600 mb-4"></i>
+        <h2 class="text-3xl font-bold text-gray-900">This Share Has Expired</h2>
+        <p class="mt-4 text-gray-600">These files were only shared until {{.Format "Jan 2, 15:04 MST"}}. Ask the sender for a new link if you still need them.</p>
+    </div>
+</body>
+</html>`))
+
+// expired reports whether the --expire time has passed
+func (fh *FileHandler) expired() bool {
+	return !fh.expiresAt.IsZero() && !time.Now().Before(fh.expiresAt)
+}
+
+// expiryMiddleware answers every request with 410 Gone once the share has
+// expired, except the connectivity check
+func (fh *FileHandler) expiryMiddleware(next http.Handler) http.Handler {
+	if fh.expiresAt.IsZero() {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !fh.expired() || r.URL.Path == "/ping" || r.URL.Path == "/api/health" || r.URL.Path == "/favicon.ico" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if strings.HasPrefix(r.URL.Path, "/api/") {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusGone)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"error":     newAPIError(http.StatusGone, "this share has expired"),
+				"expired":   true,
+				"expiredAt": fh.expiresAt.UTC().Format(time.RFC3339),
+			})
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusGone)
+		expiredPage.Execute(w, fh.expiresAt)
+	})
+}
@@ -0,0 +1,57 @@
+package server
+
+import (
+	_ "embed"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+//go:embed static/favicon.ico
+var defaultFavicon []byte
+
+// maxFaviconSize keeps a mistaken --favicon path from pulling a huge file into memory
+const maxFaviconSize = 1 << 20
+
+// favicon is an icon served at /favicon.ico
+type favicon struct {
+	data        []byte
+	contentType string
+}
+
+// loadFavicon reads and validates a custom favicon, or returns the embedded
+// default when path is empty
+func loadFavicon(path string) (*favicon, error) {
+	if path == "" {
+		return &favicon{data: defaultFavicon, contentType: "image/x-icon"}, nil
+	}
+
+	stat, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if stat.IsDir() || stat.Size() > maxFaviconSize {
+		return nil, fmt.Errorf("%s must be an image file under 1MB", path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	contentType := http.DetectContentType(data)
+	if strings.ToLower(filepath.Ext(path)) == ".svg" {
+		contentType = "image/svg+xml" // sniffed as text/xml
+	}
+	if !strings.HasPrefix(contentType, "image/") {
+		return nil, fmt.Errorf("%s is not an image (detected %s)", path, contentType)
+	}
+	return &favicon{data: data, contentType: contentType}, nil
+}
+
+func (f *favicon) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", f.contentType)
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	w.Write(f.data)
+}
@@ -0,0 +1,222 @@
+package server
+
+import (
+	"encoding/json"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultFlatPageSize = 100
+	maxFlatPageSize     = 1000
+	// maxFlatListing caps how many rows the HTML flat view renders
+	maxFlatListing = 5000
+	// maxFlatEntries and maxFlatDepth bound the walk behind a flat index,
+	// so one request can't crawl an entire large disk
+	maxFlatEntries = 50000
+	maxFlatDepth   = 32
+)
+
+// APIFlatIndex is the paginated response for /api/all
+type APIFlatIndex struct {
+	Root     string        `json:"root"`
+	Files    []APIFileItem `json:"files"`
+	Total    int           `json:"total"`
+	Page     int           `json:"page"`
+	PageSize int           `json:"pageSize"`
+	HasMore  bool          `json:"hasMore"`
+	// Truncated is set when the walk stopped at maxFlatEntries entries or
+	// skipped folders deeper than maxFlatDepth; Total then undercounts
+	Truncated bool `json:"truncated"`
+}
+
+// resolvePath cleans a URL path and maps it into rootDir, or into the mount
+// named by its first segment. ok is false when the result would escape the
+// shared directory, through ".." or, unless --follow-symlinks, a symlink,
+// or names no mount.
+func (fh *FileHandler) resolvePath(requestPath string) (cleanPath, fsPath string, ok bool) {
+	if requestPath == "" {
+		requestPath = "/"
+	}
+	cleanPath = filepath.Clean("/" + requestPath)
+	root, rest, ok := fh.rootFor(cleanPath)
+	if !ok {
+		return cleanPath, "", false
+	}
+	fsPath = filepath.Join(root, rest)
+	ok = withinDir(root, fsPath)
+	return cleanPath, fsPath, ok && (fh.followSymlinks || fh.insideShare(fsPath))
+}
+
+// collectFlatIndex walks fsRoot and returns every non-hidden file beneath
+// it, sorted by full path. Paths are URL paths rooted at urlRoot. The walk
+// looks at no more than maxFlatEntries entries and maxFlatDepth levels;
+// truncated reports that it left some out.
+func (fh *FileHandler) collectFlatIndex(fsRoot, urlRoot string) (files []APIFileItem, truncated bool, err error) {
+	visited := 0
+	err = filepath.WalkDir(fsRoot, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// Skip unreadable subtrees rather than failing the whole index
+			if path != fsRoot && d != nil && d.IsDir() {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if path == fsRoot {
+			return nil
+		}
+		if visited++; visited > maxFlatEntries {
+			truncated = true
+			return fs.SkipAll
+		}
+
+		// Skip hidden files and folders like handleAPIFiles does
+		if fh.hidden(d.Name()) || !fh.allowsLink(path, d.Type()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		relPath, err := filepath.Rel(fsRoot, path)
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			if strings.Count(relPath, string(filepath.Separator)) >= maxFlatDepth-1 {
+				truncated = true
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !fh.showsFile(d.Name()) {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+
+		files = append(files, APIFileItem{
+			Name:    info.Name(),
+			Path:    filepath.ToSlash(filepath.Join(urlRoot, relPath)),
+			Size:    info.Size(),
+			ModTime: info.ModTime(),
+		})
+		return nil
+	})
+
+	sort.Slice(files, func(i, j int) bool {
+		return strings.ToLower(files[i].Path) < strings.ToLower(files[j].Path)
+	})
+	return files, truncated, err
+}
+
+// handleAPIAll returns every file under ?path= as a flat, paginated list,
+// optionally filtered by a case-insensitive ?q= match on the full path
+func (fh *FileHandler) handleAPIAll(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	cleanPath, fsPath, ok := fh.resolvePath(query.Get("path"))
+	if !ok {
+		writeAPIError(w, http.StatusForbidden, "access denied")
+		return
+	}
+	if stat, err := os.Stat(fsPath); err != nil || fh.hiddenPath(cleanPath) {
+		if err == nil || os.IsNotExist(err) {
+			writeAPIError(w, http.StatusNotFound, "no such folder")
+		} else {
+			writeAPIError(w, http.StatusInternalServerError, "internal server error")
+		}
+		return
+	} else if !stat.IsDir() {
+		writeAPIError(w, http.StatusBadRequest, "path is not a directory")
+		return
+	}
+
+	files, truncated, err := fh.collectFlatIndex(fsPath, cleanPath)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, "cannot read directory")
+		return
+	}
+
+	if q := strings.ToLower(query.Get("q")); q != "" {
+		matched := files[:0]
+		for _, f := range files {
+			if strings.Contains(strings.ToLower(f.Path), q) {
+				matched = append(matched, f)
+			}
+		}
+		files = matched
+	}
+
+	start, end, p := paginate(query, len(files))
+	json.NewEncoder(w).Encode(APIFlatIndex{
+		Root:      cleanPath,
+		Files:     files[start:end],
+		Total:     p.Total,
+		Page:      p.Page,
+		PageSize:  p.PageSize,
+		HasMore:   p.HasMore,
+		Truncated: truncated,
+	})
+}
+
+// paginate reads ?page= and ?pageSize= and returns the bounds of that page
+// within n sorted items
+func paginate(query url.Values, n int) (start, end int, p APIPagination) {
+	page, _ := strconv.Atoi(query.Get("page"))
+	if page < 1 {
+		page = 1
+	}
+	pageSize, _ := strconv.Atoi(query.Get("pageSize"))
+	if pageSize < 1 {
+		pageSize = defaultFlatPageSize
+	}
+	if pageSize > maxFlatPageSize {
+		pageSize = maxFlatPageSize
+	}
+
+	start = (page - 1) * pageSize
+	if start > n {
+		start = n
+	}
+	end = start + pageSize
+	if end > n {
+		end = n
+	}
+	return start, end, APIPagination{Total: n, Page: page, PageSize: pageSize, HasMore: end < n}
+}
+
+// flatListing converts the flat index into template rows, where each row's
+// name is its path relative to the directory being viewed. truncated is
+// collectFlatIndex's.
+func (fh *FileHandler) flatListing(fsPath, urlPath string) (_ []FileInfo, total int, truncated bool, err error) {
+	items, truncated, err := fh.collectFlatIndex(fsPath, urlPath)
+	if err != nil {
+		return nil, 0, false, err
+	}
+	total = len(items)
+	if len(items) > maxFlatListing {
+		items = items[:maxFlatListing]
+	}
+
+	files := make([]FileInfo, 0, len(items))
+	for _, item := range items {
+		files = append(files, FileInfo{
+			Name:    strings.TrimPrefix(strings.TrimPrefix(item.Path, urlPath), "/"),
+			Path:    item.Path,
+			Size:    item.Size,
+			ModTime: item.ModTime,
+			Icon:    getFileIcon(item.Name, false),
+			SizeStr: formatFileSize(item.Size, false),
+		})
+	}
+	return files, total, truncated, nil
+}
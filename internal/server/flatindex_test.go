@@ -0,0 +1,54 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestFlatIndexStopsAtMaxDepth(t *testing.T) {
+	fh := newTestHandler(t, "")
+	shallow := strings.Repeat("d/", maxFlatDepth-1) + "kept.txt"
+	deep := strings.Repeat("d/", maxFlatDepth) + "lost.txt"
+	writeFile(t, fh, "top.txt", "x")
+	writeFile(t, fh, shallow, "x")
+	writeFile(t, fh, deep, "x")
+
+	rec := do(fh, http.MethodGet, "/api/all?path=/")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /api/all = %d: %s", rec.Code, rec.Body)
+	}
+	var index APIFlatIndex
+	if err := json.Unmarshal(rec.Body.Bytes(), &index); err != nil {
+		t.Fatal(err)
+	}
+	if !index.Truncated {
+		t.Error("truncated = false for a tree deeper than maxFlatDepth")
+	}
+	var paths []string
+	for _, f := range index.Files {
+		paths = append(paths, f.Path)
+	}
+	got := strings.Join(paths, " ")
+	if !strings.Contains(got, "/kept.txt") || !strings.Contains(got, "/top.txt") {
+		t.Errorf("files = %v, want top.txt and kept.txt", paths)
+	}
+	if strings.Contains(got, "lost.txt") {
+		t.Errorf("files = %v, want lost.txt left out", paths)
+	}
+}
+
+func TestFlatIndexNotTruncated(t *testing.T) {
+	fh := newTestHandler(t, "")
+	writeFile(t, fh, "a/b/c.txt", "x")
+
+	rec := do(fh, http.MethodGet, "/api/all?path=/")
+	var index APIFlatIndex
+	if err := json.Unmarshal(rec.Body.Bytes(), &index); err != nil {
+		t.Fatal(err)
+	}
+	if index.Truncated || index.Total != 1 {
+		t.Errorf("index = total %d, truncated %v; want 1 file, not truncated", index.Total, index.Truncated)
+	}
+}
@@ -0,0 +1,463 @@
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// ftpDataTimeout bounds how long we wait for a client to open a passive
+	// data connection
+	ftpDataTimeout = 30 * time.Second
+	// ftpIdleTimeout drops control connections that send no command
+	ftpIdleTimeout = 5 * time.Minute
+	// maxFTPConnections caps open control connections, which
+	// --max-connections (HTTP only) doesn't see
+	maxFTPConnections = 32
+)
+
+// ftpServer is a minimal read-only FTP server over the shared directory for
+// devices that can't speak HTTP. Only passive mode is supported.
+type ftpServer struct {
+	fh       *FileHandler
+	listener net.Listener
+
+	mu    sync.Mutex
+	conns map[net.Conn]struct{}
+}
+
+// startFTPServer begins accepting FTP connections on addr in the background
+func startFTPServer(addr string, fh *FileHandler) (*ftpServer, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	srv := &ftpServer{fh: fh, listener: listener, conns: make(map[net.Conn]struct{})}
+	go srv.serve()
+	return srv, nil
+}
+
+func (s *ftpServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return // listener closed
+		}
+		if host, _, _ := net.SplitHostPort(conn.RemoteAddr().String()); !s.fh.clients.allows(host) || s.fh.expired() {
+			conn.Close()
+			continue
+		}
+		s.mu.Lock()
+		if len(s.conns) >= maxFTPConnections {
+			s.mu.Unlock()
+			fmt.Fprint(conn, "421 Too many connections, try again later\r\n")
+			conn.Close()
+			continue
+		}
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+
+		go func() {
+			defer func() {
+				s.mu.Lock()
+				delete(s.conns, conn)
+				s.mu.Unlock()
+				conn.Close()
+			}()
+			newFTPSession(s.fh, conn).run()
+		}()
+	}
+}
+
+// Close stops accepting connections and drops the open ones
+func (s *ftpServer) Close() error {
+	err := s.listener.Close()
+	s.mu.Lock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+	return err
+}
+
+// ftpSession is the state of one control connection
+type ftpSession struct {
+	fh       *FileHandler
+	conn     net.Conn
+	reader   *bufio.Reader
+	user     string
+	loggedIn bool
+	cwd      string // URL-style path within the share
+	passive  net.Listener
+	restart  int64 // offset from REST for the next RETR
+}
+
+func newFTPSession(fh *FileHandler, conn net.Conn) *ftpSession {
+	return &ftpSession{
+		fh:       fh,
+		conn:     conn,
+		reader:   bufio.NewReader(conn),
+		cwd:      "/",
+		loggedIn: fh.auth == nil, // open shares allow anonymous access
+	}
+}
+
+// remoteIP is the client's address on the control connection
+func (s *ftpSession) remoteIP() string {
+	host, _, _ := net.SplitHostPort(s.conn.RemoteAddr().String())
+	return host
+}
+
+func (s *ftpSession) reply(code int, msg string) {
+	fmt.Fprintf(s.conn, "%d %s\r\n", code, msg)
+}
+
+func (s *ftpSession) run() {
+	defer s.closePassive()
+	s.reply(220, "GoShare FTP (read-only) ready")
+
+	for {
+		s.conn.SetReadDeadline(time.Now().Add(ftpIdleTimeout))
+		line, err := s.reader.ReadString('\n')
+		if err != nil {
+			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+				s.reply(421, "Idle timeout, closing control connection")
+			}
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		cmd, arg, _ := strings.Cut(line, " ")
+		cmd = strings.ToUpper(cmd)
+
+		if !s.loggedIn {
+			switch cmd {
+			case "USER", "PASS", "QUIT", "FEAT", "SYST", "OPTS", "NOOP":
+			default:
+				s.reply(530, "Please log in with USER and PASS")
+				continue
+			}
+		}
+
+		switch cmd {
+		case "USER":
+			s.user = arg
+			if s.fh.auth == nil {
+				s.reply(230, "Anonymous access granted")
+			} else {
+				s.reply(331, "Password required")
+			}
+		case "PASS":
+			if s.fh.auth == nil {
+				s.loggedIn = true
+				s.reply(230, "Logged in")
+				continue
+			}
+			// Guesses over FTP count against the same lockout as the web login
+			if wait := s.fh.logins.lockedOutIP(s.remoteIP()); wait > 0 {
+				seconds := int(wait.Round(time.Second) / time.Second)
+				if seconds < 1 {
+					seconds = 1
+				}
+				s.reply(421, fmt.Sprintf("Too many failed logins, try again in %d seconds", seconds))
+				return
+			}
+			valid := s.fh.auth.Check(s.user, arg)
+			s.fh.logins.recordIP(s.remoteIP(), valid)
+			if valid {
+				s.loggedIn = true
+				s.reply(230, "Logged in")
+			} else {
+				s.reply(530, "Login incorrect")
+			}
+		case "SYST":
+			s.reply(215, "UNIX Type: L8")
+		case "FEAT":
+			fmt.Fprint(s.conn, "211-Features:\r\n SIZE\r\n MDTM\r\n REST STREAM\r\n PASV\r\n EPSV\r\n UTF8\r\n211 End\r\n")
+		case "OPTS":
+			s.reply(200, "OK")
+		case "NOOP":
+			s.reply(200, "OK")
+		case "TYPE", "MODE", "STRU":
+			s.reply(200, "OK")
+		case "PWD", "XPWD":
+			s.reply(257, strconv.Quote(s.cwd)+" is the current directory")
+		case "CWD", "XCWD":
+			s.changeDir(arg)
+		case "CDUP", "XCUP":
+			s.changeDir("..")
+		case "PASV":
+			s.enterPassive(false)
+		case "EPSV":
+			s.enterPassive(true)
+		case "PORT", "EPRT":
+			s.reply(502, "Active mode not supported, use passive mode")
+		case "LIST", "NLST":
+			s.list(arg, cmd == "NLST")
+		case "REST":
+			offset, err := strconv.ParseInt(arg, 10, 64)
+			if err != nil || offset < 0 {
+				s.reply(501, "Invalid offset")
+				continue
+			}
+			s.restart = offset
+			s.reply(350, "Restarting at "+arg)
+		case "RETR":
+			s.retrieve(arg)
+		case "SIZE", "MDTM":
+			s.stat(cmd, arg)
+		case "STOR", "STOU", "APPE", "DELE", "MKD", "XMKD", "RMD", "XRMD", "RNFR", "RNTO", "SITE":
+			s.reply(550, "Permission denied: this server is read-only")
+		case "QUIT":
+			s.reply(221, "Goodbye")
+			return
+		default:
+			s.reply(502, "Command not implemented")
+		}
+	}
+}
+
+// resolve maps an FTP path argument (absolute or relative to cwd) into the share
+func (s *ftpSession) resolve(arg string) (string, string, bool) {
+	p := arg
+	if !strings.HasPrefix(p, "/") {
+		p = path.Join(s.cwd, p)
+	}
+	cleanPath, fsPath, ok := s.fh.resolvePath(p)
+	return cleanPath, fsPath, ok && !s.fh.hiddenPath(cleanPath)
+}
+
+func (s *ftpSession) changeDir(arg string) {
+	cleanPath, fsPath, ok := s.resolve(arg)
+	if s.fh.isMountRoot(cleanPath) {
+		s.cwd = cleanPath
+		s.reply(250, "Directory changed to /")
+		return
+	}
+	if !ok {
+		s.reply(550, "Access denied")
+		return
+	}
+	if info, err := os.Stat(fsPath); err != nil || !info.IsDir() {
+		s.reply(550, "No such directory")
+		return
+	}
+	s.cwd = cleanPath
+	s.reply(250, "Directory changed to "+cleanPath)
+}
+
+func (s *ftpSession) closePassive() {
+	if s.passive != nil {
+		s.passive.Close()
+		s.passive = nil
+	}
+}
+
+func (s *ftpSession) enterPassive(extended bool) {
+	s.closePassive()
+
+	host, _, _ := net.SplitHostPort(s.conn.LocalAddr().String())
+	listener, err := net.Listen("tcp", net.JoinHostPort(host, "0"))
+	if err != nil {
+		s.reply(425, "Cannot open data connection")
+		return
+	}
+	s.passive = listener
+	port := listener.Addr().(*net.TCPAddr).Port
+
+	if extended {
+		s.reply(229, fmt.Sprintf("Entering Extended Passive Mode (|||%d|)", port))
+		return
+	}
+	ip := net.ParseIP(host).To4()
+	if ip == nil {
+		s.closePassive()
+		s.reply(425, "PASV needs IPv4, use EPSV")
+		return
+	}
+	s.reply(227, fmt.Sprintf("Entering Passive Mode (%d,%d,%d,%d,%d,%d)", ip[0], ip[1], ip[2], ip[3], port>>8, port&0xff))
+}
+
+// openData accepts the client's connection on the passive listener. Only
+// a connection from the control connection's address is taken; anyone else
+// who finds the port is dropped, or they could receive the logged-in
+// user's transfer.
+func (s *ftpSession) openData() (net.Conn, error) {
+	if s.passive == nil {
+		return nil, fmt.Errorf("no passive listener")
+	}
+	defer s.closePassive()
+	if tcp, ok := s.passive.(*net.TCPListener); ok {
+		tcp.SetDeadline(time.Now().Add(ftpDataTimeout))
+	}
+	client := net.ParseIP(s.remoteIP())
+	for {
+		conn, err := s.passive.Accept()
+		if err != nil {
+			return nil, err
+		}
+		host, _, _ := net.SplitHostPort(conn.RemoteAddr().String())
+		if ip := net.ParseIP(host); ip != nil && ip.Equal(client) {
+			return conn, nil
+		}
+		log.Printf("FTP: dropped data connection from %s, expected %s", host, client)
+		conn.Close()
+	}
+}
+
+func (s *ftpSession) list(arg string, namesOnly bool) {
+	// Ignore ls-style flags such as "-la" that many clients send
+	var target string
+	for _, field := range strings.Fields(arg) {
+		if !strings.HasPrefix(field, "-") {
+			target = field
+		}
+	}
+
+	cleanPath, fsPath, ok := s.resolve(target)
+	if !ok && !s.fh.isMountRoot(cleanPath) {
+		s.reply(550, "Access denied")
+		return
+	}
+
+	var infos []os.FileInfo
+	info, err := os.Stat(fsPath)
+	if s.fh.isMountRoot(cleanPath) {
+		infos = s.mountInfos()
+	} else if err != nil {
+		s.reply(550, "No such file or directory")
+		return
+	} else if info.IsDir() {
+		entries, err := os.ReadDir(fsPath)
+		if err != nil {
+			s.reply(550, "Cannot read directory")
+			return
+		}
+		for _, entry := range entries {
+			if entryInfo, err := entry.Info(); err == nil && !s.fh.hidden(entryInfo.Name()) && s.fh.allowsLink(filepath.Join(fsPath, entryInfo.Name()), entryInfo.Mode()) && (entryInfo.IsDir() || s.fh.showsFile(entryInfo.Name())) {
+				infos = append(infos, entryInfo)
+			}
+		}
+	} else if s.fh.showsFile(info.Name()) {
+		infos = []os.FileInfo{info}
+	} else {
+		s.reply(550, "No such file or directory")
+		return
+	}
+
+	s.reply(150, "Opening data connection for directory listing")
+	data, err := s.openData()
+	if err != nil {
+		s.reply(425, "Cannot open data connection")
+		return
+	}
+	w := bufio.NewWriter(data)
+	for _, fi := range infos {
+		if namesOnly {
+			fmt.Fprintf(w, "%s\r\n", fi.Name())
+		} else {
+			fmt.Fprintf(w, "%s\r\n", ftpListLine(fi))
+		}
+	}
+	w.Flush()
+	data.Close()
+	s.reply(226, "Transfer complete")
+}
+
+// mountInfos lists the mounts as the directories of the virtual root
+func (s *ftpSession) mountInfos() []os.FileInfo {
+	var infos []os.FileInfo
+	for _, name := range s.fh.mountNames() {
+		if info, err := os.Stat(s.fh.mounts[name]); err == nil && info.IsDir() {
+			infos = append(infos, mountInfo{info, name})
+		}
+	}
+	return infos
+}
+
+// mountInfo is a mount's directory renamed to its mount name
+type mountInfo struct {
+	os.FileInfo
+	name string
+}
+
+func (m mountInfo) Name() string { return m.name }
+
+// ftpListLine formats a file like `ls -l`, which is what FTP clients parse
+func ftpListLine(fi os.FileInfo) string {
+	mod := fi.ModTime()
+	stamp := mod.Format("Jan _2  2006")
+	if time.Since(mod) < 180*24*time.Hour {
+		stamp = mod.Format("Jan _2 15:04")
+	}
+	return fmt.Sprintf("%s 1 goshare goshare %12d %s %s", fi.Mode().String(), fi.Size(), stamp, fi.Name())
+}
+
+func (s *ftpSession) retrieve(arg string) {
+	offset := s.restart
+	s.restart = 0
+
+	_, fsPath, ok := s.resolve(arg)
+	if !ok {
+		s.reply(550, "Access denied")
+		return
+	}
+	file, err := os.Open(fsPath)
+	if err != nil {
+		s.reply(550, "No such file")
+		return
+	}
+	defer file.Close()
+	if info, err := file.Stat(); err != nil || info.IsDir() || !s.fh.showsFile(info.Name()) {
+		s.reply(550, "Not a regular file")
+		return
+	}
+	if offset > 0 {
+		if _, err := file.Seek(offset, io.SeekStart); err != nil {
+			s.reply(554, "Cannot restart at that offset")
+			return
+		}
+	}
+
+	s.reply(150, "Opening data connection for "+path.Base(arg))
+	data, err := s.openData()
+	if err != nil {
+		s.reply(425, "Cannot open data connection")
+		return
+	}
+	_, err = io.Copy(data, file)
+	data.Close()
+	if err != nil {
+		log.Printf("FTP transfer of %s failed: %v", fsPath, err)
+		s.reply(426, "Transfer aborted")
+		return
+	}
+	s.reply(226, "Transfer complete")
+}
+
+func (s *ftpSession) stat(cmd, arg string) {
+	_, fsPath, ok := s.resolve(arg)
+	if !ok {
+		s.reply(550, "Access denied")
+		return
+	}
+	info, err := os.Stat(fsPath)
+	if err != nil || info.IsDir() || !s.fh.showsFile(info.Name()) {
+		s.reply(550, "No such file")
+		return
+	}
+	if cmd == "SIZE" {
+		s.reply(213, strconv.FormatInt(info.Size(), 10))
+	} else {
+		s.reply(213, info.ModTime().UTC().Format("20060102150405"))
+	}
+}
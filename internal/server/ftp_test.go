@@ -0,0 +1,169 @@
+package server
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// ftpClient is a bare control connection for driving the FTP server
+type ftpClient struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// dialFTP starts an FTP server for fh and connects to it, reading the
+// greeting
+func dialFTP(t *testing.T, fh *FileHandler) (*ftpServer, *ftpClient) {
+	t.Helper()
+	srv, err := startFTPServer("127.0.0.1:0", fh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { srv.Close() })
+	return srv, connectFTP(t, srv)
+}
+
+func connectFTP(t *testing.T, srv *ftpServer) *ftpClient {
+	t.Helper()
+	conn, err := net.Dial("tcp", srv.listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	c := &ftpClient{t: t, conn: conn, r: bufio.NewReader(conn)}
+	if got := c.read(); !strings.HasPrefix(got, "220") {
+		t.Fatalf("greeting = %q", got)
+	}
+	return c
+}
+
+// read returns the next reply line, or "" once the server hung up
+func (c *ftpClient) read() string {
+	c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	line, _ := c.r.ReadString('\n')
+	return strings.TrimRight(line, "\r\n")
+}
+
+// cmd sends one command and returns the reply
+func (c *ftpClient) cmd(line string) string {
+	c.conn.Write([]byte(line + "\r\n"))
+	return c.read()
+}
+
+func TestFTPLoginLockout(t *testing.T) {
+	fh := newTestHandler(t, "hunter2")
+	srv, c := dialFTP(t, fh)
+
+	for i := 0; i < maxLoginFailures; i++ {
+		c.cmd("USER anyone")
+		if got := c.cmd("PASS guess"); !strings.HasPrefix(got, "530") {
+			t.Fatalf("bad password %d: %q, want 530", i+1, got)
+		}
+	}
+
+	// Even the right password is refused now, and the connection dropped
+	c.cmd("USER anyone")
+	if got := c.cmd("PASS hunter2"); !strings.HasPrefix(got, "421") {
+		t.Errorf("login during the lockout = %q, want 421", got)
+	}
+	if got := c.read(); got != "" {
+		t.Errorf("connection still open after 421: %q", got)
+	}
+
+	// A new connection from the same address is still locked out, and so
+	// is the web login
+	c = connectFTP(t, srv)
+	c.cmd("USER anyone")
+	if got := c.cmd("PASS hunter2"); !strings.HasPrefix(got, "421") {
+		t.Errorf("login on a new connection = %q, want 421", got)
+	}
+	if rec := loginAttempt(protectedHandler(fh), "127.0.0.1", "hunter2"); rec.Code != 429 {
+		t.Errorf("web login from the locked-out address = %d, want 429", rec.Code)
+	}
+}
+
+func TestFTPLoginSuccessClearsFailures(t *testing.T) {
+	fh := newTestHandler(t, "hunter2")
+	_, c := dialFTP(t, fh)
+
+	for round := 0; round < 2; round++ {
+		for i := 0; i < maxLoginFailures-1; i++ {
+			c.cmd("USER anyone")
+			c.cmd("PASS guess")
+		}
+		c.cmd("USER anyone")
+		if got := c.cmd("PASS hunter2"); !strings.HasPrefix(got, "230") {
+			t.Fatalf("round %d: good login = %q, want 230", round, got)
+		}
+	}
+}
+
+// dialDataFrom opens a data connection to the port of an EPSV reply from
+// the local address ip
+func dialDataFrom(t *testing.T, epsv, ip string) net.Conn {
+	t.Helper()
+	start, end := strings.Index(epsv, "|||"), strings.LastIndex(epsv, "|")
+	if start < 0 || end <= start+3 {
+		t.Fatalf("EPSV reply %q", epsv)
+	}
+	dialer := net.Dialer{LocalAddr: &net.TCPAddr{IP: net.ParseIP(ip)}}
+	conn, err := dialer.Dial("tcp", net.JoinHostPort("127.0.0.1", epsv[start+3:end]))
+	if err != nil {
+		t.Skipf("cannot connect from %s: %v", ip, err)
+	}
+	return conn
+}
+
+func TestFTPDataConnectionMustComeFromClient(t *testing.T) {
+	fh := newTestHandler(t, "")
+	writeFile(t, fh, "secret.txt", "for the logged-in user only")
+	_, c := dialFTP(t, fh)
+	c.cmd("USER anonymous")
+
+	epsv := c.cmd("EPSV")
+	if got := c.cmd("RETR secret.txt"); !strings.HasPrefix(got, "150") {
+		t.Fatalf("RETR = %q", got)
+	}
+
+	// Another host reaching the port first gets nothing
+	intruder := dialDataFrom(t, epsv, "127.0.0.2")
+	defer intruder.Close()
+	intruder.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if data, _ := io.ReadAll(intruder); len(data) != 0 {
+		t.Errorf("another host received %q", data)
+	}
+
+	data := dialDataFrom(t, epsv, "127.0.0.1")
+	defer data.Close()
+	data.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if got, _ := io.ReadAll(data); string(got) != "for the logged-in user only" {
+		t.Errorf("client received %q", got)
+	}
+	if got := c.read(); !strings.HasPrefix(got, "226") {
+		t.Errorf("after the transfer: %q, want 226", got)
+	}
+}
+
+func TestFTPConnectionCap(t *testing.T) {
+	fh := newTestHandler(t, "")
+	srv, _ := dialFTP(t, fh)
+	for i := 1; i < maxFTPConnections; i++ {
+		connectFTP(t, srv)
+	}
+
+	conn, err := net.Dial("tcp", srv.listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	line, _ := bufio.NewReader(conn).ReadString('\n')
+	if !strings.HasPrefix(line, "421") {
+		t.Errorf("connection %d got %q, want 421", maxFTPConnections+1, line)
+	}
+}
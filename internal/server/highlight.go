@@ -0,0 +1,114 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/alecthomas/chroma/v2"
+	chromahtml "github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/alecthomas/chroma/v2/lexers"
+	"github.com/alecthomas/chroma/v2/styles"
+)
+
+// maxHighlightSize is the largest file /api/highlight will colour; bigger
+// ones are better downloaded than rendered
+const maxHighlightSize = 512 << 10
+
+// highlightLanguages maps the source files getFileIcon marks as code to
+// their chroma lexer
+var highlightLanguages = map[string]string{
+	".go":   "go",
+	".py":   "python",
+	".js":   "javascript",
+	".java": "java",
+	".c":    "c",
+	".h":    "c",
+	".cpp":  "c++",
+	".php":  "php",
+	".rb":   "ruby",
+	".rs":   "rust",
+	".css":  "css",
+	".json": "json",
+	".html": "html",
+	".htm":  "html",
+	".xml":  "xml",
+}
+
+// highlightFormatter writes tokens as <span class="hl-*"> so one fragment
+// works in both themes; the colours come from highlightCSS
+var highlightFormatter = chromahtml.New(chromahtml.WithClasses(true), chromahtml.ClassPrefix("hl-"), chromahtml.PreventSurroundingPre(true))
+
+// highlightCSS holds chroma's github style for the light theme and
+// github-dark under the .dark class the pages toggle
+var highlightCSS = "<style>\n" + highlightStyle("github", ".goshare-code") + highlightStyle("github-dark", ".dark .goshare-code") + "</style>"
+
+var cssComment = regexp.MustCompile(`/\*.*?\*/ ?`)
+
+// highlightStyle renders a chroma style's CSS scoped to scope
+func highlightStyle(name, scope string) string {
+	var css bytes.Buffer
+	if err := highlightFormatter.WriteCSS(&css, styles.Get(name)); err != nil {
+		return ""
+	}
+	var b strings.Builder
+	for _, rule := range strings.Split(css.String(), "\n") {
+		rule = cssComment.ReplaceAllString(rule, "")
+		if !strings.HasPrefix(rule, ".hl-chroma") {
+			continue // the .hl-bg rule is for whole pages
+		}
+		b.WriteString(scope + strings.TrimPrefix(rule, ".hl-chroma") + "\n")
+	}
+	return b.String()
+}
+
+// handleAPIHighlight serves GET /api/highlight?path= as an HTML fragment: the
+// file's source coloured by chroma in <span class="hl-*">, plus the styles
+// for both themes
+func (fh *FileHandler) handleAPIHighlight(w http.ResponseWriter, r *http.Request) {
+	cleanPath, fsPath, ok := fh.resolvePath(r.URL.Query().Get("path"))
+	if !ok {
+		writeAPIError(w, http.StatusForbidden, "path is outside the share")
+		return
+	}
+	info, err := os.Stat(fsPath)
+	if err != nil || info.IsDir() || fh.hiddenPath(cleanPath) || !fh.showsFile(info.Name()) {
+		writeAPIError(w, http.StatusNotFound, "no such file")
+		return
+	}
+	lang, ok := highlightLanguages[strings.ToLower(filepath.Ext(fsPath))]
+	if !ok {
+		writeAPIError(w, http.StatusUnsupportedMediaType, "not a recognized source file")
+		return
+	}
+	if info.Size() > maxHighlightSize {
+		writeAPIError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("files over %s are not highlighted", formatFileSize(maxHighlightSize, false)))
+		return
+	}
+	src, err := os.ReadFile(fsPath)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, "could not read the file")
+		return
+	}
+
+	lexer := chroma.Coalesce(lexers.Get(lang))
+	tokens, err := lexer.Tokenise(nil, string(src))
+	var code bytes.Buffer
+	if err == nil {
+		err = highlightFormatter.Format(&code, styles.Get("github"), tokens)
+	}
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, "could not highlight the file")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "private, no-cache")
+	fmt.Fprintf(w, `%s<pre class="goshare-code p-4 rounded overflow-auto max-h-96 text-sm" data-language="%s"><code>%s</code></pre>`,
+		highlightCSS, lang, code.String())
+}
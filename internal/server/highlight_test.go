@@ -0,0 +1,53 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestHighlight(t *testing.T) {
+	fh := newTestHandler(t, "")
+	writeFile(t, fh, "main.go", "package main\n\n// Hello <world>\nfunc main() {}\n")
+	writeFile(t, fh, "notes.txt", "plain")
+	writeFile(t, fh, ".private/secret.go", "package secret")
+	writeFile(t, fh, "big.js", strings.Repeat("x", maxHighlightSize+1))
+
+	rec := do(fh, http.MethodGet, "/api/highlight?path=/main.go")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("highlighting main.go = %d, want 200", rec.Code)
+	}
+	body := rec.Body.String()
+	for _, want := range []string{
+		`data-language="go"`,
+		`<span class="hl-kn">package</span>`,
+		`&lt;world&gt;`,
+		".dark .goshare-code",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("highlighted main.go lacks %q", want)
+		}
+	}
+	if strings.Contains(body, "<world>") {
+		t.Error("the source was not escaped")
+	}
+
+	for target, want := range map[string]int{
+		"/api/highlight?path=/notes.txt":          http.StatusUnsupportedMediaType,
+		"/api/highlight?path=/big.js":             http.StatusRequestEntityTooLarge,
+		"/api/highlight?path=/.private/secret.go": http.StatusNotFound,
+		"/api/highlight?path=/missing.go":         http.StatusNotFound,
+	} {
+		if rec := do(fh, http.MethodGet, target); rec.Code != want {
+			t.Errorf("GET %s = %d, want %d", target, rec.Code, want)
+		}
+	}
+}
+
+func TestHighlightNeedsLogin(t *testing.T) {
+	fh := newTestHandler(t, "hunter2")
+	writeFile(t, fh, "main.go", "package main")
+	if rec := do(protectedHandler(fh), http.MethodGet, "/api/highlight?path=/main.go"); rec.Code != http.StatusUnauthorized {
+		t.Errorf("GET /api/highlight without a login = %d, want 401", rec.Code)
+	}
+}
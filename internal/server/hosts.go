@@ -0,0 +1,90 @@
+package server
+
+import (
+	"net"
+	"net/http"
+	neturl "net/url"
+	"strings"
+	"sync"
+)
+
+// HostAllowlist is the set of Host headers the server answers to. Checking
+// it protects a locally bound share from DNS rebinding, where a hostile page
+// points its own domain at this machine. Entries may be bare hosts, host:port
+// or URLs; "*.example.com" also matches any subdomain.
+type HostAllowlist struct {
+	mu    sync.RWMutex
+	hosts map[string]bool
+}
+
+// NewHostAllowlist returns an allowlist of hosts, or nil (allow everything)
+// when none are given
+func NewHostAllowlist(hosts []string) *HostAllowlist {
+	if len(hosts) == 0 {
+		return nil
+	}
+	list := &HostAllowlist{hosts: make(map[string]bool)}
+	for _, host := range hosts {
+		list.Add(host)
+	}
+	return list
+}
+
+// Add allows another host, such as a tunnel URL discovered after startup
+func (l *HostAllowlist) Add(host string) {
+	if l == nil {
+		return
+	}
+	if host = normalizeHost(host); host == "" {
+		return
+	}
+	l.mu.Lock()
+	l.hosts[host] = true
+	l.mu.Unlock()
+}
+
+func (l *HostAllowlist) allows(host string) bool {
+	host = normalizeHost(host)
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if l.hosts[host] {
+		return true
+	}
+	for i := strings.IndexByte(host, '.'); i >= 0; i = strings.IndexByte(host, '.') {
+		host = host[i+1:]
+		if l.hosts["*."+host] {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeHost reduces a URL, host:port or bare host to a lowercase host
+func normalizeHost(host string) string {
+	host = strings.TrimSpace(host)
+	if strings.Contains(host, "://") {
+		if u, err := neturl.Parse(host); err == nil {
+			host = u.Host
+		}
+	}
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.TrimPrefix(strings.TrimSuffix(host, "]"), "[")
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
+
+// hostCheckMiddleware rejects requests whose Host header isn't allowed.
+// A nil allowlist lets everything through.
+func hostCheckMiddleware(list *HostAllowlist, next http.Handler) http.Handler {
+	if list == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !list.allows(r.Host) {
+			requestError(w, r, "Invalid Host header", http.StatusBadRequest)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
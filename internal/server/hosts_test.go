@@ -0,0 +1,56 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHostCheck(t *testing.T) {
+	list := NewHostAllowlist([]string{"localhost", "192.168.1.20", "https://abc.ngrok.app", "*.example.com", "::1"})
+	h := hostCheckMiddleware(list, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for host, want := range map[string]int{
+		"localhost:8080":        http.StatusOK,
+		"LOCALHOST":             http.StatusOK,
+		"192.168.1.20:8080":     http.StatusOK,
+		"abc.ngrok.app":         http.StatusOK,
+		"share.example.com":     http.StatusOK,
+		"a.b.example.com.":      http.StatusOK,
+		"[::1]:8080":            http.StatusOK,
+		"evil.com":              http.StatusBadRequest,
+		"example.com":           http.StatusBadRequest,
+		"example.com.evil.com":  http.StatusBadRequest,
+		"192.168.1.21:8080":     http.StatusBadRequest,
+		"localhost.attacker.io": http.StatusBadRequest,
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Host = host
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != want {
+			t.Errorf("Host %q = %d, want %d", host, rec.Code, want)
+		}
+	}
+
+	// Hosts learned after startup, like a tunnel URL, are allowed from then on
+	list.Add("https://late.trycloudflare.com")
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Host = "late.trycloudflare.com"
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("added host = %d, want 200", rec.Code)
+	}
+}
+
+func TestHostCheckOffByDefault(t *testing.T) {
+	h := hostCheckMiddleware(NewHostAllowlist(nil), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Host = "anything.example"
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("without --allowed-hosts = %d, want 200", rec.Code)
+	}
+}
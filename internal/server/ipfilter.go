@@ -0,0 +1,101 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ipFilter decides which client addresses may connect, from --allow-cidr
+// and --deny-cidr. A denied range wins over an allowed one; with no allowed
+// ranges everything not denied gets in.
+type ipFilter struct {
+	allow []*net.IPNet
+	deny  []*net.IPNet
+}
+
+// newIPFilter parses the ranges, which may also be single addresses. It
+// returns nil (allow everything) when none are given.
+func newIPFilter(allow, deny []string) (*ipFilter, error) {
+	if len(allow) == 0 && len(deny) == 0 {
+		return nil, nil
+	}
+	f := &ipFilter{}
+	var err error
+	if f.allow, err = parseCIDRs(allow); err != nil {
+		return nil, err
+	}
+	if f.deny, err = parseCIDRs(deny); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func parseCIDRs(specs []string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, spec := range specs {
+		spec = strings.TrimSpace(spec)
+		if !strings.Contains(spec, "/") {
+			ip := net.ParseIP(spec)
+			if ip == nil {
+				return nil, fmt.Errorf("%q is not an IP address or CIDR range", spec)
+			}
+			bits := 8 * net.IPv4len
+			if ip.To4() == nil {
+				bits = 8 * net.IPv6len
+			}
+			spec = fmt.Sprintf("%s/%d", spec, bits)
+		}
+		_, ipNet, err := net.ParseCIDR(spec)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not an IP address or CIDR range", spec)
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, nil
+}
+
+// allows reports whether addr may connect. Addresses that don't parse are
+// refused once any range is configured. A nil filter allows everything.
+func (f *ipFilter) allows(addr string) bool {
+	if f == nil {
+		return true
+	}
+	ip := net.ParseIP(strings.TrimSuffix(strings.TrimPrefix(addr, "["), "]"))
+	if ip == nil {
+		return false
+	}
+	// IPv4-mapped IPv6 addresses (::ffff:10.0.0.1) match IPv4 ranges
+	if v4 := ip.To4(); v4 != nil {
+		ip = v4
+	}
+	for _, n := range f.deny {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+	if len(f.allow) == 0 {
+		return true
+	}
+	for _, n := range f.allow {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// filterClients answers 403 to clients outside the allowed ranges
+func (fh *FileHandler) filterClients(next http.Handler) http.Handler {
+	if fh.clients == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !fh.clients.allows(fh.clientIP(r)) {
+			requestError(w, r, "Forbidden", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,98 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestIPFilter(t *testing.T) {
+	f, err := newIPFilter(
+		[]string{"192.168.1.0/24", "10.0.0.7", "fd00::/8", "2001:db8::1"},
+		[]string{"192.168.1.13", "fd00:bad::/32"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for addr, want := range map[string]bool{
+		"192.168.1.20":        true,
+		"192.168.1.13":        false, // denied inside an allowed range
+		"192.168.2.1":         false,
+		"10.0.0.7":            true,
+		"10.0.0.8":            false,
+		"::ffff:192.168.1.20": true, // IPv4-mapped
+		"fd00::1":             true,
+		"[fd12:3456::9]":      true,
+		"fd00:bad::1":         false,
+		"2001:db8::1":         true,
+		"2001:db8::2":         false,
+		"fe80::1":             false,
+		"not an address":      false,
+		"::ffff:192.168.1.13": false,
+	} {
+		if got := f.allows(addr); got != want {
+			t.Errorf("allows(%s) = %v, want %v", addr, got, want)
+		}
+	}
+}
+
+func TestIPFilterDenyOnly(t *testing.T) {
+	f, err := newIPFilter(nil, []string{"203.0.113.0/24", "2001:db8::/32"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for addr, want := range map[string]bool{
+		"203.0.113.9":  false,
+		"198.51.100.1": true,
+		"2001:db8::5":  false,
+		"2001:db9::5":  true,
+	} {
+		if got := f.allows(addr); got != want {
+			t.Errorf("allows(%s) = %v, want %v", addr, got, want)
+		}
+	}
+
+	if f, err := newIPFilter(nil, nil); f != nil || err != nil || !f.allows("198.51.100.1") {
+		t.Error("no ranges should allow everything")
+	}
+	if _, err := newIPFilter([]string{"10.0.0.0/33"}, nil); err == nil {
+		t.Error("accepted an invalid range")
+	}
+}
+
+func TestFilterClients(t *testing.T) {
+	fh := newTestHandler(t, "")
+	var err error
+	if fh.clients, err = newIPFilter([]string{"10.0.0.0/8", "2001:db8::/32"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	h := fh.filterClients(fh)
+
+	for _, c := range []struct {
+		remoteAddr, forwarded string
+		trustProxy            bool
+		want                  int
+	}{
+		{"10.1.2.3:5000", "", false, http.StatusOK},
+		{"[2001:db8::1]:5000", "", false, http.StatusOK},
+		{"192.0.2.1:5000", "", false, http.StatusForbidden},
+		{"[2001:db9::1]:5000", "", false, http.StatusForbidden},
+		// X-Forwarded-For only counts behind a trusted proxy
+		{"192.0.2.1:5000", "10.1.2.3", false, http.StatusForbidden},
+		{"10.1.2.3:5000", "192.0.2.1", false, http.StatusOK},
+		{"10.0.0.1:5000", "192.0.2.1, 10.0.0.1", true, http.StatusForbidden},
+		{"192.0.2.1:5000", "2001:db8::7", true, http.StatusOK},
+	} {
+		fh.trustProxy = c.trustProxy
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = c.remoteAddr
+		if c.forwarded != "" {
+			req.Header.Set("X-Forwarded-For", c.forwarded)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != c.want {
+			t.Errorf("%s (X-Forwarded-For %q, trusted %v) = %d, want %d", c.remoteAddr, c.forwarded, c.trustProxy, rec.Code, c.want)
+		}
+	}
+}
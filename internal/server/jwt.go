@@ -0,0 +1,210 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// apiRole is the role put in API tokens; every logged-in user has full
+// read access for now
+const apiRole = "user"
+
+// jwtHeader is the fixed, pre-encoded header of every token we issue
+var jwtHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+// apiClaims are the JWT claims handed to API clients
+type apiClaims struct {
+	Subject   string `json:"sub"`
+	Role      string `json:"role"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// apiTokens issues and verifies HS256 JSON Web Tokens for API clients that
+// would rather send `Authorization: Bearer` than keep a cookie. The signing
+// secret is random per run, so restarting the server logs clients out.
+type apiTokens struct {
+	secret []byte
+}
+
+func newAPITokens() *apiTokens {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		panic("goshare: cannot generate token secret: " + err.Error())
+	}
+	return &apiTokens{secret: secret}
+}
+
+func (t *apiTokens) sign(payload string) string {
+	mac := hmac.New(sha256.New, t.secret)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// issue returns a signed token for username that expires after sessionTTL
+func (t *apiTokens) issue(username string) (string, time.Time, error) {
+	now := time.Now()
+	expires := now.Add(sessionTTL)
+	claims, err := json.Marshal(apiClaims{
+		Subject:   username,
+		Role:      apiRole,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: expires.Unix(),
+	})
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	payload := jwtHeader + "." + base64.RawURLEncoding.EncodeToString(claims)
+	return payload + "." + t.sign(payload), expires, nil
+}
+
+// verify checks a token's signature and expiry and returns its claims
+func (t *apiTokens) verify(token string) (*apiClaims, error) {
+	header, rest, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, errors.New("malformed token")
+	}
+	body, signature, ok := strings.Cut(rest, ".")
+	if !ok {
+		return nil, errors.New("malformed token")
+	}
+	// Only our own header is accepted, which rules out alg=none and friends
+	if header != jwtHeader {
+		return nil, errors.New("unsupported token header")
+	}
+	if !hmac.Equal([]byte(signature), []byte(t.sign(header+"."+body))) {
+		return nil, errors.New("bad signature")
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(body)
+	if err != nil {
+		return nil, errors.New("malformed token")
+	}
+	var claims apiClaims
+	if err := json.Unmarshal(raw, &claims); err != nil {
+		return nil, errors.New("malformed token")
+	}
+	if time.Now().Unix() >= claims.ExpiresAt {
+		return nil, errors.New("token expired")
+	}
+	return &claims, nil
+}
+
+// bearerToken extracts the token from an `Authorization: Bearer` header
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return "", false
+	}
+	return strings.TrimSpace(token), true
+}
+
+func hasBearerToken(r *http.Request) bool {
+	_, ok := bearerToken(r)
+	return ok
+}
+
+// rejectBearer answers an API request that carried an unusable token
+func rejectBearer(w http.ResponseWriter, err error) {
+	w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+	writeAPIError(w, http.StatusUnauthorized, err.Error())
+}
+
+// sessionCookie is the browser login cookie. Its value is a token from
+// apiTokens, so it can't be forged and stops working after sessionTTL.
+const sessionCookie = "auth_session"
+
+// setSession logs the browser in as username
+func (t *apiTokens) setSession(w http.ResponseWriter, username string) error {
+	token, expires, err := t.issue(username)
+	if err != nil {
+		return err
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    token,
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return nil
+}
+
+// clearSession logs the browser out. API tokens can't be revoked this way;
+// they run until they expire.
+func clearSession(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// hasSession reports whether r carries a valid, unexpired session cookie
+func (t *apiTokens) hasSession(r *http.Request) bool {
+	cookie, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return false
+	}
+	_, err = t.verify(cookie.Value)
+	return err == nil
+}
+
+// handleAPILogin exchanges credentials for an API token. It accepts a JSON
+// body of {"username": "...", "password": "..."} or the same as form fields.
+func (fh *FileHandler) handleAPILogin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeAPIError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	var creds struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<16)).Decode(&creds); err != nil {
+			writeAPIError(w, http.StatusBadRequest, "invalid JSON body")
+			return
+		}
+	} else {
+		creds.Username = r.FormValue("username")
+		creds.Password = r.FormValue("password")
+	}
+
+	if fh.auth != nil {
+		if !fh.logins.allow(w, r) {
+			return
+		}
+		valid := fh.auth.Check(creds.Username, creds.Password)
+		fh.logins.record(r, valid)
+		if !valid {
+			writeAPIError(w, http.StatusUnauthorized, "invalid credentials")
+			return
+		}
+	}
+
+	token, expires, err := fh.tokens.issue(creds.Username)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, "could not issue token")
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"token":     token,
+		"tokenType": "Bearer",
+		"expiresAt": expires.UTC().Format(time.RFC3339),
+		"role":      apiRole,
+	})
+}
@@ -0,0 +1,64 @@
+package server
+
+import "net/http"
+
+// lightSlotsPerHeavy is how many cheap requests --max-connections allows
+// for each expensive one
+const lightSlotsPerHeavy = 4
+
+// requestLimiter caps requests in flight for --max-connections. Archive
+// builds, hashing and the like get max slots; everything else shares a
+// bigger pool so listings keep working while downloads are busy.
+type requestLimiter struct {
+	heavy chan struct{}
+	light chan struct{}
+}
+
+func newRequestLimiter(max int) *requestLimiter {
+	if max <= 0 {
+		return nil
+	}
+	return &requestLimiter{
+		heavy: make(chan struct{}, max),
+		light: make(chan struct{}, max*lightSlotsPerHeavy),
+	}
+}
+
+// isHeavyRequest reports whether r streams an archive or reads whole files
+// on the server's side
+func isHeavyRequest(r *http.Request) bool {
+	switch r.URL.Path {
+	case "/api/zip", "/api/montage", "/api/checksum":
+		return true
+	}
+	query := r.URL.Query()
+	return query.Get("download") != "" || query.Get("transcode") != ""
+}
+
+// limitRequests answers 503 with Retry-After once the matching pool is full.
+// Health checks are never limited so a busy server doesn't look dead.
+func (l *requestLimiter) limitRequests(next http.Handler) http.Handler {
+	if l == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/ping" || r.URL.Path == "/readyz" || r.URL.Path == "/api/health" || r.URL.Path == "/metrics" || r.URL.Path == "/api/ws" || r.Method == http.MethodOptions {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		slots, what := l.light, "requests"
+		if isHeavyRequest(r) {
+			slots, what = l.heavy, "downloads"
+		}
+		select {
+		case slots <- struct{}{}:
+			defer func() { <-slots }()
+		default:
+			w.Header().Set("Retry-After", "5")
+			requestError(w, r, "Too many "+what+" in progress, try again shortly", http.StatusServiceUnavailable)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,103 @@
+package server
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+)
+
+// blockingHandler holds every request until release is closed, reporting
+// each one on entered as it arrives
+func blockingHandler(entered chan<- string, release <-chan struct{}) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		entered <- r.URL.RequestURI()
+		<-release
+	})
+}
+
+func TestMaxConnectionsRejectsOverflow(t *testing.T) {
+	const max = 3
+	entered, release := make(chan string, max*lightSlotsPerHeavy), make(chan struct{})
+	h := newRequestLimiter(max).limitRequests(blockingHandler(entered, release))
+
+	// Fill the download pool with N concurrent zips
+	var wg sync.WaitGroup
+	codes := make(chan int, max)
+	for i := 0; i < max; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			codes <- do(h, http.MethodGet, "/api/zip?paths=/a").Code
+		}()
+	}
+	for i := 0; i < max; i++ {
+		<-entered
+	}
+
+	// Request N+1 is turned away without reaching the handler
+	rec := do(h, http.MethodGet, "/folder?download=zip")
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("download %d of %d = %d, want 503", max+1, max, rec.Code)
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Error("503 without Retry-After")
+	}
+
+	// Listings and health checks use other pools and still get through
+	for _, target := range []string{"/", "/api/health"} {
+		wg.Add(1)
+		go func(target string) {
+			defer wg.Done()
+			if rec := do(h, http.MethodGet, target); rec.Code != http.StatusOK {
+				t.Errorf("GET %s while downloads are full = %d, want 200", target, rec.Code)
+			}
+		}(target)
+		<-entered
+	}
+
+	close(release)
+	wg.Wait()
+	close(codes)
+	for code := range codes {
+		if code != http.StatusOK {
+			t.Errorf("one of the first %d downloads = %d, want 200", max, code)
+		}
+	}
+
+	// The slots are free again once those finish
+	if rec := do(h, http.MethodGet, "/folder?download=zip"); rec.Code != http.StatusOK {
+		t.Errorf("download after the others finished = %d, want 200", rec.Code)
+	}
+}
+
+func TestMaxConnectionsLightPool(t *testing.T) {
+	const max = 1
+	entered, release := make(chan string, max*lightSlotsPerHeavy), make(chan struct{})
+	h := newRequestLimiter(max).limitRequests(blockingHandler(entered, release))
+
+	var wg sync.WaitGroup
+	for i := 0; i < max*lightSlotsPerHeavy; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			do(h, http.MethodGet, "/api/files?path=/")
+		}()
+		<-entered
+	}
+	if rec := do(h, http.MethodGet, "/api/files?path=/"); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("listing beyond the light pool = %d, want 503", rec.Code)
+	}
+	close(release)
+	wg.Wait()
+}
+
+func TestMaxConnectionsOff(t *testing.T) {
+	l := newRequestLimiter(0)
+	if l != nil {
+		t.Fatal("--max-connections 0 built a limiter")
+	}
+	h := l.limitRequests(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	if rec := do(h, http.MethodGet, "/?download=zip"); rec.Code != http.StatusOK {
+		t.Errorf("unlimited request = %d, want 200", rec.Code)
+	}
+}
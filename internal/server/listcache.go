@@ -0,0 +1,91 @@
+package server
+
+import (
+	"container/list"
+	"encoding/binary"
+	"hash/fnv"
+	"sync"
+)
+
+// listingCache is a small LRU of rendered directory pages. Each entry is
+// stored with a hash of the directory contents so a stale render is never
+// served once a file is added, removed, or modified.
+type listingCache struct {
+	mu    sync.Mutex
+	max   int
+	ll    *list.List
+	items map[string]*list.Element
+}
+
+type listingCacheEntry struct {
+	key  string
+	hash uint64
+	page []byte
+}
+
+func newListingCache(max int) *listingCache {
+	return &listingCache{
+		max:   max,
+		ll:    list.New(),
+		items: make(map[string]*list.Element),
+	}
+}
+
+// get returns the cached page for key if it was rendered from the same
+// directory contents
+func (c *listingCache) get(key string, hash uint64) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	entry := el.Value.(*listingCacheEntry)
+	if entry.hash != hash {
+		// Directory changed since the render; drop it
+		c.ll.Remove(el)
+		delete(c.items, key)
+		return nil, false
+	}
+	c.ll.MoveToFront(el)
+	return entry.page, true
+}
+
+// put stores a rendered page, evicting the least recently used entry when full
+func (c *listingCache) put(key string, hash uint64, page []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.items[key]; ok {
+		entry := el.Value.(*listingCacheEntry)
+		entry.hash, entry.page = hash, page
+		c.ll.MoveToFront(el)
+		return
+	}
+
+	c.items[key] = c.ll.PushFront(&listingCacheEntry{key: key, hash: hash, page: page})
+	for c.ll.Len() > c.max {
+		oldest := c.ll.Back()
+		c.ll.Remove(oldest)
+		delete(c.items, oldest.Value.(*listingCacheEntry).key)
+	}
+}
+
+// hashListing fingerprints a directory listing by names, sizes and mtimes
+func hashListing(files []FileInfo) uint64 {
+	h := fnv.New64a()
+	var buf [8]byte
+	for _, f := range files {
+		h.Write([]byte(f.Name))
+		h.Write([]byte{0})
+		binary.LittleEndian.PutUint64(buf[:], uint64(f.Size))
+		h.Write(buf[:])
+		binary.LittleEndian.PutUint64(buf[:], uint64(f.ModTime.UnixNano()))
+		h.Write(buf[:])
+		if f.IsDir {
+			h.Write([]byte{1})
+		}
+	}
+	return h.Sum64()
+}
@@ -0,0 +1,46 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// listingFormat picks how to answer a directory request from its Accept
+// header: "json", "text" or the usual "html". The first of these types the
+// client names wins, so browsers, which list text/html first, and clients
+// sending */* get the page.
+func listingFormat(r *http.Request) string {
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		switch mediaType {
+		case "application/json":
+			return "json"
+		case "text/plain":
+			return "text"
+		case "text/html", "application/xhtml+xml", "*/*":
+			return "html"
+		}
+	}
+	return "html"
+}
+
+// writeTextListing writes one "name<TAB>size" line per entry, with folders
+// marked by a trailing slash and "-" for their size
+func writeTextListing(w http.ResponseWriter, files []FileInfo) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	var b strings.Builder
+	for _, f := range files {
+		if f.IsDir {
+			fmt.Fprintf(&b, "%s/\t-\n", f.Name)
+		} else {
+			fmt.Fprintf(&b, "%s\t%d\n", f.Name, f.Size)
+		}
+	}
+	io.WriteString(w, b.String())
+}
@@ -0,0 +1,128 @@
+package server
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// listingSort is the order of a directory listing, from ?sort= (name, size
+// or modified), ?order= (asc or desc) and ?groupDirs=0 to mix folders in
+// with the files instead of listing them first
+type listingSort struct {
+	By        string
+	Desc      bool
+	GroupDirs bool
+}
+
+// defaultSort is directories first, then by name
+var defaultSort = listingSort{By: "name", GroupDirs: true}
+
+// parseListingSort reads the sort parameters, leaving unset ones at their
+// defaults
+func parseListingSort(query url.Values) (listingSort, error) {
+	s := defaultSort
+	switch by := query.Get("sort"); by {
+	case "":
+	case "name", "size", "modified":
+		s.By = by
+	default:
+		return defaultSort, fmt.Errorf("unknown sort %q, use name, size or modified", by)
+	}
+	switch order := query.Get("order"); order {
+	case "", "asc":
+	case "desc":
+		s.Desc = true
+	default:
+		return defaultSort, fmt.Errorf("unknown order %q, use asc or desc", order)
+	}
+	switch query.Get("groupDirs") {
+	case "", "1", "true":
+	case "0", "false":
+		s.GroupDirs = false
+	default:
+		return defaultSort, fmt.Errorf("groupDirs must be 0 or 1")
+	}
+	return s, nil
+}
+
+// sortEntry is what the listing comparator looks at
+type sortEntry struct {
+	name    string
+	isDir   bool
+	size    int64
+	modTime time.Time
+}
+
+func (f FileInfo) sortEntry() sortEntry {
+	return sortEntry{f.Name, f.IsDir, f.Size, f.ModTime}
+}
+
+func (f APIFileItem) sortEntry() sortEntry {
+	return sortEntry{f.Name, f.IsDir, f.Size, f.ModTime}
+}
+
+// less orders two entries. Ties fall back to the name so the order is stable
+// between requests, which paging relies on.
+func (s listingSort) less(a, b sortEntry) bool {
+	if s.GroupDirs && a.isDir != b.isDir {
+		return a.isDir
+	}
+	// A folder's size on disk says nothing about its contents
+	if a.isDir {
+		a.size = 0
+	}
+	if b.isDir {
+		b.size = 0
+	}
+
+	aName, bName := strings.ToLower(a.name), strings.ToLower(b.name)
+	var before, after bool
+	switch s.By {
+	case "size":
+		before, after = a.size < b.size, a.size > b.size
+	case "modified":
+		before, after = a.modTime.Before(b.modTime), a.modTime.After(b.modTime)
+	}
+	if !before && !after {
+		before, after = aName < bName, aName > bName
+	}
+	if s.Desc {
+		return after
+	}
+	return before
+}
+
+// SortLink is the query string a column header links to: the first click
+// sorts names A-Z and sizes and dates largest or newest first, the next
+// click reverses that
+func (p PageData) SortLink(by string) string {
+	desc := by != "name"
+	if p.Sort.By == by {
+		desc = !p.Sort.Desc
+	}
+	query := url.Values{"sort": {by}, "order": {"asc"}}
+	if desc {
+		query.Set("order", "desc")
+	}
+	if !p.Sort.GroupDirs {
+		query.Set("groupDirs", "0")
+	}
+	if p.FlatView {
+		query.Set("view", "all")
+	}
+	return "?" + query.Encode()
+}
+
+// SortIcon is the Font Awesome icon for a column header
+func (p PageData) SortIcon(by string) string {
+	switch {
+	case p.Sort.By != by:
+		return "fa-sort text-gray-300"
+	case p.Sort.Desc:
+		return "fa-sort-down"
+	default:
+		return "fa-sort-up"
+	}
+}
@@ -0,0 +1,281 @@
+package server
+
+import (
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"golang.org/x/net/websocket"
+)
+
+const (
+	maxLiveWatchers = 64 // open /api/ws connections at once
+	// livePollInterval re-reads the watched folder when fsnotify can't
+	// watch it, e.g. on a network mount or once inotify's limits are used up
+	livePollInterval = 5 * time.Second
+	liveWriteTimeout = 10 * time.Second
+)
+
+// liveEvent is one change pushed to /api/ws clients. Besides create,
+// delete and modify for entries of the watched folder, "watching" confirms
+// a folder switch and "error" rejects one.
+type liveEvent struct {
+	Type  string `json:"type"`
+	Path  string `json:"path"`
+	IsDir bool   `json:"isDir,omitempty"`
+}
+
+// liveWatchers tracks the /api/ws connections and which folder each one
+// shows. Each connection watches its folder with fsnotify, which catches
+// changes made outside goshare too; uploads, deletes and new folders made
+// through goshare also wake their watchers directly.
+type liveWatchers struct {
+	mu    sync.Mutex
+	conns map[*liveConn]bool
+}
+
+type liveConn struct {
+	dir  string        // clean URL path of the watched folder; guarded by liveWatchers.mu
+	poke chan struct{} // buffered; a value means "re-read now"
+}
+
+func newLiveWatchers() *liveWatchers {
+	return &liveWatchers{conns: make(map[*liveConn]bool)}
+}
+
+// add registers c unless the limit is reached
+func (l *liveWatchers) add(c *liveConn) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.conns) >= maxLiveWatchers {
+		return false
+	}
+	l.conns[c] = true
+	return true
+}
+
+func (l *liveWatchers) remove(c *liveConn) {
+	l.mu.Lock()
+	delete(l.conns, c)
+	l.mu.Unlock()
+}
+
+func (l *liveWatchers) watch(c *liveConn, dir string) {
+	l.mu.Lock()
+	c.dir = dir
+	l.mu.Unlock()
+}
+
+// changed wakes the connections watching the folder at cleanDir
+func (l *liveWatchers) changed(cleanDir string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for c := range l.conns {
+		if c.dir == cleanDir {
+			select {
+			case c.poke <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+// handleAPIWS upgrades GET /api/ws?path=<folder> to a WebSocket that
+// streams liveEvents for that folder. The client switches folders by
+// sending {"watch": "<folder>"}.
+func (fh *FileHandler) handleAPIWS(w http.ResponseWriter, r *http.Request) {
+	conn := &liveConn{poke: make(chan struct{}, 1)}
+	if !fh.live.add(conn) {
+		writeAPIError(w, http.StatusServiceUnavailable, "too many live connections")
+		return
+	}
+	defer fh.live.remove(conn)
+
+	websocket.Server{
+		Handshake: sameOriginHandshake,
+		Handler: func(ws *websocket.Conn) {
+			fh.serveLive(ws, conn, r.URL.Query().Get("path"))
+		},
+	}.ServeHTTP(w, r)
+}
+
+// sameOriginHandshake refuses WebSockets opened by other sites, which the
+// browser would otherwise let ride on the user's session cookie
+func sameOriginHandshake(config *websocket.Config, r *http.Request) error {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return nil // not a browser
+	}
+	u, err := url.Parse(origin)
+	if err != nil || !strings.EqualFold(u.Host, r.Host) {
+		return websocket.ErrBadWebSocketOrigin
+	}
+	config.Origin = u
+	return nil
+}
+
+func (fh *FileHandler) serveLive(ws *websocket.Conn, conn *liveConn, dir string) {
+	defer ws.Close()
+
+	// Folder switches arrive on their own goroutine; its exit means the
+	// client went away
+	switches := make(chan string)
+	gone, done := make(chan struct{}), make(chan struct{})
+	defer close(done)
+	go func() {
+		defer close(gone)
+		for {
+			var msg struct {
+				Watch string `json:"watch"`
+			}
+			if err := websocket.JSON.Receive(ws, &msg); err != nil {
+				return
+			}
+			select {
+			case switches <- msg.Watch:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	send := func(ev liveEvent) bool {
+		ws.SetWriteDeadline(time.Now().Add(liveWriteTimeout))
+		return websocket.JSON.Send(ws, ev) == nil
+	}
+
+	// A nil notifier or poll channel never fires; poll is only set while
+	// fsnotify can't watch the current folder
+	notifier, err := fsnotify.NewWatcher()
+	if err != nil {
+		notifier = nil
+	} else {
+		defer notifier.Close()
+	}
+	var notifyEvents <-chan fsnotify.Event
+	var notifyErrors <-chan error
+	if notifier != nil {
+		notifyEvents, notifyErrors = notifier.Events, notifier.Errors
+	}
+	var ticker *time.Ticker
+	var poll <-chan time.Time
+	defer func() {
+		if ticker != nil {
+			ticker.Stop()
+		}
+	}()
+
+	var current map[string]liveEntry
+	watchedFS := ""
+	watch := func(requested string) bool {
+		cleanPath, fsPath, ok := fh.resolvePath(requested)
+		if (!ok || fh.hiddenPath(cleanPath)) && !fh.isMountRoot(cleanPath) {
+			return send(liveEvent{Type: "error", Path: requested})
+		}
+		fh.live.watch(conn, cleanPath)
+		dir, current = cleanPath, fh.liveSnapshot(cleanPath, fsPath)
+
+		if notifier != nil && watchedFS != "" {
+			notifier.Remove(watchedFS)
+		}
+		watchedFS = ""
+		poll = nil
+		switch {
+		case fh.isMountRoot(cleanPath):
+			// the mounts don't change while running
+		case notifier != nil && notifier.Add(fsPath) == nil:
+			watchedFS = fsPath
+		default:
+			if ticker == nil {
+				ticker = time.NewTicker(livePollInterval)
+			}
+			poll = ticker.C
+		}
+		return send(liveEvent{Type: "watching", Path: cleanPath, IsDir: true})
+	}
+	if !watch(dir) {
+		return
+	}
+
+	for {
+		select {
+		case <-gone:
+			return
+		case requested := <-switches:
+			if !watch(requested) {
+				return
+			}
+			continue
+		case <-conn.poke:
+		case <-notifyEvents:
+		case <-notifyErrors:
+			// an overflowed queue may have dropped events; re-read anyway
+		case <-poll:
+		}
+
+		_, fsPath, _ := fh.resolvePath(dir)
+		next := fh.liveSnapshot(dir, fsPath)
+		for _, ev := range diffLive(dir, current, next) {
+			if !send(ev) {
+				return
+			}
+		}
+		current = next
+	}
+}
+
+// liveEntry is what a folder re-read compares
+type liveEntry struct {
+	isDir   bool
+	size    int64
+	modTime time.Time
+}
+
+// liveSnapshot reads the visible entries of a folder; a folder that can't
+// be read (deleted, say) reads as empty
+func (fh *FileHandler) liveSnapshot(cleanPath, fsPath string) map[string]liveEntry {
+	entries := make(map[string]liveEntry)
+	if fh.isMountRoot(cleanPath) {
+		return entries // the mounts don't change while running
+	}
+	dirEntries, err := os.ReadDir(fsPath)
+	if err != nil {
+		return entries
+	}
+	for _, e := range dirEntries {
+		if fh.hidden(e.Name()) || (!e.IsDir() && !fh.showsFile(e.Name())) || !fh.allowsLink(filepath.Join(fsPath, e.Name()), e.Type()) {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		entries[e.Name()] = liveEntry{isDir: e.IsDir(), size: info.Size(), modTime: info.ModTime()}
+	}
+	return entries
+}
+
+func diffLive(dir string, before, after map[string]liveEntry) []liveEvent {
+	var events []liveEvent
+	for name, a := range after {
+		b, existed := before[name]
+		switch {
+		case !existed:
+			events = append(events, liveEvent{Type: "create", Path: path.Join(dir, name), IsDir: a.isDir})
+		case b.isDir != a.isDir || b.size != a.size || !b.modTime.Equal(a.modTime):
+			events = append(events, liveEvent{Type: "modify", Path: path.Join(dir, name), IsDir: a.isDir})
+		}
+	}
+	for name, b := range before {
+		if _, exists := after[name]; !exists {
+			events = append(events, liveEvent{Type: "delete", Path: path.Join(dir, name), IsDir: b.isDir})
+		}
+	}
+	return events
+}
@@ -0,0 +1,37 @@
+package server
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+func TestLiveSeesChangesMadeOutsideGoshare(t *testing.T) {
+	fh := newTestHandler(t, "")
+	writeFile(t, fh, "docs/old.txt", "x")
+	srv := httptest.NewServer(fh)
+	defer srv.Close()
+
+	ws, err := websocket.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/api/ws?path=/docs", "", srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+	// Well inside livePollInterval, so only fsnotify can deliver the event
+	ws.SetReadDeadline(time.Now().Add(livePollInterval / 2))
+
+	var ev liveEvent
+	if err := websocket.JSON.Receive(ws, &ev); err != nil || ev.Type != "watching" || ev.Path != "/docs" {
+		t.Fatalf("first event = %+v (%v), want watching /docs", ev, err)
+	}
+	writeFile(t, fh, "docs/new.txt", "x")
+	if err := websocket.JSON.Receive(ws, &ev); err != nil {
+		t.Fatalf("no event for a file written to disk: %v", err)
+	}
+	if ev.Type != "create" || ev.Path != "/docs/new.txt" {
+		t.Errorf("event = %+v, want create /docs/new.txt", ev)
+	}
+}
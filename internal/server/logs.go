@@ -0,0 +1,249 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxLogLines bounds the in-memory log kept for /api/logs
+const maxLogLines = 500
+
+// logLine is one entry of the recent log
+type logLine struct {
+	ID   uint64    `json:"id"`
+	Time time.Time `json:"time"`
+	Text string    `json:"text"`
+}
+
+// logRing keeps the most recent log lines (server log output and one line
+// per request) and fans new ones out to live viewers
+type logRing struct {
+	mu      sync.Mutex
+	lines   []logLine // oldest first, at most maxLogLines
+	nextID  uint64
+	partial []byte // unterminated tail of the last Write
+	subs    map[chan logLine]struct{}
+}
+
+func newLogRing() *logRing {
+	return &logRing{subs: make(map[chan logLine]struct{})}
+}
+
+// Write makes the ring usable as a log.Logger output
+func (l *logRing) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	data := append(l.partial, p...)
+	for {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			break
+		}
+		l.addLocked(string(data[:i]))
+		data = data[i+1:]
+	}
+	l.partial = append([]byte(nil), data...)
+	return len(p), nil
+}
+
+// add records a single line
+func (l *logRing) add(text string) {
+	l.mu.Lock()
+	l.addLocked(text)
+	l.mu.Unlock()
+}
+
+func (l *logRing) addLocked(text string) {
+	l.nextID++
+	line := logLine{ID: l.nextID, Time: time.Now(), Text: text}
+	if len(l.lines) == maxLogLines {
+		copy(l.lines, l.lines[1:])
+		l.lines = l.lines[:maxLogLines-1]
+	}
+	l.lines = append(l.lines, line)
+	for ch := range l.subs {
+		select {
+		case ch <- line:
+		default: // a slow viewer misses lines rather than stalling the server
+		}
+	}
+}
+
+// subscribe returns the current backlog and a channel of new lines
+func (l *logRing) subscribe() ([]logLine, chan logLine) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	ch := make(chan logLine, 64)
+	l.subs[ch] = struct{}{}
+	return append([]logLine(nil), l.lines...), ch
+}
+
+func (l *logRing) unsubscribe(ch chan logLine) {
+	l.mu.Lock()
+	delete(l.subs, ch)
+	l.mu.Unlock()
+}
+
+// statusRecorder captures the response status for the request log while
+// still letting handlers stream
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64 // body bytes written
+}
+
+func (s *statusRecorder) WriteHeader(code int) {
+	if s.status == 0 {
+		s.status = code
+	}
+	s.ResponseWriter.WriteHeader(code)
+}
+
+func (s *statusRecorder) Write(p []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	n, err := s.ResponseWriter.Write(p)
+	s.bytes += int64(n)
+	return n, err
+}
+
+// Hijack hands the connection over for WebSockets
+func (s *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := s.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("connection can't be taken over")
+	}
+	s.status = http.StatusSwitchingProtocols
+	return h.Hijack()
+}
+
+func (s *statusRecorder) Flush() {
+	if f, ok := s.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// logRequests records one line per request in the recent log
+func (fh *FileHandler) logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		fh.logs.add(fmt.Sprintf("%s %s %s %d %s", fh.clientIP(r), r.Method, r.URL.Path, rec.status, time.Since(start).Round(time.Millisecond)))
+	})
+}
+
+// handleAPILogs serves the recent log as JSON (/api/logs), as a live
+// Server-Sent Events stream (/api/logs/stream) or as a viewer page
+// (/api/logs/view)
+func (fh *FileHandler) handleAPILogs(w http.ResponseWriter, r *http.Request) {
+	if !fh.isAdminRequest(r) {
+		writeAPIError(w, http.StatusForbidden, "logs are only available to logged-in users, or from this machine when no password is set")
+		return
+	}
+
+	switch strings.TrimPrefix(r.URL.Path, "/api/logs") {
+	case "", "/":
+		backlog, ch := fh.logs.subscribe()
+		fh.logs.unsubscribe(ch)
+		json.NewEncoder(w).Encode(backlog)
+	case "/stream":
+		fh.streamLogs(w, r)
+	case "/view":
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		logViewerPage.Execute(w, nil)
+	default:
+		writeAPIError(w, http.StatusNotFound, "no such log endpoint")
+	}
+}
+
+func (fh *FileHandler) streamLogs(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Accel-Buffering", "no") // keep reverse proxies from buffering
+
+	backlog, ch := fh.logs.subscribe()
+	defer fh.logs.unsubscribe(ch)
+
+	// A reconnecting EventSource says what it saw last; don't repeat it
+	lastID, _ := strconv.ParseUint(r.Header.Get("Last-Event-ID"), 10, 64)
+
+	send := func(line logLine) {
+		data, _ := json.Marshal(line)
+		fmt.Fprintf(w, "id: %d\ndata: %s\n\n", line.ID, data)
+	}
+	for _, line := range backlog {
+		if line.ID > lastID {
+			send(line)
+		}
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(30 * time.Second)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case line := <-ch:
+			send(line)
+			flusher.Flush()
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		case <-fh.shutdown:
+			return
+		}
+	}
+}
+
+var logViewerPage = template.Must(template.New("logs").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>GoShare - Live Log</title>
+    <link rel="icon" href="/favicon.ico">
+    <script src="https://cdn.tailwindcss.com"></script>
+</head>
+<body class="bg-gray-900 text-gray-100 min-h-screen">
+    <div class="p-4">
+        <div class="flex justify-between items-center mb-4">
+            <h1 class="text-xl font-semibold">GoShare Live Log</h1>
+            <span id="status" class="text-sm text-gray-400">Connecting...</span>
+        </div>
+        <pre id="log" class="text-xs font-mono whitespace-pre-wrap"></pre>
+    </div>
+    <script>
+        const log = document.getElementById('log');
+        const status = document.getElementById('status');
+        const source = new EventSource('/api/logs/stream');
+        source.onopen = () => { status.textContent = 'Live'; };
+        source.onerror = () => { status.textContent = 'Disconnected, retrying...'; };
+        source.onmessage = (e) => {
+            const line = JSON.parse(e.data);
+            const atBottom = window.innerHeight + window.scrollY >= document.body.offsetHeight - 20;
+            log.textContent += new Date(line.time).toLocaleTimeString() + '  ' + line.text + '\n';
+            if (atBottom) window.scrollTo(0, document.body.scrollHeight);
+        };
+    </script>
+</body>
+</html>`))
@@ -0,0 +1,129 @@
+package server
+
+import (
+	"encoding/json"
+	"html/template"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// maintenanceMode is the active maintenance notice; a nil pointer means the
+// share is open as usual
+type maintenanceMode struct {
+	Message string    `json:"message"`
+	Since   time.Time `json:"since"`
+}
+
+var maintenancePage = template.Must(template.New("maintenance").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>GoShare - Down for Maintenance</title>
+    <link rel="icon" href="/favicon.ico">
+    <script src="https://cdn.tailwindcss.com"></script>
+    <link rel="stylesheet" href="https://cdnjs.cloudflare.com/ajax/libs/font-awesome/6.0.0/css/all.min.css">
+</head>
+<body class="bg-gray-50 min-h-screen flex items-center justify-center">
+    <div class="max-w-md w-full p-8 text-center">
+        <i class="fas fa-tools text-4xl text-blue-600 mb-4"></i>
+        <h2 class="text-3xl font-bold text-gray-900">Down for Maintenance</h2>
+        <p class="mt-4 text-gray-600">{{if .Message}}{{.Message}}{{else}}The files are being reorganized. Please check back shortly.{{end}}</p>
+    </div>
+</body>
+</html>`))
+
+// maintenanceMiddleware answers every request with 503 while maintenance is
+// on, except the endpoints needed to log in and switch it back off, the
+// connectivity check and the operator, who keeps working on the files
+func (fh *FileHandler) maintenanceMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mode := fh.maintenance.Load()
+		if mode == nil || fh.isOperatorRequest(r) || r.URL.Path == "/api/maintenance" || r.URL.Path == "/login" || r.URL.Path == "/favicon.ico" || r.URL.Path == "/ping" || r.URL.Path == "/readyz" || r.URL.Path == "/api/health" || r.URL.Path == "/metrics" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("Retry-After", "60")
+		if strings.HasPrefix(r.URL.Path, "/api/") {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"error":       newAPIError(http.StatusServiceUnavailable, "the share is down for maintenance"),
+				"maintenance": true,
+				"message":     mode.Message,
+			})
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		maintenancePage.Execute(w, mode)
+	})
+}
+
+// handleAPIMaintenance reports (GET) or switches (POST {"on":..,"message":..})
+// maintenance mode
+func (fh *FileHandler) handleAPIMaintenance(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		// Only the operator may flip the switch; other logged-in visitors
+		// are exactly who maintenance keeps out
+		if !fh.isOperatorRequest(r) {
+			writeAPIError(w, http.StatusForbidden, "maintenance mode can only be toggled from the machine running goshare")
+			return
+		}
+
+		var req struct {
+			On      bool   `json:"on"`
+			Message string `json:"message"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeAPIError(w, http.StatusBadRequest, "invalid JSON body")
+			return
+		}
+		if req.On {
+			fh.maintenance.Store(&maintenanceMode{Message: req.Message, Since: time.Now()})
+		} else {
+			fh.maintenance.Store(nil)
+		}
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		writeAPIError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	mode := fh.maintenance.Load()
+	resp := map[string]interface{}{"on": mode != nil}
+	if mode != nil {
+		resp["message"] = mode.Message
+		resp["since"] = mode.Since
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+// isOperatorRequest reports whether r comes from the person running
+// goshare: from this machine, and logged in when the share has a password.
+// Unlike isAdminRequest, being logged in alone isn't enough, since on a
+// protected share every visitor is.
+func (fh *FileHandler) isOperatorRequest(r *http.Request) bool {
+	return isLoopbackRequest(r) && fh.isAuthenticated(r)
+}
+
+// isLoopbackRequest reports whether the request came from this machine.
+// Tunnels like ngrok also connect from localhost, so anything carrying a
+// forwarding header doesn't count.
+func isLoopbackRequest(r *http.Request) bool {
+	if r.Header.Get("X-Forwarded-For") != "" || r.Header.Get("Forwarded") != "" {
+		return false
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
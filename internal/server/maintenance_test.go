@@ -0,0 +1,113 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// maintenanceRequest builds a request from the client at remoteAddr,
+// optionally logged in with the password
+func maintenanceRequest(method, target, body, remoteAddr, password string) *http.Request {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.RemoteAddr = remoteAddr
+	if password != "" {
+		req.SetBasicAuth("", password)
+	}
+	return req
+}
+
+const (
+	remoteClient = "192.0.2.7:4321"
+	localClient  = "127.0.0.1:4321"
+)
+
+func TestMaintenanceNeedsOperator(t *testing.T) {
+	fh := newTestHandler(t, "hunter2")
+	h := fh.maintenanceMiddleware(fh)
+
+	// Being logged in from elsewhere isn't enough
+	for _, password := range []string{"", "hunter2"} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, maintenanceRequest(http.MethodPost, "/api/maintenance", `{"on":true}`, remoteClient, password))
+		if rec.Code != http.StatusForbidden || fh.maintenance.Load() != nil {
+			t.Fatalf("remote POST /api/maintenance (password %q) = %d, want 403 and no maintenance", password, rec.Code)
+		}
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, maintenanceRequest(http.MethodPost, "/api/maintenance", `{"on":true}`, localClient, ""))
+	if rec.Code != http.StatusForbidden || fh.maintenance.Load() != nil {
+		t.Fatalf("local POST /api/maintenance without the password = %d, want 403", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, maintenanceRequest(http.MethodPost, "/api/maintenance", `{"on":true,"message":"moving"}`, localClient, "hunter2"))
+	if rec.Code != http.StatusOK || fh.maintenance.Load() == nil {
+		t.Fatalf("operator POST /api/maintenance = %d, want 200 and maintenance on", rec.Code)
+	}
+
+	// Visitors get the notice, logged in or not; the operator keeps working
+	for _, password := range []string{"", "hunter2"} {
+		rec = httptest.NewRecorder()
+		h.ServeHTTP(rec, maintenanceRequest(http.MethodGet, "/api/files", "", remoteClient, password))
+		if rec.Code != http.StatusServiceUnavailable {
+			t.Errorf("remote GET /api/files (password %q) during maintenance = %d, want 503", password, rec.Code)
+		}
+	}
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, maintenanceRequest(http.MethodGet, "/api/files", "", localClient, "hunter2"))
+	if rec.Code != http.StatusOK {
+		t.Errorf("operator GET /api/files during maintenance = %d, want 200", rec.Code)
+	}
+
+	// A tunnel connects from localhost too, but it forwards someone else
+	req := maintenanceRequest(http.MethodGet, "/api/files", "", localClient, "hunter2")
+	req.Header.Set("X-Forwarded-For", "198.51.100.4")
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("tunnelled GET /api/files during maintenance = %d, want 503", rec.Code)
+	}
+}
+
+func TestMaintenanceOpenShareLoopbackOnly(t *testing.T) {
+	fh := newTestHandler(t, "")
+	h := fh.maintenanceMiddleware(fh)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, maintenanceRequest(http.MethodPost, "/api/maintenance", `{"on":true}`, remoteClient, ""))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("remote POST /api/maintenance on an open share = %d, want 403", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, maintenanceRequest(http.MethodPost, "/api/maintenance", `{"on":true}`, localClient, ""))
+	if rec.Code != http.StatusOK || fh.maintenance.Load() == nil {
+		t.Errorf("local POST /api/maintenance = %d, want 200 and maintenance on", rec.Code)
+	}
+}
+
+func TestInfoReportsMaintenance(t *testing.T) {
+	fh := newTestHandler(t, "")
+	info := func() map[string]json.RawMessage {
+		rec := httptest.NewRecorder()
+		fh.ServeHTTP(rec, maintenanceRequest(http.MethodGet, "/api/info", "", localClient, ""))
+		var body map[string]json.RawMessage
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || rec.Code != http.StatusOK {
+			t.Fatalf("GET /api/info = %d: %s", rec.Code, rec.Body)
+		}
+		return body
+	}
+
+	if got := string(info()["maintenance"]); got != "null" {
+		t.Errorf("maintenance = %s before it was switched on, want null", got)
+	}
+	rec := httptest.NewRecorder()
+	fh.ServeHTTP(rec, maintenanceRequest(http.MethodPost, "/api/maintenance", `{"on":true,"message":"back in 10"}`, localClient, ""))
+	var mode maintenanceMode
+	if err := json.Unmarshal(info()["maintenance"], &mode); err != nil || mode.Message != "back in 10" || mode.Since.IsZero() {
+		t.Errorf("maintenance = %+v (%v), want the notice", mode, err)
+	}
+}
@@ -0,0 +1,130 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// mdnsGroup is the multicast DNS address every .local lookup goes to
+const mdnsGroup = "224.0.0.251:5353"
+
+// mdnsTTL is how long resolvers may cache our address, in seconds
+const mdnsTTL = 120
+
+// mdnsHostPattern is what --mdns-name may look like: one DNS label
+var mdnsHostPattern = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9-]{0,61}[A-Za-z0-9])?$`)
+
+// mdnsResponder answers multicast DNS lookups of <name>.local with the LAN
+// address, so the share can be opened by name instead of by IP
+type mdnsResponder struct {
+	conn  *net.UDPConn
+	group *net.UDPAddr
+	name  dnsmessage.Name
+	ip    [4]byte
+}
+
+// startMDNS begins answering for host.local with ip and announces it, on
+// ifi or the system's default multicast interface when ifi is nil
+func startMDNS(host, ip string, ifi *net.Interface) (*mdnsResponder, error) {
+	if !mdnsHostPattern.MatchString(host) {
+		return nil, fmt.Errorf("%q is not a valid host name", host)
+	}
+	v4 := net.ParseIP(ip).To4()
+	if v4 == nil {
+		return nil, fmt.Errorf("no IPv4 address to advertise")
+	}
+	name, err := dnsmessage.NewName(strings.ToLower(host) + ".local.")
+	if err != nil {
+		return nil, err
+	}
+	group, err := net.ResolveUDPAddr("udp4", mdnsGroup)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.ListenMulticastUDP("udp4", ifi, group)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &mdnsResponder{conn: conn, group: group, name: name}
+	copy(m.ip[:], v4)
+	go m.serve()
+	m.send(m.group, dnsmessage.Header{}, nil, mdnsTTL)
+	return m, nil
+}
+
+// Name is the advertised host name, e.g. "goshare.local"
+func (m *mdnsResponder) Name() string {
+	return strings.TrimSuffix(m.name.String(), ".")
+}
+
+// Close says goodbye, so resolvers drop the cached address, and stops
+// answering
+func (m *mdnsResponder) Close() error {
+	m.send(m.group, dnsmessage.Header{}, nil, 0)
+	return m.conn.Close()
+}
+
+func (m *mdnsResponder) serve() {
+	buf := make([]byte, 9000)
+	for {
+		n, src, err := m.conn.ReadFromUDP(buf)
+		if err != nil {
+			return // closed
+		}
+		var p dnsmessage.Parser
+		header, err := p.Start(buf[:n])
+		if err != nil || header.Response {
+			continue
+		}
+		questions, err := p.AllQuestions()
+		if err != nil {
+			continue
+		}
+		for _, q := range questions {
+			if (q.Type != dnsmessage.TypeA && q.Type != dnsmessage.TypeALL) || !strings.EqualFold(q.Name.String(), m.name.String()) {
+				continue
+			}
+			// Queries from a port other than 5353 are plain DNS clients
+			// that expect a unicast reply echoing their ID and question
+			if src.Port != m.group.Port {
+				q.Class &^= 1 << 15
+				m.send(src, dnsmessage.Header{ID: header.ID}, []dnsmessage.Question{q}, mdnsTTL)
+			} else if q.Class&(1<<15) != 0 {
+				m.send(src, dnsmessage.Header{}, nil, mdnsTTL) // asked for a unicast reply
+			} else {
+				m.send(m.group, dnsmessage.Header{}, nil, mdnsTTL)
+			}
+			break
+		}
+	}
+}
+
+// send writes an authoritative answer with our address to dst
+func (m *mdnsResponder) send(dst *net.UDPAddr, header dnsmessage.Header, questions []dnsmessage.Question, ttl uint32) {
+	header.Response = true
+	header.Authoritative = true
+	class := dnsmessage.ClassINET
+	if dst == m.group {
+		class |= 1 << 15 // cache-flush: this is the only address for the name
+	}
+	msg := dnsmessage.Message{
+		Header:    header,
+		Questions: questions,
+		Answers: []dnsmessage.Resource{{
+			Header: dnsmessage.ResourceHeader{Name: m.name, Type: dnsmessage.TypeA, Class: class, TTL: ttl},
+			Body:   &dnsmessage.AResource{A: m.ip},
+		}},
+	}
+	packed, err := msg.Pack()
+	if err != nil {
+		log.Printf("mDNS: %v", err)
+		return
+	}
+	m.conn.WriteToUDP(packed, dst)
+}
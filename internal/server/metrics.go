@@ -0,0 +1,127 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// metrics counts traffic for the --metrics endpoint. They are written in
+// the Prometheus text format by hand, which a few counters don't need a
+// client library for. A nil *metrics records nothing.
+type metrics struct {
+	started  time.Time
+	inFlight atomic.Int64
+
+	mu       sync.Mutex
+	requests map[int]uint64 // by status code
+
+	fileDownloads    atomic.Uint64
+	archiveDownloads atomic.Uint64
+	downloadedBytes  atomic.Uint64
+	uploads          atomic.Uint64
+	uploadedBytes    atomic.Uint64
+}
+
+func newMetrics(enabled bool) *metrics {
+	if !enabled {
+		return nil
+	}
+	return &metrics{started: time.Now(), requests: make(map[int]uint64)}
+}
+
+// countRequests tracks requests in flight and their status codes
+func (m *metrics) countRequests(next http.Handler) http.Handler {
+	if m == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.inFlight.Add(1)
+		defer m.inFlight.Add(-1)
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		m.mu.Lock()
+		m.requests[rec.status]++
+		m.mu.Unlock()
+	})
+}
+
+// fileServed records a file download; rec wrapped the response
+func (m *metrics) fileServed(rec *statusRecorder) {
+	if m == nil {
+		return
+	}
+	if rec.status == http.StatusOK || rec.status == http.StatusPartialContent {
+		m.fileDownloads.Add(1)
+	}
+	m.downloadedBytes.Add(uint64(rec.bytes))
+}
+
+// archiveServed records a zip or tar.gz download; rec wrapped the response
+func (m *metrics) archiveServed(rec *statusRecorder) {
+	if m == nil {
+		return
+	}
+	if rec.bytes > 0 {
+		m.archiveDownloads.Add(1)
+	}
+	m.downloadedBytes.Add(uint64(rec.bytes))
+}
+
+// uploaded records one stored upload of size bytes
+func (m *metrics) uploaded(size int64) {
+	if m == nil {
+		return
+	}
+	m.uploads.Add(1)
+	m.uploadedBytes.Add(uint64(size))
+}
+
+// handleMetrics serves /metrics. With a password the scraper has to log in
+// (basic auth works); without one it is as open as the files are.
+func (fh *FileHandler) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if !fh.isAuthenticated(r) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="goshare"`)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	m := fh.metrics
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+
+	metric := func(name, kind, help string) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+	}
+
+	metric("goshare_requests_total", "counter", "HTTP requests answered, by status code.")
+	m.mu.Lock()
+	codes := make([]int, 0, len(m.requests))
+	for code := range m.requests {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+	for _, code := range codes {
+		fmt.Fprintf(w, "goshare_requests_total{code=\"%d\"} %d\n", code, m.requests[code])
+	}
+	m.mu.Unlock()
+
+	metric("goshare_requests_in_flight", "gauge", "HTTP requests being served right now.")
+	fmt.Fprintf(w, "goshare_requests_in_flight %d\n", m.inFlight.Load())
+	metric("goshare_downloads_total", "counter", "Downloads started, by kind.")
+	fmt.Fprintf(w, "goshare_downloads_total{kind=\"file\"} %d\n", m.fileDownloads.Load())
+	fmt.Fprintf(w, "goshare_downloads_total{kind=\"archive\"} %d\n", m.archiveDownloads.Load())
+	metric("goshare_downloaded_bytes_total", "counter", "Bytes sent for file and archive downloads.")
+	fmt.Fprintf(w, "goshare_downloaded_bytes_total %d\n", m.downloadedBytes.Load())
+	metric("goshare_uploads_total", "counter", "Files stored from uploads.")
+	fmt.Fprintf(w, "goshare_uploads_total %d\n", m.uploads.Load())
+	metric("goshare_uploaded_bytes_total", "counter", "Bytes of files stored from uploads.")
+	fmt.Fprintf(w, "goshare_uploaded_bytes_total %d\n", m.uploadedBytes.Load())
+	metric("goshare_start_time_seconds", "gauge", "Unix time the server started.")
+	fmt.Fprintf(w, "goshare_start_time_seconds %d\n", m.started.Unix())
+}
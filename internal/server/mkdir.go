@@ -0,0 +1,87 @@
+package server
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// handleAPIMkdir creates a folder for POST /api/mkdir with a JSON body of
+// {"path": "/new/folder"}. Like uploads it needs a folder that accepts them
+// (and its upload password, if any) and is refused with --read-only.
+func (fh *FileHandler) handleAPIMkdir(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeAPIError(w, http.StatusMethodNotAllowed, "use POST")
+		return
+	}
+	if fh.readOnly {
+		writeAPIError(w, http.StatusForbidden, "this share is read-only")
+		return
+	}
+
+	var req struct {
+		Path           string `json:"path"`
+		UploadPassword string `json:"upload_password"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<16)).Decode(&req); err != nil || req.Path == "" {
+		writeAPIError(w, http.StatusBadRequest, `expected {"path": "/new/folder"}`)
+		return
+	}
+
+	cleanPath, fsPath, ok := fh.resolvePath(req.Path)
+	if !ok {
+		writeAPIError(w, http.StatusForbidden, "path is outside the share")
+		return
+	}
+	if strings.Contains(cleanPath, "/.") {
+		writeAPIError(w, http.StatusBadRequest, "folder names can't start with a dot")
+		return
+	}
+
+	parent := filepath.Dir(cleanPath)
+	rule := fh.uploadRuleFor(parent)
+	if !fh.uploadAllowed(parent, rule) {
+		writeAPIError(w, http.StatusForbidden, "creating folders is not allowed here")
+		return
+	}
+	if !rule.checkUploadPassword(req.UploadPassword) {
+		writeAPIError(w, http.StatusForbidden, "wrong upload password for this folder")
+		return
+	}
+
+	status := http.StatusCreated
+	if info, err := os.Stat(fsPath); err == nil {
+		if !info.IsDir() {
+			writeAPIError(w, http.StatusConflict, cleanPath+" already exists as a file")
+			return
+		}
+		status = http.StatusOK
+	}
+	if err := os.MkdirAll(fsPath, 0755); err != nil {
+		log.Printf("Could not create %s: %v", fsPath, err)
+		writeAPIError(w, http.StatusInternalServerError, "could not create "+cleanPath)
+		return
+	}
+	info, err := os.Stat(fsPath)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, "could not create "+cleanPath)
+		return
+	}
+
+	if status == http.StatusCreated {
+		fh.audit(r, "http", "mkdir", filepath.ToSlash(cleanPath), "", 0)
+	}
+	fh.live.changed(parent)
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(APIFileItem{
+		Name:    info.Name(),
+		Path:    cleanPath,
+		Size:    info.Size(),
+		IsDir:   true,
+		ModTime: info.ModTime(),
+	})
+}
@@ -0,0 +1,209 @@
+package server
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/image/webp"
+)
+
+const (
+	maxMontageImages  = 100  // images beyond this are left out of the grid
+	maxMontageCols    = 10   // widest grid allowed via ?cols=
+	defaultMontageCol = 5    // grid width when ?cols= is missing
+	montageTile       = 160  // edge of each square grid cell, in pixels
+	maxMontagePixels  = 50e6 // skip images that would take too much memory to decode
+	maxCachedMontages = 16
+)
+
+// Montages are slow to build, so only one is built at a time and finished
+// ones are kept, keyed by the directory's image listing
+var (
+	montageSlots = make(chan struct{}, 1)
+	montageCache = newListingCache(maxCachedMontages)
+)
+
+// montageDecoders are the formats the standard library and x/image can
+// decode
+var montageDecoders = map[string]func(*os.File) (image.Image, error){
+	".jpg":  func(f *os.File) (image.Image, error) { return jpeg.Decode(f) },
+	".jpeg": func(f *os.File) (image.Image, error) { return jpeg.Decode(f) },
+	".png":  func(f *os.File) (image.Image, error) { return png.Decode(f) },
+	".gif":  func(f *os.File) (image.Image, error) { return gif.Decode(f) },
+	".webp": func(f *os.File) (image.Image, error) { return webp.Decode(f) },
+}
+
+// handleAPIMontage serves one JPEG with a grid of thumbnails of every image
+// in ?path=, for a quick look at a photo folder. ?cols= sets the grid width.
+func (fh *FileHandler) handleAPIMontage(w http.ResponseWriter, r *http.Request) {
+	cleanPath, fsPath, ok := fh.resolvePath(r.URL.Query().Get("path"))
+	if !ok {
+		writeAPIError(w, http.StatusForbidden, "access denied")
+		return
+	}
+	if fh.hiddenPath(cleanPath) {
+		writeAPIError(w, http.StatusNotFound, "no such folder")
+		return
+	}
+	cols := defaultMontageCol
+	if value := r.URL.Query().Get("cols"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxMontageCols {
+			writeAPIError(w, http.StatusBadRequest, "cols must be between 1 and "+strconv.Itoa(maxMontageCols))
+			return
+		}
+		cols = n
+	}
+
+	entries, err := os.ReadDir(fsPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			writeAPIError(w, http.StatusNotFound, "no such folder")
+		} else {
+			writeAPIError(w, http.StatusInternalServerError, "cannot read directory")
+		}
+		return
+	}
+
+	var images []FileInfo
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || fh.hidden(name) || !fh.showsFile(name) || !fh.allowsLink(filepath.Join(fsPath, name), entry.Type()) {
+			continue
+		}
+		if _, ok := montageDecoders[strings.ToLower(filepath.Ext(name))]; !ok {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		images = append(images, FileInfo{Name: name, Size: info.Size(), ModTime: info.ModTime()})
+	}
+	if len(images) == 0 {
+		writeAPIError(w, http.StatusNotFound, "no images in this folder")
+		return
+	}
+	sort.Slice(images, func(i, j int) bool {
+		return strings.ToLower(images[i].Name) < strings.ToLower(images[j].Name)
+	})
+	if len(images) > maxMontageImages {
+		images = images[:maxMontageImages]
+	}
+
+	key := cleanPath + "?cols=" + strconv.Itoa(cols)
+	hash := hashListing(images)
+	if page, ok := montageCache.get(key, hash); ok {
+		writeMontage(w, page)
+		return
+	}
+
+	select {
+	case montageSlots <- struct{}{}:
+		defer func() { <-montageSlots }()
+	case <-r.Context().Done():
+		return
+	}
+
+	out, err := buildMontage(fsPath, images, cols)
+	if err != nil {
+		log.Printf("Montage of %s failed: %v", fsPath, err)
+		writeAPIError(w, http.StatusInternalServerError, "could not build montage")
+		return
+	}
+	montageCache.put(key, hash, out)
+	writeMontage(w, out)
+}
+
+func writeMontage(w http.ResponseWriter, jpg []byte) {
+	w.Header().Set("Content-Type", "image/jpeg")
+	w.Header().Set("Content-Length", strconv.Itoa(len(jpg)))
+	w.Write(jpg)
+}
+
+// buildMontage draws each image scaled into its own grid cell and encodes
+// the grid as a JPEG. Images that can't be decoded leave an empty cell.
+func buildMontage(dir string, images []FileInfo, cols int) ([]byte, error) {
+	if cols > len(images) {
+		cols = len(images)
+	}
+	rows := (len(images) + cols - 1) / cols
+	grid := image.NewRGBA(image.Rect(0, 0, cols*montageTile, rows*montageTile))
+	draw.Draw(grid, grid.Bounds(), &image.Uniform{color.Gray{0xee}}, image.Point{}, draw.Src)
+
+	for i, img := range images {
+		src, err := decodeForMontage(filepath.Join(dir, img.Name))
+		if err != nil {
+			continue
+		}
+		cell := image.Rect(0, 0, montageTile, montageTile).Add(image.Pt(i%cols*montageTile, i/cols*montageTile))
+		drawScaled(grid, cell, src)
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, grid, &jpeg.Options{Quality: 80}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func decodeForMontage(path string) (image.Image, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	// Check the dimensions first so a huge image can't exhaust memory
+	cfg, _, err := image.DecodeConfig(f)
+	if err != nil {
+		return nil, err
+	}
+	if float64(cfg.Width)*float64(cfg.Height) > maxMontagePixels {
+		return nil, image.ErrFormat
+	}
+	if _, err := f.Seek(0, 0); err != nil {
+		return nil, err
+	}
+	return montageDecoders[strings.ToLower(filepath.Ext(path))](f)
+}
+
+// drawScaled fits src inside cell, keeping its aspect ratio, using
+// nearest-neighbour sampling
+func drawScaled(dst *image.RGBA, cell image.Rectangle, src image.Image) {
+	sb := src.Bounds()
+	if sb.Dx() == 0 || sb.Dy() == 0 {
+		return
+	}
+	scale := float64(cell.Dx()) / float64(sb.Dx())
+	if s := float64(cell.Dy()) / float64(sb.Dy()); s < scale {
+		scale = s
+	}
+	if scale > 1 {
+		scale = 1 // don't blow up small images
+	}
+	w, h := int(float64(sb.Dx())*scale), int(float64(sb.Dy())*scale)
+	if w == 0 || h == 0 {
+		return
+	}
+	offset := cell.Min.Add(image.Pt((cell.Dx()-w)/2, (cell.Dy()-h)/2))
+	for y := 0; y < h; y++ {
+		sy := sb.Min.Y + int(float64(y)/scale)
+		for x := 0; x < w; x++ {
+			sx := sb.Min.X + int(float64(x)/scale)
+			dst.Set(offset.X+x, offset.Y+y, src.At(sx, sy))
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package server
+
+import (
+	"image/jpeg"
+	"net/http"
+	"testing"
+)
+
+func TestMontage(t *testing.T) {
+	fh := newTestHandler(t, "")
+	for _, name := range []string{"a.png", "b.png", "c.png"} {
+		writePNG(t, fh, "photos/"+name, 40, 30)
+	}
+	writeFile(t, fh, "photos/readme.txt", "not an image")
+	writePNG(t, fh, ".private/d.png", 10, 10)
+
+	rec := do(fh, http.MethodGet, "/api/montage?path=/photos&cols=2")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("montage of /photos = %d, want 200", rec.Code)
+	}
+	img, err := jpeg.Decode(rec.Body)
+	if err != nil {
+		t.Fatalf("the montage is not a JPEG: %v", err)
+	}
+	// Three images in two columns make a 2x2 grid
+	if b := img.Bounds(); b.Dx() != 2*montageTile || b.Dy() != 2*montageTile {
+		t.Errorf("montage is %dx%d, want %dx%d", b.Dx(), b.Dy(), 2*montageTile, 2*montageTile)
+	}
+
+	for target, want := range map[string]int{
+		"/api/montage?path=/photos&cols=11": http.StatusBadRequest,
+		"/api/montage?path=/.private":       http.StatusNotFound,
+		"/api/montage?path=/missing":        http.StatusNotFound,
+	} {
+		if rec := do(fh, http.MethodGet, target); rec.Code != want {
+			t.Errorf("GET %s = %d, want %d", target, rec.Code, want)
+		}
+	}
+}
+
+func TestMontageNeedsLogin(t *testing.T) {
+	fh := newTestHandler(t, "hunter2")
+	writePNG(t, fh, "photo.png", 10, 10)
+	if rec := do(protectedHandler(fh), http.MethodGet, "/api/montage?path=/"); rec.Code != http.StatusUnauthorized {
+		t.Errorf("GET /api/montage without a login = %d, want 401", rec.Code)
+	}
+}
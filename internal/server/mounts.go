@@ -0,0 +1,177 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// mountNamePattern is what a name before the colon in "-d name:path" may look
+// like. Single letters are excluded so Windows paths like C:\share still work.
+var mountNamePattern = regexp.MustCompile(`^[A-Za-z0-9._-]{2,}$`)
+
+// reservedMountNames would shadow GoShare's own routes
+var reservedMountNames = map[string]bool{
+	"api": true, "login": true, "upload": true, "ping": true, "readyz": true,
+	"debug": true, "files": true, "static": true, "favicon.ico": true,
+}
+
+// parseMounts turns the -d values into absolute directories keyed by mount
+// name. A single value without a name returns a nil map and the directory
+// for the classic single-root share. Unnamed values among several are
+// mounted under their base name.
+func parseMounts(specs []string) (string, map[string]string, error) {
+	if len(specs) == 0 {
+		specs = []string{"."}
+	}
+	if len(specs) == 1 {
+		if name, _, ok := strings.Cut(specs[0], ":"); !ok || !mountNamePattern.MatchString(name) {
+			absDir, err := filepath.Abs(specs[0])
+			return absDir, nil, err
+		}
+	}
+
+	mounts := make(map[string]string, len(specs))
+	for _, spec := range specs {
+		name, dir, ok := strings.Cut(spec, ":")
+		if !ok || !mountNamePattern.MatchString(name) {
+			name, dir = "", spec
+		}
+		absDir, err := filepath.Abs(dir)
+		if err != nil {
+			return "", nil, err
+		}
+		if name == "" {
+			name = filepath.Base(absDir)
+		}
+		if strings.HasPrefix(name, ".") || reservedMountNames[strings.ToLower(name)] {
+			return "", nil, fmt.Errorf("%q can't be used as a mount name", name)
+		}
+		if _, dup := mounts[name]; dup {
+			return "", nil, fmt.Errorf("mount name %q is used twice", name)
+		}
+		mounts[name] = absDir
+	}
+	return "", mounts, nil
+}
+
+// isMountRoot reports whether cleanPath is the virtual folder that lists the
+// mounts. It has no directory on disk, so resolvePath rejects it.
+func (fh *FileHandler) isMountRoot(cleanPath string) bool {
+	return fh.mounts != nil && cleanPath == "/"
+}
+
+// rootFor splits a clean URL path into the directory it lives in and the
+// remainder below that directory
+func (fh *FileHandler) rootFor(cleanPath string) (root, rest string, ok bool) {
+	rest = strings.TrimPrefix(cleanPath, "/")
+	if fh.mounts == nil {
+		return fh.rootDir, rest, true
+	}
+	name, rest, _ := strings.Cut(rest, "/")
+	root, ok = fh.mounts[name]
+	return root, rest, ok
+}
+
+// urlPathFor maps a filesystem path back to its URL path in the share
+func (fh *FileHandler) urlPathFor(fsPath string) (string, bool) {
+	if fh.mounts == nil {
+		rel, err := filepath.Rel(fh.rootDir, fsPath)
+		if err != nil || !insideRel(rel) {
+			return "", false
+		}
+		return "/" + filepath.ToSlash(rel), true
+	}
+	for name, root := range fh.mounts {
+		if rel, err := filepath.Rel(root, fsPath); err == nil && insideRel(rel) {
+			return "/" + filepath.ToSlash(filepath.Join(name, rel)), true
+		}
+	}
+	return "", false
+}
+
+// insideRel reports whether a filepath.Rel result stays below its base
+func insideRel(rel string) bool {
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// withinDir reports whether the clean path p is dir itself or lies below
+// it. Going through filepath.Rel keeps /srv/share-secret out of /srv/share
+// and still works when dir is the filesystem root.
+func withinDir(dir, p string) bool {
+	rel, err := filepath.Rel(dir, p)
+	return err == nil && insideRel(rel)
+}
+
+// mountNames returns the mount names in display order
+func (fh *FileHandler) mountNames() []string {
+	names := make([]string, 0, len(fh.mounts))
+	for name := range fh.mounts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// mountListing lists the mounts as the folders of the virtual root
+func (fh *FileHandler) mountListing() []FileInfo {
+	var files []FileInfo
+	for _, name := range fh.mountNames() {
+		info, err := os.Stat(fh.mounts[name])
+		if err != nil || !info.IsDir() {
+			continue
+		}
+		files = append(files, FileInfo{
+			Name:    name,
+			Path:    "/" + name,
+			Size:    info.Size(),
+			ModTime: info.ModTime(),
+			IsDir:   true,
+			Icon:    getFileIcon(name, true),
+			SizeStr: formatFileSize(info.Size(), true),
+		})
+	}
+	return files
+}
+
+// serveMountRoot renders the virtual root. Only the listing and its QR code
+// make sense here; there is no single folder to archive.
+func (fh *FileHandler) serveMountRoot(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.URL.Query().Get("qr") == "1":
+		fh.serveQRCode(w, r, "/")
+	case r.URL.Query().Get("download") != "":
+		http.Error(w, "Pick one of the shared folders to download", http.StatusBadRequest)
+	default:
+		fh.serveDirectory(w, r, "", "/")
+	}
+}
+
+// serveAPIMountRoot answers /api/files for the virtual root
+func (fh *FileHandler) serveAPIMountRoot(w http.ResponseWriter) {
+	var files []APIFileItem
+	for _, f := range fh.mountListing() {
+		files = append(files, APIFileItem{
+			Name:    f.Name,
+			Path:    f.Path,
+			Size:    f.Size,
+			IsDir:   true,
+			ModTime: f.ModTime,
+		})
+	}
+	json.NewEncoder(w).Encode(APIPageData{
+		Title:       fh.branding.pageTitle(),
+		CurrentPath: "/",
+		ParentPath:  "/",
+		Files:       files,
+		ServerURL:   fh.serverURL,
+		Heading:     fh.branding.heading(),
+		Brand:       fh.branding.brand,
+		LogoURL:     fh.branding.logoURL,
+	})
+}
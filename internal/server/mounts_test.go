@@ -0,0 +1,66 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWithinDir(t *testing.T) {
+	for _, c := range []struct {
+		dir, p string
+		want   bool
+	}{
+		{"/srv/share", "/srv/share", true},
+		{"/srv/share", "/srv/share/a/b.txt", true},
+		{"/srv/share", "/srv/share-secret", false},
+		{"/srv/share", "/srv/share-secret/key.pem", false},
+		{"/srv/share", "/srv/shar", false},
+		{"/srv/share", "/srv", false},
+		{"/srv/share", "/srv/share/..hidden", true},
+		{"/", "/etc/passwd", true},
+	} {
+		if got := withinDir(filepath.FromSlash(c.dir), filepath.FromSlash(c.p)); got != c.want {
+			t.Errorf("withinDir(%s, %s) = %v, want %v", c.dir, c.p, got, c.want)
+		}
+	}
+}
+
+func TestSiblingDirectoryStaysOutside(t *testing.T) {
+	fh := newTestHandler(t, "")
+	parent := fh.rootDir
+	fh.rootDir = filepath.Join(parent, "share")
+	writeFile(t, fh, "inbox/keep.txt", "x")
+	secret := filepath.Join(parent, "share-secret")
+	if err := os.MkdirAll(secret, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(secret, "key.pem"), []byte("secret"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(secret, filepath.Join(fh.rootDir, "secret")); err != nil {
+		t.Skip("symlinks not supported:", err)
+	}
+
+	// A link into share-secret resolves to a path sharing the root's prefix
+	for _, target := range []string{"/secret/key.pem", "/secret/", "/api/files?path=/secret"} {
+		if rec := do(fh, http.MethodGet, target); rec.Code == http.StatusOK {
+			t.Errorf("GET %s = 200, served the sibling folder", target)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	fh.ServeHTTP(rec, uploadRequest(t, map[string]string{"directory": "/secret"}, map[string]string{"planted.txt": "x"}))
+	if rec.Code == http.StatusOK {
+		t.Errorf("upload into the sibling = 200")
+	}
+	if _, err := os.Stat(filepath.Join(secret, "planted.txt")); err == nil {
+		t.Error("the upload was written into the sibling folder")
+	}
+
+	if rec := do(fh, http.MethodGet, "/inbox/keep.txt"); rec.Code != http.StatusOK {
+		t.Errorf("GET /inbox/keep.txt = %d, want 200", rec.Code)
+	}
+}
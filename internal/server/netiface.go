@@ -0,0 +1,103 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// listenAddress decides which address the share is advertised at and which
+// host it listens on. --bind names the address directly and --interface
+// takes the first address of that interface (IPv4 preferred); without
+// either the server listens everywhere and advertises getLocalIP.
+func listenAddress(bind, iface string) (advertise, listenHost string, ifi *net.Interface, err error) {
+	switch {
+	case bind != "" && iface != "":
+		return "", "", nil, fmt.Errorf("use either --bind or --interface, not both")
+	case bind != "":
+		ip := net.ParseIP(bind)
+		if ip == nil {
+			return "", "", nil, fmt.Errorf("--bind %q is not an IP address", bind)
+		}
+		return ip.String(), ip.String(), nil, nil
+	case iface != "":
+		ifi, err := net.InterfaceByName(iface)
+		if err != nil {
+			return "", "", nil, fmt.Errorf("no network interface named %q; available: %s", iface, describeInterfaces())
+		}
+		ip, err := interfaceIP(ifi)
+		if err != nil {
+			return "", "", nil, err
+		}
+		return ip.String(), ip.String(), ifi, nil
+	default:
+		return getLocalIP(), "", nil, nil
+	}
+}
+
+// URL is the address the server advertises for c, as printed and put in
+// the QR code at startup
+func (c Config) URL() (string, error) {
+	ip, _, _, err := listenAddress(c.Bind, c.Interface)
+	if err != nil {
+		return "", err
+	}
+	scheme := "http"
+	if c.UsesTLS() {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://%s", scheme, net.JoinHostPort(ip, strconv.Itoa(c.Port))), nil
+}
+
+// interfaceIP returns the interface's first IPv4 address, or its first
+// global IPv6 one when it has no IPv4
+func interfaceIP(ifi *net.Interface) (net.IP, error) {
+	addrs, err := ifi.Addrs()
+	if err != nil {
+		return nil, err
+	}
+	var v6 net.IP
+	for _, addr := range addrs {
+		ipnet, ok := addr.(*net.IPNet)
+		if !ok {
+			continue
+		}
+		if v4 := ipnet.IP.To4(); v4 != nil {
+			return v4, nil
+		}
+		if v6 == nil && ipnet.IP.IsGlobalUnicast() {
+			v6 = ipnet.IP
+		}
+	}
+	if v6 == nil {
+		return nil, fmt.Errorf("network interface %q has no usable address", ifi.Name)
+	}
+	return v6, nil
+}
+
+// describeInterfaces lists the machine's interfaces with their addresses,
+// for the error when --interface names one that doesn't exist
+func describeInterfaces() string {
+	ifaces, err := net.Interfaces()
+	if err != nil || len(ifaces) == 0 {
+		return "none found"
+	}
+	var names []string
+	for _, ifi := range ifaces {
+		var ips []string
+		if addrs, err := ifi.Addrs(); err == nil {
+			for _, addr := range addrs {
+				if ipnet, ok := addr.(*net.IPNet); ok {
+					ips = append(ips, ipnet.IP.String())
+				}
+			}
+		}
+		if len(ips) == 0 {
+			names = append(names, ifi.Name)
+		} else {
+			names = append(names, fmt.Sprintf("%s (%s)", ifi.Name, strings.Join(ips, ", ")))
+		}
+	}
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,74 @@
+package server
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// newExtFilter turns --only-ext values such as "jpg", ".PNG" or "jpg,png"
+// into a set of lowercase extensions with a leading dot
+func newExtFilter(exts []string) map[string]bool {
+	if len(exts) == 0 {
+		return nil
+	}
+	set := make(map[string]bool)
+	for _, value := range exts {
+		for _, ext := range strings.Split(value, ",") {
+			ext = strings.ToLower(strings.TrimSpace(ext))
+			if ext == "" {
+				continue
+			}
+			if !strings.HasPrefix(ext, ".") {
+				ext = "." + ext
+			}
+			set[ext] = true
+		}
+	}
+	return set
+}
+
+// showsFile reports whether a file (not a directory) named name is part of
+// the share. Without --only-ext every file is, except upload markers, the
+// part files of uploads in progress and goshare's own config file.
+func (fh *FileHandler) showsFile(name string) bool {
+	if name == uploadMarker || strings.HasPrefix(name, partFilePrefix) || (fh.configName != "" && name == fh.configName) {
+		return false
+	}
+	if len(fh.onlyExt) == 0 {
+		return true
+	}
+	return fh.onlyExt[strings.ToLower(filepath.Ext(name))]
+}
+
+// hideConfigFile keeps the config file at path out of the share when it
+// sits inside it, as goshare.yaml does with the default --dir . Like upload
+// markers it is matched by name, so files of that name are left out
+// everywhere in the share.
+func (fh *FileHandler) hideConfigFile(path string) {
+	if path == "" {
+		return
+	}
+	if abs, err := filepath.Abs(path); err == nil && fh.insideShare(abs) {
+		fh.configName = filepath.Base(abs)
+	}
+}
+
+// hidden reports whether a file or folder named name is left out of the
+// share for being a dotfile. With --show-hidden only the quarantine folder
+// of --scan-command is.
+func (fh *FileHandler) hidden(name string) bool {
+	if fh.scanCommand != "" && name == quarantineDir {
+		return true
+	}
+	return !fh.showHidden && strings.HasPrefix(name, ".")
+}
+
+// hiddenPath reports whether cleanPath is a hidden entry or lies inside one
+func (fh *FileHandler) hiddenPath(cleanPath string) bool {
+	for _, segment := range strings.Split(filepath.ToSlash(cleanPath), "/") {
+		if fh.hidden(segment) {
+			return true
+		}
+	}
+	return false
+}
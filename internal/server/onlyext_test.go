@@ -0,0 +1,146 @@
+package server
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestOnlyExtHidesOtherFiles(t *testing.T) {
+	fh := newTestHandler(t, "")
+	fh.onlyExt = newExtFilter([]string{"JPG"})
+	writeFile(t, fh, "report.jpg", "photo")
+	writeFile(t, fh, "report.txt", "text")
+	writeFile(t, fh, "docs/report.jpg", "photo")
+	writeFile(t, fh, "docs/report.pdf", "pdf")
+
+	var page APIPageData
+	if err := json.Unmarshal(do(fh, http.MethodGet, "/api/files?path=/").Body.Bytes(), &page); err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, f := range page.Files {
+		names = append(names, f.Name)
+	}
+	sort.Strings(names)
+	if got := strings.Join(names, " "); got != "docs report.jpg" {
+		t.Errorf("/api/files lists %q, want the folder and report.jpg", got)
+	}
+
+	html := do(fh, http.MethodGet, "/").Body.String()
+	if !strings.Contains(html, "report.jpg") || strings.Contains(html, "report.txt") {
+		t.Error("HTML listing doesn't show only report.jpg")
+	}
+
+	var search APISearchResult
+	if err := json.Unmarshal(do(fh, http.MethodGet, "/api/search?q=report").Body.Bytes(), &search); err != nil {
+		t.Fatal(err)
+	}
+	var found []string
+	for _, f := range search.Results {
+		found = append(found, f.Path)
+	}
+	sort.Strings(found)
+	if got := strings.Join(found, " "); got != "/docs/report.jpg /report.jpg" {
+		t.Errorf("search found %q, want only the jpg files", got)
+	}
+
+	rec := do(fh, http.MethodGet, "/docs?download=zip")
+	zr, err := zip.NewReader(bytes.NewReader(rec.Body.Bytes()), int64(rec.Body.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var zipped []string
+	for _, f := range zr.File {
+		zipped = append(zipped, f.Name)
+	}
+	if got := strings.Join(zipped, " "); got != "report.jpg" {
+		t.Errorf("zip holds %q, want only report.jpg", got)
+	}
+
+	// Left-out files can't be fetched directly either
+	for _, target := range []string{"/report.txt", "/docs/report.pdf"} {
+		if rec := do(fh, http.MethodGet, target); rec.Code != http.StatusNotFound {
+			t.Errorf("GET %s = %d, want 404", target, rec.Code)
+		}
+	}
+	if rec := do(fh, http.MethodGet, "/report.jpg"); rec.Code != http.StatusOK {
+		t.Errorf("GET /report.jpg = %d, want 200", rec.Code)
+	}
+}
+
+func TestHiddenPathsStayHidden(t *testing.T) {
+	fh := newTestHandler(t, "")
+	writeFile(t, fh, ".env", "SECRET=1")
+	writeFile(t, fh, ".git/config", "[core]")
+	writeFile(t, fh, "visible.txt", "x")
+
+	for _, target := range []string{
+		"/api/zip?paths=/.env",
+		"/api/zip?paths=/.git",
+		"/api/checksum?path=/.env",
+		"/api/checksum?path=/.git/config",
+		"/api/all?path=/.git",
+		"/api/search?path=/.git&q=config",
+		"/api/stat?path=/.env",
+		"/api/files?path=/.git",
+		"/.env",
+	} {
+		rec := do(fh, http.MethodGet, target)
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("GET %s = %d, want 404", target, rec.Code)
+		}
+		if strings.Contains(rec.Body.String(), "SECRET") || strings.Contains(rec.Body.String(), "[core]") {
+			t.Errorf("GET %s leaked a hidden file", target)
+		}
+	}
+	if rec := do(fh, http.MethodGet, "/api/zip?paths=/visible.txt"); rec.Code != http.StatusOK {
+		t.Errorf("zip of a visible file = %d, want 200", rec.Code)
+	}
+
+	// --scan-command's quarantine is hidden even with --show-hidden
+	fh.showHidden, fh.scanCommand = true, "true"
+	writeFile(t, fh, quarantineDir+"/infected.exe", "x")
+	for _, target := range []string{
+		"/api/zip?paths=/" + quarantineDir,
+		"/api/checksum?path=/" + quarantineDir + "/infected.exe",
+		"/api/all?path=/" + quarantineDir,
+	} {
+		if rec := do(fh, http.MethodGet, target); rec.Code != http.StatusNotFound {
+			t.Errorf("GET %s = %d, want 404", target, rec.Code)
+		}
+	}
+	if rec := do(fh, http.MethodGet, "/api/checksum?path=/.env"); rec.Code != http.StatusOK {
+		t.Errorf("dotfile checksum with --show-hidden = %d, want 200", rec.Code)
+	}
+}
+
+func TestConfigFileIsNotShared(t *testing.T) {
+	fh := newTestHandler(t, "")
+	writeFile(t, fh, "goshare.yaml", "password: hunter2")
+	writeFile(t, fh, "photo.jpg", "x")
+
+	// A config file elsewhere leaves same-named files in the share alone
+	fh.hideConfigFile(filepath.Join(t.TempDir(), "goshare.yaml"))
+	if rec := do(fh, http.MethodGet, "/goshare.yaml"); rec.Code != http.StatusOK {
+		t.Errorf("GET /goshare.yaml with the config outside the share = %d, want 200", rec.Code)
+	}
+
+	fh.hideConfigFile(filepath.Join(fh.rootDir, "goshare.yaml"))
+	for _, target := range []string{"/goshare.yaml", "/api/checksum?path=/goshare.yaml", "/api/zip?paths=/goshare.yaml"} {
+		if rec := do(fh, http.MethodGet, target); rec.Code != http.StatusNotFound {
+			t.Errorf("GET %s = %d, want 404", target, rec.Code)
+		}
+	}
+	for _, target := range []string{"/", "/api/files?path=/", "/api/all?path=/"} {
+		body := do(fh, http.MethodGet, target).Body.String()
+		if strings.Contains(body, "goshare.yaml") || !strings.Contains(body, "photo.jpg") {
+			t.Errorf("GET %s lists the config file", target)
+		}
+	}
+}
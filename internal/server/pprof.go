@@ -0,0 +1,24 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/pprof"
+)
+
+// registerPProf adds the net/http/pprof handlers to mux behind adminOnly,
+// so profiles can be captured during a heavy transfer without ever being
+// reachable anonymously
+func (fh *FileHandler) registerPProf(mux *http.ServeMux) {
+	mux.Handle("/debug/pprof/", fh.adminOnly(http.HandlerFunc(pprof.Index)))
+	mux.Handle("/debug/pprof/cmdline", fh.adminOnly(http.HandlerFunc(pprof.Cmdline)))
+	mux.Handle("/debug/pprof/profile", fh.adminOnly(http.HandlerFunc(pprof.Profile)))
+	mux.Handle("/debug/pprof/symbol", fh.adminOnly(http.HandlerFunc(pprof.Symbol)))
+	mux.Handle("/debug/pprof/trace", fh.adminOnly(http.HandlerFunc(pprof.Trace)))
+
+	if fh.auth == nil {
+		fmt.Println("🩺 Profiling at /debug/pprof/ (this machine only; set --password to reach it remotely)")
+	} else {
+		fmt.Println("🩺 Profiling at /debug/pprof/ (login required)")
+	}
+}
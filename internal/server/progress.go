@@ -0,0 +1,243 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// progressKeep is how long a finished upload's status stays around, so a
+// client polling every few seconds still sees how it ended
+const progressKeep = time.Minute
+
+// validProgressID is what a client may pick as ?id= for a streamed upload
+var validProgressID = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// uploadProgress tracks streamed uploads by the ID their client chose, for
+// GET /api/upload/status/<id>
+type uploadProgress struct {
+	mu      sync.Mutex
+	uploads map[string]*streamedUpload
+}
+
+// streamedUpload is one PUT /api/upload/<name> in flight or just finished
+type streamedUpload struct {
+	name     string
+	size     int64 // the Content-Length, or -1 when the client didn't send one
+	received atomic.Int64
+	mu       sync.Mutex // guards the fields below
+	finished time.Time
+	stored   string
+	err      string
+}
+
+// APIUploadProgress is the response for /api/upload/status/<id>
+type APIUploadProgress struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Size     int64  `json:"size"` // -1 when unknown
+	Received int64  `json:"received"`
+	Done     bool   `json:"done"`
+	StoredAs string `json:"storedAs,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+func newUploadProgress() *uploadProgress {
+	return &uploadProgress{uploads: make(map[string]*streamedUpload)}
+}
+
+// add starts tracking u as id, first forgetting uploads that finished a
+// while ago. An ID still in use is refused.
+func (p *uploadProgress) add(id string, u *streamedUpload) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for old, s := range p.uploads {
+		s.mu.Lock()
+		stale := !s.finished.IsZero() && time.Since(s.finished) > progressKeep
+		s.mu.Unlock()
+		if stale {
+			delete(p.uploads, old)
+		}
+	}
+	if _, ok := p.uploads[id]; ok {
+		return errProgressIDTaken
+	}
+	if len(p.uploads) >= maxPendingUploads {
+		return errTooManyUploads
+	}
+	p.uploads[id] = u
+	return nil
+}
+
+var errProgressIDTaken = errors.New("an upload with this id is already running")
+
+func (p *uploadProgress) get(id string) (*streamedUpload, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	u, ok := p.uploads[id]
+	return u, ok
+}
+
+// finish records how the upload ended; the status lingers for progressKeep
+func (u *streamedUpload) finish(stored, err string) {
+	u.mu.Lock()
+	u.finished, u.stored, u.err = time.Now(), stored, err
+	u.mu.Unlock()
+}
+
+// countingReader counts the bytes read through it for status polls
+type countingReader struct {
+	r io.Reader
+	n *atomic.Int64
+}
+
+func (c countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n.Add(int64(n))
+	return n, err
+}
+
+// handleUploadStatus answers GET /api/upload/status/<id> with how many bytes
+// of a streamed upload have arrived
+func (fh *FileHandler) handleUploadStatus(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		writeAPIError(w, http.StatusMethodNotAllowed, "use GET")
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	u, ok := fh.progress.get(id)
+	if !ok {
+		writeAPIError(w, http.StatusNotFound, "no such upload; it may have finished a while ago")
+		return
+	}
+	u.mu.Lock()
+	status := APIUploadProgress{
+		ID:       id,
+		Name:     u.name,
+		Size:     u.size,
+		Received: u.received.Load(),
+		Done:     !u.finished.IsZero(),
+		StoredAs: u.stored,
+		Error:    u.err,
+	}
+	u.mu.Unlock()
+	json.NewEncoder(w).Encode(status)
+}
+
+// handleStreamedUpload stores the body of PUT /api/upload/<name> as one
+// file, in ?directory= (default /), with ?overwrite=1 and ?upload_password=
+// as for form uploads. With ?id= the client can follow the bytes arriving
+// at /api/upload/status/<id> while the request is still being sent.
+func (fh *FileHandler) handleStreamedUpload(w http.ResponseWriter, r *http.Request, rawName string) {
+	name, ok := fh.uploadFileName(rawName)
+	if !ok || strings.Contains(rawName, "/") {
+		writeAPIError(w, http.StatusBadRequest, "invalid file name; give the folder as ?directory=")
+		return
+	}
+	if strings.EqualFold(name, uploadMarker) {
+		writeAPIError(w, http.StatusBadRequest, "this file name is reserved")
+		return
+	}
+	if r.ContentLength > fh.maxUpload {
+		writeAPIError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("files larger than %s are not accepted", formatFileSize(fh.maxUpload, false)))
+		return
+	}
+	query := r.URL.Query()
+	cleanDir, fsDir, ok := fh.uploadTarget(w, query.Get("directory"), query.Get("upload_password"))
+	if !ok {
+		return
+	}
+	// The size is only known up front from the Content-Length
+	if fh.quota != nil && r.ContentLength < 0 {
+		writeAPIError(w, http.StatusLengthRequired, "send a Content-Length; this share has a storage limit")
+		return
+	}
+	if !fh.quota.reserve(r.ContentLength) {
+		fh.quotaFull(w)
+		return
+	}
+	var storedSize int64
+	defer func() { fh.quota.release(r.ContentLength, storedSize) }()
+
+	u := &streamedUpload{name: name, size: r.ContentLength}
+	if id := query.Get("id"); id != "" {
+		if !validProgressID.MatchString(id) {
+			writeAPIError(w, http.StatusBadRequest, "id may only hold letters, digits, - and _ (at most 64)")
+			return
+		}
+		switch err := fh.progress.add(id, u); err {
+		case nil:
+		case errProgressIDTaken:
+			writeAPIError(w, http.StatusConflict, err.Error())
+			return
+		default:
+			writeAPIError(w, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+	}
+
+	partPath := newPartPath(fsDir)
+	part, err := os.OpenFile(partPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666)
+	if err != nil {
+		log.Printf("Could not start an upload in %s: %v", fsDir, err)
+		u.finish("", "could not create the file")
+		writeAPIError(w, http.StatusInternalServerError, "could not create the file")
+		return
+	}
+	body := countingReader{r: http.MaxBytesReader(w, r.Body, fh.maxUpload), n: &u.received}
+	_, err = io.Copy(part, body)
+	if closeErr := part.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(partPath)
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			u.finish("", "too large")
+			writeAPIError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("files larger than %s are not accepted", formatFileSize(fh.maxUpload, false)))
+			return
+		}
+		u.finish("", "the upload was cut short")
+		writeAPIError(w, http.StatusBadRequest, "the upload was cut short")
+		return
+	}
+
+	if reason := fh.scanUpload(r, cleanDir, partPath, name); reason != "" {
+		u.finish("", reason)
+		writeAPIError(w, http.StatusUnprocessableEntity, name+" was "+reason)
+		return
+	}
+	stored, ok := placePartFile(w, partPath, fsDir, name, query.Get("overwrite") == "1")
+	if !ok {
+		os.Remove(partPath)
+		u.finish("", "could not store the file")
+		return
+	}
+	u.finish(stored, "")
+	size := u.received.Load()
+	storedSize = size
+	if query.Get("overwrite") == "1" {
+		fh.quota.changed()
+	}
+	fh.metrics.uploaded(size)
+	recordUpload(filepath.Join(fsDir, stored), size)
+	fh.audit(r, "http", "upload", filepath.ToSlash(filepath.Join(cleanDir, stored)), "", size)
+	fh.live.changed(cleanDir)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(uploadResult{
+		Uploaded: 1,
+		Files:    []uploadedFile{{Name: name, StoredAs: stored}},
+		Failed:   []uploadFailure{},
+	})
+}
@@ -0,0 +1,119 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/skip2/go-qrcode"
+)
+
+const (
+	defaultQRSize = 256
+	minQRSize     = 64
+	maxQRSize     = 1024
+)
+
+// handleAPIQR serves the QR code of the share's address as a PNG, or as SVG
+// with ?format=svg, ?size= pixels square. ?data= may name another address
+// on this server, such as a file's link; anything else is refused so the
+// endpoint can't be used as a general QR generator.
+func (fh *FileHandler) handleAPIQR(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	size := defaultQRSize
+	if value := query.Get("size"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < minQRSize || n > maxQRSize {
+			writeAPIError(w, http.StatusBadRequest, fmt.Sprintf("size must be between %d and %d", minQRSize, maxQRSize))
+			return
+		}
+		size = n
+	}
+	format := strings.ToLower(query.Get("format"))
+	if format == "" {
+		format = "png"
+	}
+	if format != "png" && format != "svg" {
+		writeAPIError(w, http.StatusBadRequest, "format must be png or svg")
+		return
+	}
+
+	data := fh.serverURL
+	if query.Has("data") {
+		data = query.Get("data")
+		if !fh.isOwnURL(r, data) {
+			writeAPIError(w, http.StatusBadRequest, "data must be an address on this server")
+			return
+		}
+	}
+	if data == "" {
+		writeAPIError(w, http.StatusNotFound, "nothing to encode; no server address is known")
+		return
+	}
+
+	qr, err := qrcode.New(data, qrcode.Medium)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "could not encode QR code")
+		return
+	}
+	var body []byte
+	if format == "svg" {
+		w.Header().Set("Content-Type", "image/svg+xml")
+		body = qrSVG(qr.Bitmap(), size)
+	} else {
+		w.Header().Set("Content-Type", "image/png")
+		if body, err = qr.PNG(size); err != nil {
+			writeAPIError(w, http.StatusInternalServerError, "could not encode QR code")
+			return
+		}
+	}
+
+	// The address can change between runs, so browsers revalidate after an
+	// hour; the ETag makes that cheap
+	sum := sha256.Sum256([]byte(format + "\x00" + strconv.Itoa(size) + "\x00" + data))
+	w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:8])+`"`)
+	w.Header().Set("Cache-Control", "private, max-age=3600")
+	if query.Has("download") {
+		w.Header().Set("Content-Disposition", `attachment; filename="goshare-qr.`+format+`"`)
+	}
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(body))
+}
+
+// isOwnURL reports whether addr is an http(s) address on this server, as
+// reached by the request or as advertised
+func (fh *FileHandler) isOwnURL(r *http.Request, addr string) bool {
+	for _, base := range []string{fh.baseURL(r), fh.serverURL} {
+		if base != "" && (addr == base || strings.HasPrefix(addr, base+"/") || strings.HasPrefix(addr, base+"?")) {
+			return true
+		}
+	}
+	return false
+}
+
+// qrSVG draws the code's modules as one path, a run of dark modules per
+// segment, scaled to size pixels square
+func qrSVG(bitmap [][]bool, size int) []byte {
+	var b bytes.Buffer
+	n := len(bitmap)
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`, size, size, n, n)
+	fmt.Fprintf(&b, `<rect width="%d" height="%d" fill="#fff"/><path fill="#000" d="`, n, n)
+	for y, row := range bitmap {
+		for x := 0; x < len(row); x++ {
+			if !row[x] {
+				continue
+			}
+			start := x
+			for x < len(row) && row[x] {
+				x++
+			}
+			fmt.Fprintf(&b, "M%d %dh%dv1h-%dz", start, y, x-start, x-start)
+		}
+	}
+	b.WriteString(`"/></svg>`)
+	return b.Bytes()
+}
@@ -0,0 +1,109 @@
+package server
+
+import (
+	"fmt"
+	"io/fs"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// quotaRewalk is how long a measured total is trusted; files added or
+// removed behind the server's back are picked up at the next walk
+const quotaRewalk = 10 * time.Minute
+
+// storageQuota caps how much the shared folders may hold with
+// --max-storage. The total is measured by walking the share, then kept
+// current as uploads land; uploads in flight reserve their size up front
+// so concurrent ones can't overshoot together.
+type storageQuota struct {
+	limit    int64
+	dirs     []string
+	mu       sync.Mutex
+	used     int64
+	reserved int64
+	measured time.Time // zero forces a walk
+}
+
+// newStorageQuota returns nil, which allows everything, for a zero limit
+func newStorageQuota(limit int64, dirs []string) *storageQuota {
+	if limit <= 0 {
+		return nil
+	}
+	return &storageQuota{limit: limit, dirs: dirs}
+}
+
+// reserve sets aside size bytes for an upload, or reports false when the
+// share would end up over the limit
+func (q *storageQuota) reserve(size int64) bool {
+	if q == nil {
+		return true
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.measured.IsZero() || time.Since(q.measured) > quotaRewalk {
+		q.used = q.measure()
+		q.measured = time.Now()
+	}
+	if q.used+q.reserved+size > q.limit {
+		return false
+	}
+	q.reserved += size
+	return true
+}
+
+// release hands back a reservation once its upload is over; stored is
+// what it left in the share
+func (q *storageQuota) release(size, stored int64) {
+	if q == nil {
+		return
+	}
+	q.mu.Lock()
+	q.reserved -= size
+	q.used += stored
+	q.mu.Unlock()
+}
+
+// changed makes the next reservation measure the share again, after
+// deletes whose size isn't known up front
+func (q *storageQuota) changed() {
+	if q == nil {
+		return
+	}
+	q.mu.Lock()
+	q.measured = time.Time{}
+	q.mu.Unlock()
+}
+
+// measure adds up every regular file in the shared folders, hidden ones
+// and part files included, since they all take up the disk
+func (q *storageQuota) measure() int64 {
+	var total int64
+	for _, dir := range q.dirs {
+		total += treeSize(dir)
+	}
+	return total
+}
+
+// treeSize adds up the regular files at or under fsPath, without
+// following symlinks
+func treeSize(fsPath string) int64 {
+	var total int64
+	filepath.WalkDir(fsPath, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return nil
+		}
+		if info, err := d.Info(); err == nil {
+			total += info.Size()
+		}
+		return nil
+	})
+	return total
+}
+
+// quotaFull answers an upload the quota has no room for
+func (fh *FileHandler) quotaFull(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	writeAPIError(w, http.StatusInsufficientStorage, fmt.Sprintf("the share is full (limit %s)", formatFileSize(fh.quota.limit, false)))
+}
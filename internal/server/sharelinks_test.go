@@ -0,0 +1,52 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func createShareLink(fh *FileHandler, body string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	fh.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/share", strings.NewReader(body)))
+	return rec
+}
+
+func TestShareLinkRefusesHiddenPaths(t *testing.T) {
+	fh := newTestHandler(t, "")
+	writeFile(t, fh, ".private/a.txt", "secret")
+	writeFile(t, fh, "docs/.env", "secret")
+
+	for _, p := range []string{"/.private/a.txt", "/docs/.env"} {
+		if rec := createShareLink(fh, `{"path":"`+p+`"}`); rec.Code != http.StatusNotFound {
+			t.Errorf("sharing %s = %d, want 404", p, rec.Code)
+		}
+	}
+}
+
+func TestShareLinkUses(t *testing.T) {
+	fh := newTestHandler(t, "")
+	writeFile(t, fh, "docs/a.txt", "hello")
+
+	rec := createShareLink(fh, `{"path":"/docs/a.txt","maxUses":1}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("sharing /docs/a.txt = %d: %s", rec.Code, rec.Body)
+	}
+	var link APIShareLink
+	if err := json.NewDecoder(rec.Body).Decode(&link); err != nil {
+		t.Fatal(err)
+	}
+
+	rec = httptest.NewRecorder()
+	fh.serveShareLink(rec, httptest.NewRequest(http.MethodGet, "/s/"+link.Token, nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != "hello" {
+		t.Fatalf("first use = %d %q, want the file", rec.Code, rec.Body)
+	}
+	rec = httptest.NewRecorder()
+	fh.serveShareLink(rec, httptest.NewRequest(http.MethodGet, "/s/"+link.Token, nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("second use of a one-use link = %d, want 404", rec.Code)
+	}
+}
@@ -0,0 +1,351 @@
+package server
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"hash/fnv"
+	"html/template"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+const (
+	// minSplitSize keeps a typo like split=2KB from producing thousands of parts
+	minSplitSize  = 1 << 20
+	maxSplitParts = 9999
+	tarBlockSize  = 512
+)
+
+// tarPlanEntry is one member of a planned tar stream and its byte layout
+type tarPlanEntry struct {
+	header *tar.Header
+	fsPath string
+	offset int64 // where the header starts in the stream
+	hdrLen int64 // bytes taken by the header (including any PAX records)
+}
+
+// tarPlan lays out a directory as a tar stream without reading file contents,
+// so any byte range of the archive can be produced on demand
+type tarPlan struct {
+	entries []tarPlanEntry
+	size    int64
+}
+
+func paddedTarSize(n int64) int64 {
+	return (n + tarBlockSize - 1) / tarBlockSize * tarBlockSize
+}
+
+// renderTarHeader returns the exact bytes tar.Writer emits for a header
+func renderTarHeader(hdr *tar.Header) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := tar.NewWriter(&buf).WriteHeader(hdr); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (fh *FileHandler) planTar(fsPath string) (*tarPlan, error) {
+	plan := &tarPlan{}
+	err := filepath.Walk(fsPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == fsPath {
+			return nil
+		}
+
+		// Leave out what the zip download does: hidden entries, and
+		// symlinks unless --follow-symlinks allows them
+		if fh.hidden(info.Name()) || !fh.allowsLink(path, info.Mode()) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		// Allowed symlinks to regular files are archived as those files
+		if info.Mode()&os.ModeSymlink != 0 {
+			if target, err := os.Stat(path); err == nil && target.Mode().IsRegular() {
+				info = target
+			}
+		}
+		if !info.IsDir() && (!info.Mode().IsRegular() || !fh.showsFile(info.Name())) {
+			return nil
+		}
+
+		relPath, err := filepath.Rel(fsPath, path)
+		if err != nil {
+			return err
+		}
+		hdr, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		hdr.Name = filepath.ToSlash(relPath)
+		if info.IsDir() {
+			hdr.Name += "/"
+		}
+
+		raw, err := renderTarHeader(hdr)
+		if err != nil {
+			return err
+		}
+		plan.entries = append(plan.entries, tarPlanEntry{
+			header: hdr,
+			fsPath: path,
+			offset: plan.size,
+			hdrLen: int64(len(raw)),
+		})
+		plan.size += int64(len(raw)) + paddedTarSize(hdr.Size)
+		return nil
+	})
+	// End-of-archive marker: two zero blocks
+	plan.size += 2 * tarBlockSize
+	return plan, err
+}
+
+// fingerprint identifies the planned layout so parts from different
+// snapshots of a changing folder aren't mixed
+func (p *tarPlan) fingerprint() string {
+	h := fnv.New64a()
+	for _, e := range p.entries {
+		fmt.Fprintf(h, "%s\x00%d\x00%d\x00", e.header.Name, e.header.Size, e.header.ModTime.UnixNano())
+	}
+	return strconv.FormatUint(h.Sum64(), 36)
+}
+
+// writeRange writes bytes [start, end) of the planned tar stream to w
+func (p *tarPlan) writeRange(w io.Writer, start, end int64) error {
+	// emit writes the part of b (located at stream offset at) that overlaps the window
+	emit := func(b []byte, at int64) error {
+		lo, hi := at, at+int64(len(b))
+		if hi <= start || lo >= end {
+			return nil
+		}
+		if lo < start {
+			b = b[start-lo:]
+			lo = start
+		}
+		if hi > end {
+			b = b[:len(b)-int(hi-end)]
+		}
+		_, err := w.Write(b)
+		return err
+	}
+	zeros := make([]byte, tarBlockSize*2)
+
+	for _, e := range p.entries {
+		dataStart := e.offset + e.hdrLen
+		entryEnd := dataStart + paddedTarSize(e.header.Size)
+		if entryEnd <= start {
+			continue
+		}
+		if e.offset >= end {
+			break
+		}
+
+		raw, err := renderTarHeader(e.header)
+		if err != nil {
+			return err
+		}
+		if err := emit(raw, e.offset); err != nil {
+			return err
+		}
+
+		if e.header.Size > 0 {
+			if err := p.copyData(w, e, dataStart, start, end); err != nil {
+				return err
+			}
+			if pad := paddedTarSize(e.header.Size) - e.header.Size; pad > 0 {
+				if err := emit(zeros[:pad], dataStart+e.header.Size); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return emit(zeros, p.size-2*tarBlockSize)
+}
+
+// copyData writes the overlapping slice of one file's contents, seeking past
+// anything before the window. Short reads are zero-filled so later offsets
+// stay correct.
+func (p *tarPlan) copyData(w io.Writer, e tarPlanEntry, dataStart, start, end int64) error {
+	from, to := dataStart, dataStart+e.header.Size
+	if from < start {
+		from = start
+	}
+	if to > end {
+		to = end
+	}
+	if from >= to {
+		return nil
+	}
+
+	want := to - from
+	var copied int64
+	if file, err := os.Open(e.fsPath); err == nil {
+		if _, err := file.Seek(from-dataStart, io.SeekStart); err == nil {
+			copied, _ = io.Copy(w, io.LimitReader(file, want))
+		}
+		file.Close()
+	}
+	if copied < want {
+		log.Printf("Split archive: %s changed while downloading, zero-filling", e.fsPath)
+		_, err := io.CopyN(w, zeroReader{}, want-copied)
+		return err
+	}
+	return nil
+}
+
+type zeroReader struct{}
+
+func (zeroReader) Read(b []byte) (int, error) {
+	for i := range b {
+		b[i] = 0
+	}
+	return len(b), nil
+}
+
+var splitIndexTemplate = template.Must(template.New("split").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>{{.Name}} - Split Download</title>
+    <script src="https://cdn.tailwindcss.com"></script>
+    <link href="https://cdnjs.cloudflare.com/ajax/libs/font-awesome/6.0.0/css/all.min.css" rel="stylesheet">
+</head>
+<body class="bg-gray-50 min-h-screen">
+    <div class="container mx-auto px-4 py-8 max-w-3xl">
+        <h1 class="text-2xl font-bold text-gray-800 mb-2">
+            <i class="fas fa-file-archive text-blue-600 mr-2"></i>
+            {{.Name}}
+        </h1>
+        <p class="text-gray-600 mb-6">{{.TotalStr}} split into {{len .Parts}} part(s) of at most {{.PartStr}} each.</p>
+
+        <div class="bg-white rounded-lg shadow-md overflow-hidden mb-6">
+            <ul class="divide-y divide-gray-200">
+                {{range .Parts}}
+                <li class="px-6 py-3 flex items-center justify-between">
+                    <span class="font-mono text-gray-800">{{.Filename}}</span>
+                    <a href="{{.URL}}" class="inline-flex items-center px-3 py-1 text-sm font-medium rounded-md text-white bg-blue-600 hover:bg-blue-700">
+                        <i class="fas fa-download mr-1"></i>
+                        {{.SizeStr}}
+                    </a>
+                </li>
+                {{end}}
+            </ul>
+        </div>
+
+        <div class="bg-white rounded-lg shadow-md p-6 text-sm text-gray-700">
+            <h2 class="text-lg font-semibold text-gray-800 mb-2">Reassembling</h2>
+            <p class="mb-2">Download every part into the same folder, then join them in order and extract the tar archive.</p>
+            <p class="font-semibold mt-4">Linux / macOS</p>
+            <pre class="bg-gray-100 p-3 rounded overflow-auto">cat {{.Base}}.* | tar -xf -</pre>
+            <p class="font-semibold mt-4">Windows (Command Prompt)</p>
+            <pre class="bg-gray-100 p-3 rounded overflow-auto">copy /b {{.CopyList}} {{.Base}}
+tar -xf {{.Base}}</pre>
+            <p class="mt-4 text-gray-500">Parts must all come from this page; if the folder changes on the server, reload this page and download them again.</p>
+        </div>
+    </div>
+</body>
+</html>`))
+
+type splitPart struct {
+	Filename string
+	URL      string
+	SizeStr  string
+}
+
+// serveSplitArchive serves a directory as a tar archive split into numbered
+// parts of at most the requested size: an index page without ?part=, or the
+// bytes of one part with it
+func (fh *FileHandler) serveSplitArchive(w http.ResponseWriter, r *http.Request, fsPath, dirName, splitValue string) {
+	partSize, err := parseByteSize(splitValue)
+	if err != nil || partSize < minSplitSize {
+		http.Error(w, fmt.Sprintf("Invalid split size %q (minimum 1MB)", splitValue), http.StatusBadRequest)
+		return
+	}
+
+	plan, err := fh.planTar(fsPath)
+	if err != nil {
+		log.Printf("Error planning split archive: %v", err)
+		http.Error(w, "Could not read directory", http.StatusInternalServerError)
+		return
+	}
+
+	numParts := int((plan.size + partSize - 1) / partSize)
+	if numParts > maxSplitParts {
+		http.Error(w, "Split size too small for this folder", http.StatusBadRequest)
+		return
+	}
+
+	base := dirName + ".tar"
+	version := plan.fingerprint()
+	query := r.URL.Query()
+
+	partParam := query.Get("part")
+	if partParam == "" {
+		data := struct {
+			Name, Base, TotalStr, PartStr, CopyList string
+			Parts                                   []splitPart
+		}{
+			Name:     dirName,
+			Base:     base,
+			TotalStr: formatFileSize(plan.size, false),
+			PartStr:  formatFileSize(partSize, false),
+		}
+		for i := 1; i <= numParts; i++ {
+			query.Set("part", strconv.Itoa(i))
+			query.Set("v", version)
+			size := partSize
+			if i == numParts {
+				size = plan.size - int64(numParts-1)*partSize
+			}
+			filename := fmt.Sprintf("%s.%03d", base, i)
+			data.Parts = append(data.Parts, splitPart{
+				Filename: filename,
+				URL:      r.URL.Path + "?" + query.Encode(),
+				SizeStr:  formatFileSize(size, false),
+			})
+			if i > 1 {
+				data.CopyList += " + "
+			}
+			data.CopyList += filename
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := splitIndexTemplate.Execute(w, data); err != nil {
+			log.Printf("Template execution error: %v", err)
+		}
+		return
+	}
+
+	part, err := strconv.Atoi(partParam)
+	if err != nil || part < 1 || part > numParts {
+		http.Error(w, "Invalid part number", http.StatusBadRequest)
+		return
+	}
+	if query.Get("v") != version {
+		http.Error(w, "The folder changed since the download page was opened. Reload it and download all parts again.", http.StatusConflict)
+		return
+	}
+
+	start := int64(part-1) * partSize
+	end := start + partSize
+	if end > plan.size {
+		end = plan.size
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s.%03d\"", base, part))
+	w.Header().Set("Content-Length", strconv.FormatInt(end-start, 10))
+	w.Header().Set("Accept-Ranges", "none")
+	if err := plan.writeRange(w, start, end); err != nil {
+		log.Printf("Error writing split archive part: %v", err)
+	}
+}
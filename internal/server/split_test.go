@@ -0,0 +1,77 @@
+package server
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// tarNames plans fsPath as a split archive and returns what the parts
+// would hold, name to content
+func tarNames(t *testing.T, fh *FileHandler, fsPath string) map[string]string {
+	t.Helper()
+	plan, err := fh.planTar(fsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := plan.writeRange(&buf, 0, plan.size); err != nil {
+		t.Fatal(err)
+	}
+	files := make(map[string]string)
+	tr := tar.NewReader(&buf)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return files
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(tr)
+		files[hdr.Name] = string(data)
+	}
+}
+
+func TestSplitArchiveSkipsHiddenAndOutsideLinks(t *testing.T) {
+	fh := newTestHandler(t, "")
+	writeFile(t, fh, "album/song.mp3", "music")
+	writeFile(t, fh, "album/.env", "SECRET=1")
+	writeFile(t, fh, "album/.git/config", "[core]")
+	writeFile(t, fh, "notes.txt", "inside")
+	outside := filepath.Join(t.TempDir(), "passwd")
+	if err := os.WriteFile(outside, []byte("root:x:0:0"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(fh.rootDir, "album", "passwd")); err != nil {
+		t.Skip("symlinks not supported:", err)
+	}
+	if err := os.Symlink(filepath.Join(fh.rootDir, "notes.txt"), filepath.Join(fh.rootDir, "album", "notes.txt")); err != nil {
+		t.Fatal(err)
+	}
+
+	files := tarNames(t, fh, filepath.Join(fh.rootDir, "album"))
+	var names []string
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if got := strings.Join(names, " "); got != "notes.txt song.mp3" {
+		t.Errorf("parts hold %q, want the link inside the share and song.mp3", got)
+	}
+	if files["notes.txt"] != "inside" {
+		t.Errorf("notes.txt = %q, want the linked file's content", files["notes.txt"])
+	}
+
+	// --follow-symlinks lets the outside link in, still without dotfiles
+	fh.followSymlinks = true
+	files = tarNames(t, fh, filepath.Join(fh.rootDir, "album"))
+	if files["passwd"] != "root:x:0:0" || len(files) != 3 {
+		t.Errorf("with --follow-symlinks the parts hold %d files", len(files))
+	}
+}
@@ -0,0 +1,95 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// APIFileStat is the response for /api/stat: the listing row for one path
+// plus what a client wants to know before fetching it
+type APIFileStat struct {
+	APIFileItem
+	ContentType string            `json:"contentType,omitempty"` // files only
+	Entries     *int              `json:"entries,omitempty"`     // visible entries, folders only
+	Checksums   map[string]string `json:"checksums,omitempty"`   // digests already computed, by algo
+}
+
+// handleAPIStat describes the file or folder at ?path= without listing its
+// parent. Checksums holds only digests /api/checksum has cached for the
+// file as it is now; the others can be asked for there.
+func (fh *FileHandler) handleAPIStat(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	cleanPath, fsPath, ok := fh.resolvePath(r.URL.Query().Get("path"))
+	if fh.isMountRoot(cleanPath) {
+		entries := len(fh.mounts)
+		json.NewEncoder(w).Encode(APIFileStat{APIFileItem: APIFileItem{Path: "/", IsDir: true}, Entries: &entries})
+		return
+	}
+	if !ok || fh.hiddenPath(cleanPath) {
+		writeAPIError(w, http.StatusNotFound, "no such file or folder")
+		return
+	}
+	info, err := os.Stat(fsPath)
+	if err != nil || !info.IsDir() && !fh.showsFile(info.Name()) {
+		writeAPIError(w, http.StatusNotFound, "no such file or folder")
+		return
+	}
+
+	stat := APIFileStat{APIFileItem: APIFileItem{
+		Name:    info.Name(),
+		Path:    filepath.ToSlash(cleanPath),
+		Size:    info.Size(),
+		IsDir:   info.IsDir(),
+		ModTime: info.ModTime(),
+	}}
+	if info.IsDir() {
+		entries, err := fh.countEntries(fsPath)
+		if err != nil {
+			writeAPIError(w, http.StatusInternalServerError, "cannot read directory")
+			return
+		}
+		stat.Entries = &entries
+	} else {
+		stat.DownloadCount = downloadCount(fsPath)
+		stat.ContentType = getContentType(fsPath)
+		if file, err := os.Open(fsPath); err == nil {
+			stat.ContentType = fileContentType(fsPath, file)
+			file.Close()
+		}
+
+		stamp := hashListing([]FileInfo{{Name: info.Name(), Size: info.Size(), ModTime: info.ModTime()}})
+		algos := make([]string, 0, len(checksumAlgos))
+		for algo := range checksumAlgos {
+			algos = append(algos, algo)
+		}
+		sort.Strings(algos)
+		for _, algo := range algos {
+			if sum, ok := checksumCache.get(cleanPath+"?algo="+algo, stamp); ok {
+				if stat.Checksums == nil {
+					stat.Checksums = make(map[string]string)
+				}
+				stat.Checksums[algo] = string(sum)
+			}
+		}
+	}
+	json.NewEncoder(w).Encode(stat)
+}
+
+// countEntries counts what a listing of the folder at fsPath would show
+func (fh *FileHandler) countEntries(fsPath string) (int, error) {
+	entries, err := os.ReadDir(fsPath)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, entry := range entries {
+		if fh.hidden(entry.Name()) || !entry.IsDir() && !fh.showsFile(entry.Name()) || !fh.allowsLink(filepath.Join(fsPath, entry.Name()), entry.Type()) {
+			continue
+		}
+		n++
+	}
+	return n, nil
+}
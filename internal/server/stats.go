@@ -0,0 +1,92 @@
+package server
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// statsFlushInterval is how often download statistics are written to --stats-file
+const statsFlushInterval = 30 * time.Second
+
+// statsVersion counts changes to fileStatsMap so unchanged stats aren't
+// rewritten; guarded by statsMapLock
+var statsVersion uint64
+
+// loadStats fills fileStatsMap from a JSON file written by saveStats. A
+// missing file means a fresh start; a corrupt one is reported and ignored
+// rather than keeping the server from starting.
+func loadStats(path string) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return
+	}
+	if err != nil {
+		log.Printf("Warning: could not read stats file %s, starting empty: %v", path, err)
+		return
+	}
+
+	loaded := make(map[string]*FileStats)
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		log.Printf("Warning: stats file %s is corrupt, starting empty: %v", path, err)
+		return
+	}
+
+	statsMapLock.Lock()
+	for key, stats := range loaded {
+		if stats != nil {
+			fileStatsMap[key] = stats
+		}
+	}
+	statsMapLock.Unlock()
+}
+
+// saveStats writes fileStatsMap to path as indented JSON, going through a
+// temporary file so a crash mid-write can't truncate the old stats. It
+// returns the statsVersion that was saved.
+func saveStats(path string) (uint64, error) {
+	statsMapLock.RLock()
+	data, err := json.MarshalIndent(fileStatsMap, "", "  ")
+	version := statsVersion
+	statsMapLock.RUnlock()
+	if err != nil {
+		return 0, err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".goshare-stats-*")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name()) // no-op once renamed
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return 0, err
+	}
+	if err := tmp.Close(); err != nil {
+		return 0, err
+	}
+	return version, os.Rename(tmp.Name(), path)
+}
+
+// persistStats saves the stats every statsFlushInterval while they change
+func persistStats(path string) {
+	var saved uint64
+	ticker := time.NewTicker(statsFlushInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		statsMapLock.RLock()
+		changed := statsVersion != saved
+		statsMapLock.RUnlock()
+		if !changed {
+			continue
+		}
+		version, err := saveStats(path)
+		if err != nil {
+			log.Printf("Could not save stats to %s: %v", path, err)
+			continue
+		}
+		saved = version
+	}
+}
@@ -0,0 +1,52 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// insideShare reports whether fsPath, with every symlink resolved, is still
+// in a shared directory. A path that doesn't exist yet is judged by its
+// nearest existing parent, so an upload can't be steered out through a
+// symlinked folder; a dangling symlink is never inside, since writing
+// through it would create its target.
+func (fh *FileHandler) insideShare(fsPath string) bool {
+	real := fsPath
+	for {
+		resolved, err := filepath.EvalSymlinks(real)
+		if err == nil {
+			real = resolved
+			break
+		}
+		if _, lstatErr := os.Lstat(real); lstatErr == nil || !os.IsNotExist(err) {
+			return false
+		}
+		parent := filepath.Dir(real)
+		if parent == real {
+			return false
+		}
+		real = parent
+	}
+
+	roots := []string{fh.rootDir}
+	if fh.mounts != nil {
+		roots = roots[:0]
+		for _, dir := range fh.mounts {
+			roots = append(roots, dir)
+		}
+	}
+	for _, root := range roots {
+		realRoot, err := filepath.EvalSymlinks(root)
+		if err == nil && withinDir(realRoot, real) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowsLink reports whether the entry at fsPath, of the given mode, may be
+// listed and followed: anything but a symlink, a symlink that stays in the
+// share, or any symlink with --follow-symlinks
+func (fh *FileHandler) allowsLink(fsPath string, mode os.FileMode) bool {
+	return mode&os.ModeSymlink == 0 || fh.followSymlinks || fh.insideShare(fsPath)
+}
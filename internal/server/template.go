@@ -0,0 +1,29 @@
+package server
+
+import (
+	"html/template"
+	"io"
+	"log"
+	"path/filepath"
+)
+
+// loadTemplate returns the listing page template: the --template file when
+// one is given and works, the built-in page otherwise. The file is tried
+// out on an empty listing so a misspelled field shows up at startup rather
+// than as a broken page.
+func loadTemplate(path string) *template.Template {
+	builtin := template.Must(template.New("index").Parse(htmlTemplate))
+	if path == "" {
+		return builtin
+	}
+	tmpl, err := template.ParseFiles(path)
+	if err == nil {
+		err = tmpl.Execute(io.Discard, PageData{Sort: defaultSort})
+	}
+	if err != nil {
+		log.Printf("⚠️  Using the built-in page; template %s: %v", path, err)
+		return builtin
+	}
+	log.Printf("Using listing template %s", filepath.Base(path))
+	return tmpl
+}
@@ -0,0 +1,123 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultThumbnailSize = 200
+	maxThumbnailSize     = 1024 // the preview modal asks for this one
+	maxCachedThumbnails  = 256  // a few dozen KB each at most
+)
+
+// Thumbnails are decoded a couple at a time so a folder full of photos
+// can't take every core, and finished ones are kept keyed by path and size
+// with the file's size and mtime as the staleness check
+var (
+	thumbnailSlots = make(chan struct{}, 2)
+	thumbnailCache = newListingCache(maxCachedThumbnails)
+)
+
+// handleAPIThumbnail serves a JPEG of the image at ?path=, scaled to fit in
+// ?size= pixels square, so listings and previews don't pull in full-size
+// photos. It decodes the same formats as the montage.
+func (fh *FileHandler) handleAPIThumbnail(w http.ResponseWriter, r *http.Request) {
+	size := defaultThumbnailSize
+	if value := r.URL.Query().Get("size"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 16 || n > maxThumbnailSize {
+			writeAPIError(w, http.StatusBadRequest, "size must be between 16 and "+strconv.Itoa(maxThumbnailSize))
+			return
+		}
+		size = n
+	}
+
+	cleanPath, fsPath, ok := fh.resolvePath(r.URL.Query().Get("path"))
+	if !ok {
+		writeAPIError(w, http.StatusForbidden, "access denied")
+		return
+	}
+	info, err := os.Stat(fsPath)
+	if err != nil || info.IsDir() || fh.hiddenPath(cleanPath) || !fh.showsFile(info.Name()) {
+		writeAPIError(w, http.StatusNotFound, "no such file")
+		return
+	}
+	if _, ok := montageDecoders[strings.ToLower(filepath.Ext(fsPath))]; !ok {
+		writeAPIError(w, http.StatusUnsupportedMediaType, "no thumbnails for this file type")
+		return
+	}
+
+	key := cleanPath + "?size=" + strconv.Itoa(size)
+	hash := hashListing([]FileInfo{{Name: info.Name(), Size: info.Size(), ModTime: info.ModTime()}})
+	thumb, ok := thumbnailCache.get(key, hash)
+	if !ok {
+		select {
+		case thumbnailSlots <- struct{}{}:
+		case <-r.Context().Done():
+			return
+		}
+		thumb, err = buildThumbnail(fsPath, size)
+		<-thumbnailSlots
+		if err != nil {
+			log.Printf("Thumbnail of %s failed: %v", fsPath, err)
+			writeAPIError(w, http.StatusUnprocessableEntity, "could not build thumbnail")
+			return
+		}
+		thumbnailCache.put(key, hash, thumb)
+	}
+
+	// The image's own mtime lets browsers revalidate with If-Modified-Since
+	// or, naming the thumbnail size too, If-None-Match
+	w.Header().Set("Content-Type", "image/jpeg")
+	w.Header().Set("Cache-Control", "private, no-cache")
+	w.Header().Set("ETag", fmt.Sprintf(`"%x-%x-%d"`, info.ModTime().UnixNano(), info.Size(), size))
+	http.ServeContent(w, r, "", info.ModTime(), bytes.NewReader(thumb))
+}
+
+// buildThumbnail decodes the image at path and encodes it scaled down to fit
+// in a size x size box. Smaller images keep their size.
+func buildThumbnail(path string, size int) ([]byte, error) {
+	src, err := decodeForMontage(path)
+	if err != nil {
+		return nil, err
+	}
+	sb := src.Bounds()
+	w, h := sb.Dx(), sb.Dy()
+	if w > size || h > size {
+		if w >= h {
+			w, h = size, h*size/w
+		} else {
+			w, h = w*size/h, size
+		}
+	}
+	if w < 1 {
+		w = 1
+	}
+	if h < 1 {
+		h = 1
+	}
+	scaled := image.NewRGBA(image.Rect(0, 0, w, h))
+	drawScaled(scaled, scaled.Bounds(), src)
+
+	// JPEG has no transparency, so transparent PNGs and GIFs go on white
+	dst := image.NewRGBA(scaled.Bounds())
+	draw.Draw(dst, dst.Bounds(), &image.Uniform{color.White}, image.Point{}, draw.Src)
+	draw.Draw(dst, dst.Bounds(), scaled, image.Point{}, draw.Over)
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, dst, &jpeg.Options{Quality: 80}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,76 @@
+package server
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"testing"
+)
+
+// tinyWebP is a 1x1 lossless WebP
+const tinyWebP = "UklGRhoAAABXRUJQVlA4TA0AAAAvAAAAEAcQERGIiP4HAA=="
+
+// writePNG stores a w x h PNG at rel
+func writePNG(t *testing.T, fh *FileHandler, rel string, w, h int) {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for x := 0; x < w; x++ {
+		img.Set(x, 0, color.RGBA{R: 255, A: 255})
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, fh, rel, buf.String())
+}
+
+func TestThumbnail(t *testing.T) {
+	fh := newTestHandler(t, "")
+	writePNG(t, fh, "wide.png", 800, 400)
+	webp, _ := base64.StdEncoding.DecodeString(tinyWebP)
+	writeFile(t, fh, "tiny.webp", string(webp))
+	writePNG(t, fh, ".private/hidden.png", 10, 10)
+	writeFile(t, fh, "notes.txt", "text")
+
+	rec := do(fh, http.MethodGet, "/api/thumbnail?path=/wide.png&size=100")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("thumbnail of wide.png = %d, want 200", rec.Code)
+	}
+	img, err := jpeg.Decode(rec.Body)
+	if err != nil {
+		t.Fatalf("the thumbnail is not a JPEG: %v", err)
+	}
+	if b := img.Bounds(); b.Dx() != 100 || b.Dy() != 50 {
+		t.Errorf("thumbnail is %dx%d, want 100x50", b.Dx(), b.Dy())
+	}
+
+	rec = do(fh, http.MethodGet, "/api/thumbnail?path=/tiny.webp")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("thumbnail of tiny.webp = %d, want 200", rec.Code)
+	}
+	if img, err := jpeg.Decode(rec.Body); err != nil || img.Bounds().Dx() != 1 {
+		t.Errorf("WebP thumbnail did not decode to a 1x1 JPEG: %v", err)
+	}
+
+	for target, want := range map[string]int{
+		"/api/thumbnail?path=/notes.txt":           http.StatusUnsupportedMediaType,
+		"/api/thumbnail?path=/.private/hidden.png": http.StatusNotFound,
+		"/api/thumbnail?path=/wide.png&size=5":     http.StatusBadRequest,
+	} {
+		if rec := do(fh, http.MethodGet, target); rec.Code != want {
+			t.Errorf("GET %s = %d, want %d", target, rec.Code, want)
+		}
+	}
+}
+
+func TestThumbnailNeedsLogin(t *testing.T) {
+	fh := newTestHandler(t, "hunter2")
+	writePNG(t, fh, "photo.png", 10, 10)
+	if rec := do(protectedHandler(fh), http.MethodGet, "/api/thumbnail?path=/photo.png"); rec.Code != http.StatusUnauthorized {
+		t.Errorf("GET /api/thumbnail without a login = %d, want 401", rec.Code)
+	}
+}
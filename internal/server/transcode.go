@@ -0,0 +1,98 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// maxTranscodes bounds how many ffmpeg processes may run at once since
+// transcoding is CPU-heavy
+const maxTranscodes = 2
+
+var transcodeSlots = make(chan struct{}, maxTranscodes)
+
+// transcodeTarget describes an output format ffmpeg can stream to us
+type transcodeTarget struct {
+	ext         string
+	contentType string
+	args        []string
+}
+
+var transcodeTargets = map[string]transcodeTarget{
+	"mp3": {
+		ext:         ".mp3",
+		contentType: "audio/mpeg",
+		args:        []string{"-codec:a", "libmp3lame", "-q:a", "4", "-f", "mp3"},
+	},
+}
+
+// isAudioFile reports whether the file has one of the audio extensions we recognise
+func isAudioFile(filename string) bool {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".mp3", ".wav", ".flac", ".aac", ".ogg":
+		return true
+	}
+	return false
+}
+
+// serveTranscodedAudio streams fsPath converted to the requested format. It
+// returns false without writing anything when the original should be served
+// instead (ffmpeg missing, or the file is already in the target format).
+func (fh *FileHandler) serveTranscodedAudio(w http.ResponseWriter, r *http.Request, fsPath, format string) bool {
+	target, ok := transcodeTargets[strings.ToLower(format)]
+	if !ok {
+		http.Error(w, fmt.Sprintf("Unsupported transcode format %q", format), http.StatusBadRequest)
+		return true
+	}
+
+	if strings.ToLower(filepath.Ext(fsPath)) == target.ext {
+		return false // already playable as-is
+	}
+
+	ffmpeg, err := exec.LookPath("ffmpeg")
+	if err != nil {
+		return false
+	}
+
+	select {
+	case transcodeSlots <- struct{}{}:
+		defer func() { <-transcodeSlots }()
+	default:
+		w.Header().Set("Retry-After", "5")
+		http.Error(w, "Too many transcodes in progress, try again shortly", http.StatusServiceUnavailable)
+		return true
+	}
+
+	args := append([]string{"-hide_banner", "-loglevel", "error", "-i", fsPath, "-vn"}, target.args...)
+	args = append(args, "pipe:1")
+
+	// Tie ffmpeg to the request so it is killed if the client goes away
+	cmd := exec.CommandContext(r.Context(), ffmpeg, args...)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return false
+	}
+	if err := cmd.Start(); err != nil {
+		log.Printf("Failed to start ffmpeg: %v", err)
+		return false
+	}
+
+	// A live transcode can't seek, so ignore any Range header and tell the
+	// player up front so it falls back to non-seeking playback
+	w.Header().Set("Content-Type", target.contentType)
+	w.Header().Set("Accept-Ranges", "none")
+	w.WriteHeader(http.StatusOK)
+
+	if _, err := io.Copy(w, stdout); err != nil {
+		log.Printf("Transcode of %s interrupted: %v", fsPath, err)
+	}
+	if err := cmd.Wait(); err != nil && r.Context().Err() == nil {
+		log.Printf("ffmpeg failed for %s: %v", fsPath, err)
+	}
+	return true
+}
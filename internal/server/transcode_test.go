@@ -0,0 +1,96 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// getRange sends a GET for target asking for its first 16 bytes
+func getRange(h http.Handler, target string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	req.Header.Set("Range", "bytes=0-15")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+// fakeFFmpeg puts an ffmpeg on PATH that ignores its arguments and writes
+// a fixed stream
+func fakeFFmpeg(t *testing.T) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("needs a shell script on PATH")
+	}
+	dir := t.TempDir()
+	script := "#!/bin/sh\nprintf 'transcoded audio stream, longer than the range'\n"
+	if err := os.WriteFile(filepath.Join(dir, "ffmpeg"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir)
+}
+
+func TestTranscodeIgnoresRange(t *testing.T) {
+	fh := newTestHandler(t, "")
+	writeFile(t, fh, "song.flac", "not really flac, but long enough")
+	fakeFFmpeg(t)
+
+	rec := getRange(fh, "/song.flac?transcode=mp3")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("ranged transcode = %d, want a full 200", rec.Code)
+	}
+	if got := rec.Header().Get("Accept-Ranges"); got != "none" {
+		t.Errorf("Accept-Ranges = %q, want none", got)
+	}
+	if got := rec.Body.String(); got != "transcoded audio stream, longer than the range" {
+		t.Errorf("body = %q, want the whole stream", got)
+	}
+}
+
+func TestStaticAudioKeepsRanges(t *testing.T) {
+	fh := newTestHandler(t, "")
+	writeFile(t, fh, "song.mp3", "0123456789abcdefghijklmnopqrstuvwxyz")
+
+	// Already mp3, so ?transcode=mp3 serves the file itself
+	for _, target := range []string{"/song.mp3", "/song.mp3?transcode=mp3"} {
+		rec := getRange(fh, target)
+		if rec.Code != http.StatusPartialContent {
+			t.Errorf("GET %s with a Range = %d, want 206", target, rec.Code)
+		}
+		if got := rec.Header().Get("Accept-Ranges"); got != "bytes" {
+			t.Errorf("GET %s: Accept-Ranges = %q, want bytes", target, got)
+		}
+		if got := rec.Body.String(); got != "0123456789abcdef" {
+			t.Errorf("GET %s: body = %q, want the first 16 bytes", target, got)
+		}
+	}
+}
+
+func TestGeneratedArchivesIgnoreRange(t *testing.T) {
+	fh := newTestHandler(t, "")
+	writeFile(t, fh, "album/one.mp3", "first track")
+	writeFile(t, fh, "album/two.mp3", "second track")
+
+	rec := getRange(fh, "/album?download=zip")
+	if rec.Code != http.StatusOK {
+		t.Errorf("ranged zip = %d, want a full 200", rec.Code)
+	}
+	if got := rec.Header().Get("Accept-Ranges"); got != "none" {
+		t.Errorf("zip Accept-Ranges = %q, want none", got)
+	}
+
+	plan, err := fh.planTar(filepath.Join(fh.rootDir, "album"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec = getRange(fh, "/album?download=zip&split=1MB&part=1&v="+plan.fingerprint())
+	if rec.Code != http.StatusOK {
+		t.Errorf("ranged split part = %d, want a full 200", rec.Code)
+	}
+	if got := rec.Header().Get("Accept-Ranges"); got != "none" {
+		t.Errorf("split part Accept-Ranges = %q, want none", got)
+	}
+}
@@ -0,0 +1,79 @@
+package server
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// uploadMarker is a file that opens its folder, and everything below it, to
+// uploads when --upload-path limits where uploads may go. If it contains a
+// bcrypt hash, uploads into that subtree also need the matching password;
+// markers further down can add their own, but never lift one.
+// The marker itself is never listed or served.
+const uploadMarker = ".goshare-uploads"
+
+// uploadRule is what the markers in a folder and its parents say about it
+type uploadRule struct {
+	marked         bool
+	passwordHashes [][]byte // bcrypt hashes of every marker on the way up that has one
+}
+
+// uploadRuleFor reads every marker from cleanDir up to the share root. Any
+// marker opens the folder; every password among them is required, so an
+// empty marker in a subfolder can't drop its parent's password.
+func (fh *FileHandler) uploadRuleFor(cleanDir string) uploadRule {
+	var rule uploadRule
+	dir := cleanDir
+	for {
+		if _, fsDir, ok := fh.resolvePath(dir); ok {
+			if f, err := os.Open(filepath.Join(fsDir, uploadMarker)); err == nil {
+				content, _ := io.ReadAll(io.LimitReader(f, 1024))
+				f.Close()
+				rule.marked = true
+				if hash := bytes.TrimSpace(content); len(hash) > 0 {
+					rule.passwordHashes = append(rule.passwordHashes, hash)
+				}
+			}
+		}
+		if dir == "/" {
+			return rule
+		}
+		dir = filepath.Dir(dir)
+	}
+}
+
+// needsPassword reports whether uploads governed by rule need a password
+func (rule uploadRule) needsPassword() bool {
+	return len(rule.passwordHashes) > 0
+}
+
+// uploadAllowed reports whether uploads may be written to cleanDir, a path
+// from resolvePath. Without --upload-path every folder accepts uploads.
+func (fh *FileHandler) uploadAllowed(cleanDir string, rule uploadRule) bool {
+	if len(fh.uploadPaths) == 0 || rule.marked {
+		return true
+	}
+	for _, allowed := range fh.uploadPaths {
+		if cleanDir == allowed || allowed == "/" || strings.HasPrefix(cleanDir, allowed+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// checkUploadPassword reports whether password unlocks a folder governed by
+// rule: it has to match every marker's hash. Folders without a
+// password-carrying marker need none.
+func (rule uploadRule) checkUploadPassword(password string) bool {
+	for _, hash := range rule.passwordHashes {
+		if bcrypt.CompareHashAndPassword(hash, []byte(password)) != nil {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,97 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func writeMarker(t *testing.T, fh *FileHandler, dir, password string) {
+	t.Helper()
+	content := ""
+	if password != "" {
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+		if err != nil {
+			t.Fatal(err)
+		}
+		content = string(hash)
+	}
+	writeFile(t, fh, dir+"/"+uploadMarker, content)
+}
+
+func TestUploadRuleKeepsParentPassword(t *testing.T) {
+	fh := newTestHandler(t, "")
+	fh.uploadPaths = []string{"/public"}
+	writeMarker(t, fh, "incoming", "secret")
+	writeMarker(t, fh, "incoming/open", "")
+	writeMarker(t, fh, "incoming/stricter", "other")
+
+	for _, c := range []struct {
+		dir, password string
+		allowed, ok   bool
+	}{
+		{"/incoming", "secret", true, true},
+		{"/incoming", "", true, false},
+		// An empty marker below doesn't lift the parent's password
+		{"/incoming/open", "", true, false},
+		{"/incoming/open", "secret", true, true},
+		{"/incoming/open/deeper", "secret", true, true},
+		// A second password adds to the first
+		{"/incoming/stricter", "other", true, false},
+		{"/incoming/stricter", "secret", true, false},
+		{"/public", "", true, true},
+		{"/elsewhere", "", false, true},
+	} {
+		rule := fh.uploadRuleFor(c.dir)
+		if got := fh.uploadAllowed(c.dir, rule); got != c.allowed {
+			t.Errorf("uploadAllowed(%s) = %v, want %v", c.dir, got, c.allowed)
+		}
+		if got := rule.checkUploadPassword(c.password); got != c.ok {
+			t.Errorf("checkUploadPassword(%s, %q) = %v, want %v", c.dir, c.password, got, c.ok)
+		}
+	}
+}
+
+func TestUploadOnlyIntoAllowedFolders(t *testing.T) {
+	fh := newTestHandler(t, "")
+	fh.uploadPaths = []string{"/incoming"}
+	writeFile(t, fh, "incoming-old/keep.txt", "x")
+	writeFile(t, fh, "other/keep.txt", "x")
+	writeMarker(t, fh, "other/dropbox", "")
+
+	for _, c := range []struct {
+		dir  string
+		want int
+	}{
+		{"/incoming", http.StatusOK},
+		{"/incoming/nested", http.StatusOK},
+		{"/other/dropbox", http.StatusOK},
+		{"/", http.StatusForbidden},
+		{"/other", http.StatusForbidden},
+		// A shared name prefix isn't the same folder
+		{"/incoming-old", http.StatusForbidden},
+	} {
+		rec := httptest.NewRecorder()
+		fh.ServeHTTP(rec, uploadRequest(t, map[string]string{"directory": c.dir}, map[string]string{"new.txt": "x"}))
+		if rec.Code != c.want {
+			t.Errorf("upload into %s = %d, want %d", c.dir, rec.Code, c.want)
+		}
+		_, err := os.Stat(filepath.Join(fh.rootDir, filepath.FromSlash(c.dir), "new.txt"))
+		if written := err == nil; written != (c.want == http.StatusOK) {
+			t.Errorf("upload into %s written = %v", c.dir, written)
+		}
+	}
+
+	// The upload form only shows where it would be accepted
+	for dir, want := range map[string]bool{"/incoming/": true, "/other/dropbox/": true, "/": false, "/other/": false} {
+		body := do(fh, http.MethodGet, dir).Body.String()
+		if got := strings.Contains(body, "Upload Files"); got != want {
+			t.Errorf("upload form shown in %s = %v, want %v", dir, got, want)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+)
+
+// VersionInfo identifies the running build. Release builds stamp the
+// fields through -ldflags -X in package cmd.
+type VersionInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	Date      string `json:"date"`
+	GoVersion string `json:"goVersion"`
+}
+
+// CompleteVersionInfo fills in what -ldflags didn't stamp from the VCS data
+// go build records, so a plain build of a checkout still names its commit
+func CompleteVersionInfo(v VersionInfo) VersionInfo {
+	v.GoVersion = runtime.Version()
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		info = &debug.BuildInfo{}
+	}
+	if v.Version == "" && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		v.Version = info.Main.Version // go install module@version
+	}
+	var revision, modified string
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			revision = setting.Value
+		case "vcs.modified":
+			modified = setting.Value
+		case "vcs.time":
+			if v.Date == "" {
+				v.Date = setting.Value
+			}
+		}
+	}
+	if v.Commit == "" && revision != "" {
+		v.Commit = revision
+		if modified == "true" {
+			v.Commit += "-dirty"
+		}
+	}
+	if v.Version == "" {
+		v.Version = "dev"
+	}
+	return v
+}
+
+// handleAPIVersion answers GET /api/version with the build's VersionInfo
+func (fh *FileHandler) handleAPIVersion(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(fh.version)
+}
@@ -0,0 +1,255 @@
+package server
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/net/webdav"
+)
+
+// davPrefix is where --webdav mounts the share
+const davPrefix = "/dav"
+
+// davWriteMethods change the share; --read-only refuses them. LOCK is among
+// them because locking a missing name creates an empty file.
+var davWriteMethods = map[string]bool{
+	"PUT": true, "DELETE": true, "MKCOL": true, "COPY": true,
+	"MOVE": true, "PROPPATCH": true, "LOCK": true, "UNLOCK": true,
+}
+
+// webDAVHandler serves the shared folder over WebDAV at /dav/, behind the
+// same password as the pages. Hidden files stay hidden unless
+// --show-hidden, --read-only refuses writes, writes follow the same upload
+// rules as the pages, uploads are held to --max-upload and uploads and
+// copies to --max-storage.
+func (fh *FileHandler) webDAVHandler() http.Handler {
+	dav := &webdav.Handler{
+		Prefix:     davPrefix,
+		FileSystem: davFS{Dir: webdav.Dir(fh.rootDir), fh: fh},
+		LockSystem: webdav.NewMemLS(),
+		Logger: func(r *http.Request, err error) {
+			if err != nil {
+				log.Printf("WebDAV %s %s: %v", r.Method, r.URL.Path, err)
+			}
+		},
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fh.readOnly && davWriteMethods[r.Method] {
+			http.Error(w, "This share is read-only", http.StatusForbidden)
+			return
+		}
+		if r.Method == "PUT" && fh.uploadsTLS && !fh.isSecureRequest(r) {
+			http.Error(w, "Uploads require HTTPS", http.StatusForbidden)
+			return
+		}
+		if fh.hiddenPath(strings.TrimPrefix(r.URL.Path, davPrefix)) || fh.hiddenPath(strings.TrimPrefix(davDestination(r), davPrefix)) {
+			http.NotFound(w, r)
+			return
+		}
+		if davWriteMethods[r.Method] && r.Method != "UNLOCK" {
+			for _, p := range []string{r.URL.Path, davDestination(r)} {
+				if p == "" {
+					continue
+				}
+				if reason := fh.davWriteRefusal(strings.TrimPrefix(p, davPrefix)); reason != "" {
+					http.Error(w, reason, http.StatusForbidden)
+					return
+				}
+			}
+		}
+		if r.Method == "PUT" {
+			if fh.quota != nil && r.ContentLength < 0 {
+				http.Error(w, "Send a Content-Length; this share has a storage limit", http.StatusLengthRequired)
+				return
+			}
+			if !fh.quota.reserve(r.ContentLength) {
+				http.Error(w, "The share is full", http.StatusInsufficientStorage)
+				return
+			}
+			// The stored size is left to the next walk, since a PUT may
+			// replace a file
+			defer fh.quota.release(r.ContentLength, 0)
+			r.Body = http.MaxBytesReader(w, r.Body, fh.maxUpload)
+		}
+		if r.Method == "COPY" && fh.quota != nil {
+			// A copy doubles what it copies, so it needs room for all of it
+			_, fsPath, ok := fh.resolvePath(strings.TrimPrefix(r.URL.Path, davPrefix))
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			size := treeSize(fsPath)
+			if !fh.quota.reserve(size) {
+				http.Error(w, "The share is full", http.StatusInsufficientStorage)
+				return
+			}
+			defer fh.quota.release(size, 0)
+		}
+		rec := &statusRecorder{ResponseWriter: w}
+		dav.ServeHTTP(rec, r)
+
+		if davWriteMethods[r.Method] && r.Method != "LOCK" && r.Method != "UNLOCK" {
+			for _, p := range []string{r.URL.Path, davDestination(r)} {
+				if p != "" {
+					fh.live.changed(path.Dir(path.Clean("/" + strings.TrimPrefix(p, davPrefix))))
+				}
+			}
+		}
+		if rec.status >= 200 && rec.status < 300 {
+			fh.auditDAV(r)
+			if davWriteMethods[r.Method] {
+				fh.quota.changed()
+			}
+		}
+	})
+}
+
+// davWriteRefusal applies the pages' upload rules to a WebDAV write that
+// creates, changes or removes p: its folder must be inside --upload-dir
+// and accept uploads under --upload-path and the marker files. A folder
+// whose marker asks for a password is refused outright, since WebDAV
+// clients have no way to send it. It returns why the write is refused, or
+// "" to allow it.
+func (fh *FileHandler) davWriteRefusal(p string) string {
+	cleanPath, _, ok := fh.resolvePath(p)
+	if !ok {
+		return "Access denied"
+	}
+	parent := filepath.Dir(cleanPath)
+	if fh.uploadDir != "" && fh.uploadDir != "/" && parent != fh.uploadDir && !strings.HasPrefix(parent, fh.uploadDir+"/") {
+		return "Uploads may only go to " + fh.uploadDir
+	}
+	rule := fh.uploadRuleFor(parent)
+	if !fh.uploadAllowed(parent, rule) {
+		return "Uploads are not allowed in this folder"
+	}
+	if rule.needsPassword() {
+		return "This folder needs an upload password, which WebDAV can't send; use the web page"
+	}
+	return ""
+}
+
+// auditDAV records a WebDAV request that changed the share
+func (fh *FileHandler) auditDAV(r *http.Request) {
+	name := path.Clean("/" + strings.TrimPrefix(r.URL.Path, davPrefix))
+	dest := ""
+	if d := davDestination(r); d != "" {
+		dest = path.Clean("/" + strings.TrimPrefix(d, davPrefix))
+	}
+	switch r.Method {
+	case "PUT":
+		var size int64
+		fsPath := filepath.Join(fh.rootDir, filepath.FromSlash(name))
+		if info, err := os.Stat(fsPath); err == nil {
+			size = info.Size()
+		}
+		recordUpload(fsPath, size)
+		fh.audit(r, "webdav", "upload", name, "", size)
+	case "DELETE":
+		fh.audit(r, "webdav", "delete", name, "", 0)
+	case "MKCOL":
+		fh.audit(r, "webdav", "mkdir", name, "", 0)
+	case "MOVE":
+		fh.audit(r, "webdav", "rename", name, dest, 0)
+	case "COPY":
+		fh.audit(r, "webdav", "copy", name, dest, 0)
+	}
+}
+
+// davDestination is the path COPY and MOVE write to, or ""
+func davDestination(r *http.Request) string {
+	dest := r.Header.Get("Destination")
+	if dest == "" {
+		return ""
+	}
+	u, err := url.Parse(dest)
+	if err != nil {
+		return ""
+	}
+	return u.Path
+}
+
+// davFS leaves hidden files out of folder listings, as the pages do, won't
+// serve or create files the pages don't share (--only-ext, the upload
+// marker, part files) and won't follow symlinks out of the share without
+// --follow-symlinks
+type davFS struct {
+	webdav.Dir
+	fh *FileHandler
+}
+
+// escapes reports whether name leads out of the share through a symlink
+func (d davFS) escapes(name string) bool {
+	fsPath := filepath.Join(string(d.Dir), filepath.FromSlash(path.Clean("/"+name)))
+	return !d.fh.followSymlinks && !d.fh.insideShare(fsPath)
+}
+
+// unshared reports whether name is a file, or would be created as one,
+// that showsFile leaves out. Folders are never filtered by name.
+func (d davFS) unshared(ctx context.Context, name string) bool {
+	if d.fh.showsFile(path.Base(path.Clean("/" + name))) {
+		return false
+	}
+	info, err := d.Dir.Stat(ctx, name)
+	return err != nil || !info.IsDir()
+}
+
+func (d davFS) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	if d.escapes(name) || d.unshared(ctx, name) {
+		return nil, os.ErrNotExist
+	}
+	return d.Dir.Stat(ctx, name)
+}
+
+func (d davFS) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
+	if d.escapes(name) || d.unshared(ctx, name) {
+		return nil, os.ErrNotExist
+	}
+	f, err := d.Dir.OpenFile(ctx, name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return davFile{File: f, fh: d.fh, fsPath: filepath.Join(string(d.Dir), filepath.FromSlash(path.Clean("/"+name)))}, nil
+}
+
+func (d davFS) RemoveAll(ctx context.Context, name string) error {
+	if d.escapes(name) || d.unshared(ctx, name) {
+		return os.ErrNotExist
+	}
+	return d.Dir.RemoveAll(ctx, name)
+}
+
+func (d davFS) Rename(ctx context.Context, oldName, newName string) error {
+	if d.escapes(oldName) || d.unshared(ctx, oldName) || d.escapes(newName) {
+		return os.ErrNotExist
+	}
+	// A file may not take a name the pages wouldn't share
+	if info, err := d.Dir.Stat(ctx, oldName); err == nil && !info.IsDir() && !d.fh.showsFile(path.Base(path.Clean("/"+newName))) {
+		return os.ErrPermission
+	}
+	return d.Dir.Rename(ctx, oldName, newName)
+}
+
+type davFile struct {
+	webdav.File
+	fh     *FileHandler
+	fsPath string
+}
+
+func (f davFile) Readdir(count int) ([]os.FileInfo, error) {
+	infos, err := f.File.Readdir(count)
+	visible := infos[:0]
+	for _, info := range infos {
+		if !f.fh.hidden(info.Name()) && (info.IsDir() || f.fh.showsFile(info.Name())) && f.fh.allowsLink(filepath.Join(f.fsPath, info.Name()), info.Mode()) {
+			visible = append(visible, info)
+		}
+	}
+	return visible, err
+}
@@ -0,0 +1,108 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func davRequest(h http.Handler, method, target, body, destination string) int {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	if destination != "" {
+		req.Header.Set("Destination", destination)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec.Code
+}
+
+func TestWebDAVFollowsUploadRules(t *testing.T) {
+	fh := newTestHandler(t, "")
+	fh.showHidden = true
+	fh.uploadPaths = []string{"/inbox"}
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, fh, "inbox/locked/"+uploadMarker, string(hash))
+	writeFile(t, fh, "other/keep.txt", "keep")
+	h := fh.webDAVHandler()
+
+	for _, c := range []struct {
+		method, target, destination string
+		want                        int
+	}{
+		{"PUT", "/dav/inbox/a.txt", "", http.StatusCreated},
+		{"PUT", "/dav/other/b.txt", "", http.StatusForbidden},
+		{"MKCOL", "/dav/other/new", "", http.StatusForbidden},
+		{"DELETE", "/dav/other/keep.txt", "", http.StatusForbidden},
+		{"PUT", "/dav/inbox/locked/c.txt", "", http.StatusForbidden},
+		{"MOVE", "/dav/inbox/a.txt", "/dav/other/a.txt", http.StatusForbidden},
+		{"COPY", "/dav/inbox/a.txt", "/dav/inbox/locked/a.txt", http.StatusForbidden},
+		{"PUT", "/dav/inbox/" + uploadMarker, "", http.StatusNotFound},
+		{"GET", "/dav/inbox/locked/" + uploadMarker, "", http.StatusNotFound},
+	} {
+		if got := davRequest(h, c.method, c.target, "data", c.destination); got != c.want {
+			t.Errorf("%s %s = %d, want %d", c.method, c.target, got, c.want)
+		}
+	}
+}
+
+func TestWebDAVUploadDir(t *testing.T) {
+	fh := newTestHandler(t, "")
+	fh.uploadDir = "/drop"
+	writeFile(t, fh, "drop/.keep", "")
+	h := fh.webDAVHandler()
+
+	if got := davRequest(h, "PUT", "/dav/drop/a.txt", "data", ""); got != http.StatusCreated {
+		t.Errorf("PUT into --upload-dir = %d, want 201", got)
+	}
+	if got := davRequest(h, "PUT", "/dav/a.txt", "data", ""); got != http.StatusForbidden {
+		t.Errorf("PUT outside --upload-dir = %d, want 403", got)
+	}
+}
+
+func TestWebDAVOnlyExt(t *testing.T) {
+	fh := newTestHandler(t, "")
+	fh.onlyExt = newExtFilter([]string{"jpg"})
+	writeFile(t, fh, "photo.jpg", "jpg")
+	writeFile(t, fh, "notes.txt", "txt")
+	writeFile(t, fh, "docs/readme.jpg", "jpg")
+	h := fh.webDAVHandler()
+
+	for target, want := range map[string]int{
+		"/dav/photo.jpg":       http.StatusOK,
+		"/dav/notes.txt":       http.StatusNotFound,
+		"/dav/docs/readme.jpg": http.StatusOK,
+	} {
+		if got := davRequest(h, "GET", target, "", ""); got != want {
+			t.Errorf("GET %s = %d, want %d", target, got, want)
+		}
+	}
+	if got := davRequest(h, "PUT", "/dav/evil.exe", "data", ""); got == http.StatusCreated {
+		t.Error("PUT of a file --only-ext doesn't share succeeded")
+	}
+}
+
+func TestWebDAVCopyRespectsQuota(t *testing.T) {
+	fh := newTestHandler(t, "")
+	writeFile(t, fh, "big/a.bin", strings.Repeat("x", 600))
+	writeFile(t, fh, "small.txt", "hi")
+	fh.quota = newStorageQuota(1000, []string{fh.rootDir})
+	h := fh.webDAVHandler()
+
+	if got := davRequest(h, "COPY", "/dav/big", "", "/dav/big2"); got != http.StatusInsufficientStorage {
+		t.Errorf("COPY of a folder that doesn't fit = %d, want 507", got)
+	}
+	if _, err := os.Stat(filepath.Join(fh.rootDir, "big2")); !os.IsNotExist(err) {
+		t.Errorf("the refused copy was made anyway: %v", err)
+	}
+	if got := davRequest(h, "COPY", "/dav/small.txt", "", "/dav/small2.txt"); got != http.StatusCreated {
+		t.Errorf("COPY of a file that fits = %d, want 201", got)
+	}
+}